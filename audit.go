@@ -0,0 +1,127 @@
+package merkletree
+
+import (
+	"context"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"time"
+)
+
+type actorKey struct{}
+
+// WithActor returns a context whose mutations are recorded in the audit log
+// as made by actor, e.g. the user or service calling AppendLeafCtx.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor carried by ctx, empty if none.
+func ActorFrom(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// History is HistoryCtx with the context the manager was created with.
+func (mm *MerkleTreeManager) History(mtAddress string, from uint64, limit int) ([]*db.AuditEntry, error) {
+	return mm.HistoryCtx(mm.ctx, mtAddress, from, limit)
+}
+
+// HistoryCtx returns at most limit entries of the audit history of a tree,
+// oldest first, starting with the entry numbered from. The next page starts
+// at the Seq of the last entry returned plus one. It fails with
+// db.ErrNotSupported when the storage keeps no audit log.
+func (mm *MerkleTreeManager) HistoryCtx(ctx context.Context, mtAddress string, from uint64, limit int) ([]*db.AuditEntry, error) {
+	if !db.Supports(mm.storage, (*db.AuditLog)(nil)) {
+		return nil, db.ErrNotSupported
+	}
+	log := mm.storage.(db.AuditLog)
+
+	entries, err := log.FindAudit(ctx, mtAddress, from, limit)
+	if err != nil {
+		mm.Error("History FindAudit err: ", err, "mtAddress", mtAddress)
+		return nil, err
+	}
+	return entries, nil
+}
+
+// audit records a mutation made by the actor of ctx when the storage keeps
+// an audit log.
+func audit(ctx context.Context, storage db.Storage, entry *db.AuditEntry) error {
+	if !db.Supports(storage, (*db.AuditLog)(nil)) {
+		return nil
+	}
+	log := storage.(db.AuditLog)
+
+	entry.Time = time.Now().UTC()
+	if entry.Actor == "" {
+		entry.Actor = ActorFrom(ctx)
+	}
+	return log.AppendAudit(ctx, entry)
+}
+
+// rootHash returns the hex root hash of a tree, empty when it has no leaves.
+func rootHash(ctx context.Context, storage db.Storage, mtAddress string) (string, error) {
+	root, err := storage.FindRootNode(ctx, mtAddress)
+	if err == db.ErrNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return root.Hash, nil
+}
+
+// treeMeta returns the metadata of a tree, empty when it has no nodes.
+func treeMeta(ctx context.Context, storage db.Storage, mtAddress string) (*db.TreeMeta, error) {
+	meta, err := db.FindTreeMeta(ctx, storage, mtAddress)
+	if err == db.ErrNotFound {
+		return &db.TreeMeta{MtAddress: mtAddress}, nil
+	}
+	return meta, err
+}
+
+// auditAppend records the leaves a batch appended in one entry, with the
+// root of the tree after them.
+func (t *MerkleTree) auditAppend(ctx context.Context, intent *db.AppendIntent, appended []string) error {
+	if !db.Supports(t.storage, (*db.AuditLog)(nil)) {
+		return nil
+	}
+
+	meta, err := treeMeta(ctx, t.storage, t.mtAddress)
+	if err != nil {
+		t.Error("auditAppend FindTreeMeta err: ", err)
+		return err
+	}
+	err = audit(ctx, t.storage, &db.AuditEntry{
+		MtAddress: t.mtAddress,
+		Op:        db.AuditAppend,
+		Leaves:    appended,
+		LeafIndex: intent.LevelNo,
+		OldRoot:   intent.OldRoot,
+		NewRoot:   meta.RootHash,
+		Actor:     intent.Actor,
+	})
+	if err != nil {
+		t.Error("auditAppend AppendAudit err: ", err)
+		return err
+	}
+	return nil
+}
+
+// auditRecovered records the leaves written by an interrupted batch, unless
+// the batch was audited before the crash.
+func (t *MerkleTree) auditRecovered(ctx context.Context, intent *db.AppendIntent, written []string) error {
+	if !db.Supports(t.storage, (*db.AuditLog)(nil)) {
+		return nil
+	}
+	log := t.storage.(db.AuditLog)
+
+	last, err := log.LastAudit(ctx, t.mtAddress)
+	if err != nil && err != db.ErrNotFound {
+		t.Error("auditAppend LastAudit err: ", err)
+		return err
+	}
+	if last != nil && last.Op == db.AuditAppend && last.LeafIndex == intent.LevelNo {
+		return nil
+	}
+	return t.auditAppend(ctx, intent, written)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+)
+
+// defaultTree names the tree of a memory: storage when -tree is not given.
+const defaultTree = "tree"
+
+// treeFlags are the flags of the commands working on one tree.
+type treeFlags struct {
+	storage    *string
+	tree       *string
+	leaves     *string
+	hasher     *string
+	leafSchema *string
+}
+
+func addTreeFlags(fs *flag.FlagSet) *treeFlags {
+	return &treeFlags{
+		storage:    fs.String("storage", "memory:", "storage URL"),
+		tree:       fs.String("tree", "", "tree address, required but with a memory: storage"),
+		leaves:     fs.String("leaves", "", "CSV or JSON leaf file to build the tree from"),
+		hasher:     fs.String("hasher", "", "hasher of a new tree, keccak256 by default"),
+		leafSchema: fs.String("leaf-schema", "", "leaf schema of a new tree, address by default"),
+	}
+}
+
+func (tf *treeFlags) memory() bool {
+	return strings.HasPrefix(*tf.storage, "memory:")
+}
+
+func (tf *treeFlags) address() (string, error) {
+	if *tf.tree != "" {
+		return *tf.tree, nil
+	}
+	if tf.memory() {
+		return defaultTree, nil
+	}
+	return "", errors.New("-tree is required")
+}
+
+// options returns the hasher and leaf schema named by the flags.
+func (tf *treeFlags) options() ([]merkletree.Option, merkletree.LeafSchema, error) {
+	var opts []merkletree.Option
+	schema := merkletree.AddressSchema
+	if *tf.hasher != "" {
+		hasher, err := merkletree.LookupHasher(*tf.hasher)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, merkletree.WithHasher(hasher))
+	}
+	if *tf.leafSchema != "" {
+		var err error
+		if schema, err = merkletree.LookupLeafSchema(*tf.leafSchema); err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, merkletree.WithLeafSchema(schema))
+	}
+	return opts, schema, nil
+}
+
+// session is a tree opened by openTree, with its manager and storage.
+type session struct {
+	mtAddress string
+	storage   db.Storage
+	manager   *merkletree.MerkleTreeManager
+	tree      *merkletree.MerkleTree
+	close     func() error
+}
+
+// openTree opens the tree named by the flags. With -leaves, which needs a
+// memory: storage, the tree is built from the leaf file first.
+func (tf *treeFlags) openTree(ctx context.Context) (*session, error) {
+	mtAddress, err := tf.address()
+	if err != nil {
+		return nil, err
+	}
+	if *tf.leaves != "" && !tf.memory() {
+		return nil, errors.New("-leaves needs a memory: storage, write other storages with build")
+	}
+
+	storage, closeStorage, err := openStorage(*tf.storage)
+	if err != nil {
+		return nil, err
+	}
+	manager, err := merkletree.NewMerkleTreeManager(ctx, storage, merkletree.WithLogger(merkletree.DiscardLogger))
+	if err != nil {
+		closeStorage()
+		return nil, err
+	}
+
+	var tree *merkletree.MerkleTree
+	if *tf.leaves != "" {
+		tree, err = tf.build(ctx, manager, mtAddress, false)
+	} else {
+		tree, err = manager.OpenTreeCtx(ctx, mtAddress)
+	}
+	if err != nil {
+		closeStorage()
+		return nil, fmt.Errorf("tree %s: %w", mtAddress, err)
+	}
+	return &session{mtAddress: mtAddress, storage: storage, manager: manager, tree: tree, close: closeStorage}, nil
+}
+
+// build creates the tree, or opens it when appending, and appends the
+// leaves of the -leaves file.
+func (tf *treeFlags) build(ctx context.Context, manager *merkletree.MerkleTreeManager, mtAddress string, appendTo bool) (*merkletree.MerkleTree, error) {
+	opts, schema, err := tf.options()
+	if err != nil {
+		return nil, err
+	}
+	leaves, err := readLeaves(*tf.leaves, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := manager.CreateTreeCtx(ctx, mtAddress, opts...)
+	if err == merkletree.ErrTreeExists && appendTo {
+		tree, err = manager.OpenTreeCtx(ctx, mtAddress)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for len(leaves) > 0 {
+		n := len(leaves)
+		if n > buildBatch {
+			n = buildBatch
+		}
+		if err = tree.AppendLeavesCtx(ctx, leaves[:n]); err != nil {
+			return nil, err
+		}
+		leaves = leaves[n:]
+	}
+	return tree, nil
+}
+
+// buildBatch is the number of leaves appended at once.
+const buildBatch = 1000
+
+// readLeaves reads the leaves of a JSON file holding an array of strings, or
+// of the first column of a CSV file, whose first row is skipped when it is
+// not a valid leaf. Every leaf is checked against schema.
+func readLeaves(path string, schema merkletree.LeafSchema) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var leaves []string
+		if err = json.NewDecoder(f).Decode(&leaves); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for i, leaf := range leaves {
+			if err = schema.Validate(leaf); err != nil {
+				return nil, fmt.Errorf("%s leaf %d %q: %w", path, i, leaf, err)
+			}
+		}
+		return leaves, nil
+	}
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	var leaves []string
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		leaf := strings.TrimSpace(record[0])
+		if leaf == "" {
+			continue
+		}
+		if err = schema.Validate(leaf); err != nil {
+			// 首行不是合法叶子时视为表头
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("%s line %d %q: %w", path, line, leaf, err)
+		}
+		leaves = append(leaves, leaf)
+	}
+	return leaves, nil
+}
+
+func runBuild(args []string) error {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	tf := addTreeFlags(fs)
+	appendTo := fs.Bool("append", false, "append to the tree when it exists")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *tf.leaves == "" {
+		return errors.New("-leaves is required")
+	}
+	mtAddress, err := tf.address()
+	if err != nil {
+		return err
+	}
+
+	storage, closeStorage, err := openStorage(*tf.storage)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	manager, err := merkletree.NewMerkleTreeManager(ctx, storage, merkletree.WithLogger(merkletree.DiscardLogger))
+	if err != nil {
+		return err
+	}
+	if _, err = tf.build(ctx, manager, mtAddress, *appendTo); err != nil {
+		return fmt.Errorf("tree %s: %w", mtAddress, err)
+	}
+
+	info, err := manager.TreeInfoCtx(ctx, mtAddress)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d leaves, root %s\n", mtAddress, info.LeafCount, info.Root)
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree/db/chache"
+	"os"
+	"os/signal"
+)
+
+func runConvert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	storageURL := fs.String("storage", "", "redis storage URL")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	storage, closeStorage, err := openStorage(*storageURL)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	redisStorage, ok := storage.(*chache.RedisStorage)
+	if !ok {
+		return errors.New("only redis storages have a legacy encoding")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	converted, err := redisStorage.ConvertLegacyNodes(ctx)
+	fmt.Printf("%d values converted\n", converted)
+	return err
+}
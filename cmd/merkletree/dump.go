@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"os"
+	"os/signal"
+)
+
+func runDump(args []string) error {
+	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
+	tf := addTreeFlags(fs)
+	asJSON := fs.Bool("json", false, "print the nodes as JSON")
+	format := fs.String("format", "", "ascii or dot to draw the tree instead of listing its nodes")
+	highlight := fs.String("highlight", "", "leaf whose proof path is marked in a drawing")
+	depth := fs.Int("depth", 0, "levels drawn from the root, every level by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	s, err := tf.openTree(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	opts := merkletree.RenderOptions{Highlight: *highlight, MaxDepth: *depth}
+	switch *format {
+	case "":
+	case "ascii":
+		return s.tree.RenderASCIICtx(ctx, os.Stdout, opts)
+	case "dot":
+		return s.tree.RenderDOTCtx(ctx, os.Stdout, opts)
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	// 自根向下逐层输出
+	root, err := s.tree.GetRootNodeCtx(ctx)
+	if err != nil {
+		return err
+	}
+	nodes := []*db.TreeNode{}
+	for level := 0; root != nil && level <= root.Level; level++ {
+		levelNodes, err := s.storage.FindNodesByLevel(ctx, s.mtAddress, level)
+		if err != nil && err != db.ErrNotFound {
+			return err
+		}
+		nodes = append(levelNodes, nodes...)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(nodes)
+	}
+	for _, node := range nodes {
+		fmt.Printf("level=%d levelNo=%d hash=%s", node.Level, node.LevelNo, node.Hash)
+		if node.Data != "" {
+			fmt.Printf(" data=%s", node.Data)
+		}
+		fmt.Println()
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree"
+	"os"
+	"os/signal"
+)
+
+func runExportProofs(args []string) error {
+	fs := flag.NewFlagSet("export-proofs", flag.ContinueOnError)
+	tf := addTreeFlags(fs)
+	out := fs.String("out", "", "directory to write the shards and manifest to")
+	prefixLength := fs.Int("prefix", merkletree.DefaultPrefixLength, "hex digits of the leaves naming their shard")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		return errors.New("-out is required")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	s, err := tf.openTree(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	manifest, err := s.tree.ExportProofsCtx(ctx, *out, merkletree.ProofExportOptions{PrefixLength: *prefixLength})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d proofs in %d shards, root %s\n", s.mtAddress, manifest.LeafCount, len(manifest.Shards), manifest.Root)
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+func runFsck(args []string) error {
+	fs := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	storageURL := fs.String("storage", "", "storage URL")
+	trees := fs.String("trees", "", "comma separated trees to check, every registered tree by default")
+	asJSON := fs.Bool("json", false, "print the reports as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	storage, closeStorage, err := openStorage(*storageURL)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	addresses, err := fsckTrees(ctx, storage, *trees)
+	if err != nil {
+		return err
+	}
+
+	manager, err := merkletree.NewMerkleTreeManager(ctx, storage, merkletree.WithLogger(merkletree.DiscardLogger))
+	if err != nil {
+		return err
+	}
+
+	var reports []*merkletree.VerifyReport
+	issues := 0
+	for _, mtAddress := range addresses {
+		report, err := manager.VerifyTreeCtx(ctx, mtAddress)
+		if err != nil {
+			return fmt.Errorf("tree %s: %w", mtAddress, err)
+		}
+		reports = append(reports, report)
+		issues += len(report.Issues)
+
+		if !*asJSON {
+			fmt.Printf("%s: %d leaves, depth %d, %d issues\n", mtAddress, report.LeafCount, report.Depth, len(report.Issues))
+			for _, issue := range report.Issues {
+				fmt.Printf("  %s\n", issue)
+			}
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(reports); err != nil {
+			return err
+		}
+	}
+	if issues > 0 {
+		return fmt.Errorf("%d issues found", issues)
+	}
+	return nil
+}
+
+// fsckTrees returns the trees named by the -trees flag, or every registered
+// tree, plus the unregistered ones of a storage able to list them.
+func fsckTrees(ctx context.Context, storage db.Storage, trees string) ([]string, error) {
+	if trees != "" {
+		return strings.Split(trees, ","), nil
+	}
+
+	seen := make(map[string]bool)
+	var addresses []string
+	if db.Supports(storage, (*db.TreeRegistry)(nil)) {
+		infos, err := storage.(db.TreeRegistry).ListTreeInfos(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			seen[info.MtAddress] = true
+			addresses = append(addresses, info.MtAddress)
+		}
+	}
+
+	if !db.Supports(storage, (*db.MetaStore)(nil)) {
+		if !db.Supports(storage, (*db.TreeRegistry)(nil)) {
+			return nil, errors.New("the storage cannot list its trees, -trees is required")
+		}
+		return addresses, nil
+	}
+	store := storage.(db.MetaStore)
+	listed, err := store.ListTrees(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, mtAddress := range listed {
+		if !seen[mtAddress] {
+			addresses = append(addresses, mtAddress)
+		}
+	}
+	return addresses, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree"
+	"github.com/UXUYLabs/go-merkletree/importer"
+	"os"
+	"os/signal"
+)
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	storageURL := fs.String("storage", "", "storage URL")
+	mtAddress := fs.String("tree", "", "tree address, created when it does not exist")
+	file := fs.String("file", "", "CSV, JSON or NDJSON file to import")
+	format := fs.String("format", "", "csv, json or ndjson, from the file extension by default")
+	column := fs.String("column", "", "CSV header or JSON field holding the leaves")
+	hasherName := fs.String("hasher", "", "hasher of a new tree, keccak256 by default")
+	schemaName := fs.String("leaf-schema", "", "leaf schema of a new tree, address by default")
+	dryRun := fs.Bool("dry-run", false, "validate the rows without appending them")
+	reportPath := fs.String("report", "", "write the report as JSON to this file, - for stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *mtAddress == "" || *file == "" {
+		return errors.New("-tree and -file are required")
+	}
+
+	opts := importer.Options{Format: importer.Format(*format), Column: *column, DryRun: *dryRun}
+	if opts.Format == "" {
+		opts.Format = importer.FormatOf(*file)
+	}
+	var treeOpts []merkletree.Option
+	if *hasherName != "" {
+		hasher, err := merkletree.LookupHasher(*hasherName)
+		if err != nil {
+			return err
+		}
+		treeOpts = append(treeOpts, merkletree.WithHasher(hasher))
+	}
+	if *schemaName != "" {
+		schema, err := merkletree.LookupLeafSchema(*schemaName)
+		if err != nil {
+			return err
+		}
+		treeOpts = append(treeOpts, merkletree.WithLeafSchema(schema))
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	storage, closeStorage, err := openStorage(*storageURL)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	manager, err := merkletree.NewMerkleTreeManager(ctx, storage, merkletree.WithLogger(merkletree.DiscardLogger))
+	if err != nil {
+		return err
+	}
+	tree, err := manager.CreateTreeCtx(ctx, *mtAddress, treeOpts...)
+	if err == merkletree.ErrTreeExists {
+		tree, err = manager.OpenTreeCtx(ctx, *mtAddress)
+	}
+	if err != nil {
+		return fmt.Errorf("tree %s: %w", *mtAddress, err)
+	}
+
+	report, importErr := importer.Import(ctx, tree, f, opts)
+	if report == nil {
+		return importErr
+	}
+
+	if *reportPath != "" {
+		out := os.Stdout
+		if *reportPath != "-" {
+			if out, err = os.Create(*reportPath); err != nil {
+				return err
+			}
+			defer out.Close()
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(report); err != nil {
+			return err
+		}
+	}
+	if *reportPath != "-" {
+		fmt.Printf("%s: %d accepted, %d duplicates, %d rejected, %d blank, %d appended, root %s\n", *mtAddress,
+			report.Accepted, report.Duplicates, report.Rejected, report.Blank, report.Appended, report.Root)
+		if *reportPath == "" {
+			for _, row := range report.Rows {
+				if row.Status != importer.StatusAccepted {
+					fmt.Printf("  line %d %s %q: %s\n", row.Line, row.Status, row.Leaf, row.Reason)
+				}
+			}
+		}
+	}
+	return importErr
+}
@@ -0,0 +1,64 @@
+// Command merkletree manages merkle trees stored in a backend.
+//
+// Usage:
+//
+//	merkletree <command> [flags]
+//
+// Storages are given as URLs, e.g. redis://localhost:6379/0,
+// file:///var/lib/merkletree for a persistent memory storage directory, or
+// memory: for a storage discarded on exit, filled from a leaf file.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []*command{
+	{name: "build", usage: "create a tree from a CSV or JSON leaf file and print its root", run: runBuild},
+	{name: "import", usage: "append the valid, new rows of a CSV, JSON or NDJSON file to a tree", run: runImport},
+	{name: "root", usage: "print the root hash of a tree", run: runRoot},
+	{name: "proof", usage: "print the proof of a leaf", run: runProof},
+	{name: "verify", usage: "check a proof against a root", run: runVerify},
+	{name: "export-proofs", usage: "write the proof of every leaf as sharded JSON files", run: runExportProofs},
+	{name: "dump", usage: "print every node of a tree", run: runDump},
+	{name: "migrate", usage: "copy trees from one storage to another", run: runMigrate},
+	{name: "convert", usage: "rewrite JSON encoded redis nodes in the binary encoding", run: runConvert},
+	{name: "fsck", usage: "recompute every hash of trees and report inconsistencies", run: runFsck},
+	{name: "rebuild", usage: "repair trees by recomputing every node from their leaves", run: runRebuild},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "merkletree %s: %v\n", cmd.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "merkletree: unknown command %q\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: merkletree <command> [flags]")
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", cmd.name, cmd.usage)
+	}
+}
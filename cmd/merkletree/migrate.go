@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree/migrate"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	src := fs.String("src", "", "source storage URL")
+	dst := fs.String("dst", "", "destination storage URL")
+	trees := fs.String("trees", "", "comma separated trees to copy, every registered tree by default")
+	checkpoint := fs.String("checkpoint", "", "file recording progress, rerun with the same file to resume")
+	batch := fs.Int("batch", migrate.DefaultBatchSize, "nodes written per batch")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *src == "" || *dst == "" {
+		return errors.New("-src and -dst are required")
+	}
+
+	srcStorage, closeSrc, err := openStorage(*src)
+	if err != nil {
+		return err
+	}
+	defer closeSrc()
+	dstStorage, closeDst, err := openStorage(*dst)
+	if err != nil {
+		return err
+	}
+	defer closeDst()
+
+	opts := migrate.Options{
+		BatchSize: *batch,
+		Progress: func(mtAddress string, level, copied int) {
+			fmt.Fprintf(os.Stderr, "\r%s: level %d, %d nodes", mtAddress, level, copied)
+		},
+	}
+	if *trees != "" {
+		opts.Trees = strings.Split(*trees, ",")
+	}
+	if *checkpoint != "" {
+		if opts.Checkpoint, err = migrate.NewFileCheckpoint(*checkpoint); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	results, err := migrate.Migrate(ctx, srcStorage, dstStorage, opts)
+	for _, result := range results {
+		if result.Skipped {
+			fmt.Printf("%s: already migrated, root %s\n", result.MtAddress, result.Root)
+		} else {
+			fmt.Printf("\r%s: %d nodes, root %s\n", result.MtAddress, result.Nodes, result.Root)
+		}
+	}
+	return err
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree/keccak256"
+	"os"
+	"os/signal"
+)
+
+func runProof(args []string) error {
+	fs := flag.NewFlagSet("proof", flag.ContinueOnError)
+	tf := addTreeFlags(fs)
+	asJSON := fs.Bool("json", false, "print the leaf, index, root and proof as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: merkletree proof [flags] <leaf>")
+	}
+	leaf := fs.Arg(0)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	s, err := tf.openTree(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	index, err := s.tree.LeafIndexCtx(ctx, leaf)
+	if err != nil {
+		return err
+	}
+	if index < 0 {
+		return fmt.Errorf("leaf %s not in tree %s", leaf, s.mtAddress)
+	}
+	proofs, err := s.tree.GenerateProofCtx(ctx, leaf)
+	if err != nil {
+		return err
+	}
+
+	hexProofs := make([]string, 0, len(proofs))
+	for _, proof := range proofs {
+		hexProofs = append(hexProofs, keccak256.Bytes2Hex(proof))
+	}
+
+	if *asJSON {
+		root, err := s.tree.GetRootNodeCtx(ctx)
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(os.Stdout).Encode(map[string]interface{}{
+			"leaf":  leaf,
+			"index": index,
+			"root":  root.Hash,
+			"proof": hexProofs,
+		})
+	}
+	// 每行一个证明元素，可直接作为 verify 的参数
+	for _, proof := range hexProofs {
+		fmt.Println(proof)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree"
+	"os"
+	"os/signal"
+)
+
+func runRebuild(args []string) error {
+	fs := flag.NewFlagSet("rebuild", flag.ContinueOnError)
+	storageURL := fs.String("storage", "", "storage URL")
+	trees := fs.String("trees", "", "comma separated trees to rebuild, every registered tree by default")
+	dryRun := fs.Bool("dry-run", false, "report the repairs without writing anything")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	storage, closeStorage, err := openStorage(*storageURL)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	addresses, err := fsckTrees(ctx, storage, *trees)
+	if err != nil {
+		return err
+	}
+
+	manager, err := merkletree.NewMerkleTreeManager(ctx, storage, merkletree.WithLogger(merkletree.DiscardLogger))
+	if err != nil {
+		return err
+	}
+
+	for _, mtAddress := range addresses {
+		report, err := manager.RebuildTreeCtx(ctx, mtAddress, merkletree.RebuildOptions{DryRun: *dryRun})
+		if err != nil {
+			return fmt.Errorf("tree %s: %w", mtAddress, err)
+		}
+
+		verb := "rewritten"
+		if report.DryRun {
+			verb = "to rewrite"
+		}
+		fmt.Printf("%s: root %s, %d nodes %s, %d orphans\n", mtAddress, report.Root, len(report.Rewritten), verb, len(report.Removed))
+		for _, pos := range report.Rewritten {
+			fmt.Printf("  rewrite level=%d levelNo=%d\n", pos.Level, pos.LevelNo)
+		}
+		for _, pos := range report.Removed {
+			fmt.Printf("  remove level=%d levelNo=%d\n", pos.Level, pos.LevelNo)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+)
+
+func runRoot(args []string) error {
+	fs := flag.NewFlagSet("root", flag.ContinueOnError)
+	tf := addTreeFlags(fs)
+	asJSON := fs.Bool("json", false, "print the tree, root and leaf count as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	s, err := tf.openTree(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	info, err := s.manager.TreeInfoCtx(ctx, s.mtAddress)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return json.NewEncoder(os.Stdout).Encode(map[string]interface{}{
+			"tree":      s.mtAddress,
+			"root":      info.Root,
+			"leafCount": info.LeafCount,
+		})
+	}
+	fmt.Println(info.Root)
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"github.com/UXUYLabs/go-merkletree/db/chache"
+	"github.com/UXUYLabs/go-merkletree/db/memory"
+	"github.com/redis/go-redis/v9"
+	"net/url"
+)
+
+// openStorage opens the storage described by rawURL.
+func openStorage(rawURL string) (db.Storage, func() error, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch u.Scheme {
+	case "memory":
+		// 进程内存储，随命令退出而丢弃
+		return memory.NewMemoryStorage(), func() error { return nil }, nil
+	case "redis", "rediss":
+		opt, err := redis.ParseURL(rawURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		client := redis.NewClient(opt)
+		return chache.NewRedisStorageWithClient(client), client.Close, nil
+	case "file":
+		// 持久化的内存存储目录，例如 file:///var/lib/merkletree
+		storage, err := memory.OpenMemoryStorage(u.Path, memory.PersistOptions{SyncWrites: true})
+		if err != nil {
+			return nil, nil, err
+		}
+		return storage, storage.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported storage %q", rawURL)
+	}
+}
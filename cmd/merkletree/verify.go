@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree"
+	"github.com/UXUYLabs/go-merkletree/keccak256"
+	"strings"
+)
+
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	hasherName := fs.String("hasher", "", "hasher of the tree, keccak256 by default")
+	schemaName := fs.String("leaf-schema", "", "leaf schema of the tree, address by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		return errors.New("usage: merkletree verify [flags] <root> <leaf> <proof>...")
+	}
+
+	hasher := merkletree.Keccak256Hasher
+	schema := merkletree.AddressSchema
+	var err error
+	if *hasherName != "" {
+		if hasher, err = merkletree.LookupHasher(*hasherName); err != nil {
+			return err
+		}
+	}
+	if *schemaName != "" {
+		if schema, err = merkletree.LookupLeafSchema(*schemaName); err != nil {
+			return err
+		}
+	}
+
+	root, err := decodeHex(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("root: %w", err)
+	}
+	leaf := fs.Arg(1)
+	if err = schema.Validate(leaf); err != nil {
+		return fmt.Errorf("leaf %s: %w", leaf, err)
+	}
+	var proofs [][]byte
+	for i, arg := range fs.Args()[2:] {
+		proof, err := decodeHex(arg)
+		if err != nil {
+			return fmt.Errorf("proof %d: %w", i, err)
+		}
+		proofs = append(proofs, proof)
+	}
+
+	if !merkletree.VerifyProofRoot(hasher, keccak256.Bytes2Hex(root), proofs, leaf) {
+		return errors.New("proof is invalid")
+	}
+	fmt.Println("proof is valid")
+	return nil
+}
+
+func decodeHex(s string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"))
+}
@@ -0,0 +1,641 @@
+// Package cached is a caching db.Storage decorator.
+//
+// It keeps a bounded LRU of tree nodes plus, for the trees used last, the
+// root, the leaf count and a pinned set of nodes that every append and most
+// proofs touch: the top levels under the root and the right edge frontier. Writes made
+// through the decorator update the cache, so it stays exact as long as it is
+// the only writer of its trees. When other processes write the same trees,
+// call Invalidate after they do, or do not cache those trees.
+package cached
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"io"
+	"sync"
+	"time"
+)
+
+// Config bounds the cache.
+type Config struct {
+	// MaxNodes is the number of nodes kept in the LRU, pinned nodes excluded.
+	MaxNodes int
+	// PinnedLevels is the number of levels, root level included, that are
+	// never evicted while their tree is kept.
+	PinnedLevels int
+	// MaxTrees is the number of trees whose root, leaf count and pinned
+	// nodes are kept, DefaultConfig.MaxTrees when not positive.
+	MaxTrees int
+}
+
+var DefaultConfig = Config{
+	MaxNodes:     100000,
+	PinnedLevels: 8,
+	MaxTrees:     1024,
+}
+
+// Storage wraps a backend db.Storage with a cache. It is a db.Wrapper: the
+// methods of the optional interfaces the backend lacks return
+// db.ErrNotSupported.
+type Storage struct {
+	backend db.Storage
+	config  Config
+
+	mu sync.Mutex
+	// trees holds the state of the MaxTrees trees used last, treeLRU
+	// ordering them from the most recent.
+	trees   map[string]*list.Element
+	treeLRU *list.List
+	// clock numbers the writes and the tree states dropped. A backend read is
+	// only cached if the version of its tree did not change meanwhile.
+	clock   uint64
+	dropped uint64
+	lru     *list.List
+	entries map[cacheKey]*list.Element
+}
+
+// treeState is what is known about one tree. A nil root means unknown.
+type treeState struct {
+	address string
+	// version is the clock of the last write to the tree
+	version    uint64
+	root       *db.TreeNode
+	maxNo      int
+	maxNoKnown bool
+	pinned     map[db.NodePos]*db.TreeNode
+}
+
+// cacheKey addresses a node by position, or a leaf by data when data is set.
+type cacheKey struct {
+	address string
+	pos     db.NodePos
+	data    string
+}
+
+type entry struct {
+	key  cacheKey
+	node *db.TreeNode
+}
+
+func NewStorage(backend db.Storage, config Config) *Storage {
+	if config.MaxTrees <= 0 {
+		config.MaxTrees = DefaultConfig.MaxTrees
+	}
+	return &Storage{
+		backend: backend,
+		config:  config,
+		trees:   make(map[string]*list.Element),
+		treeLRU: list.New(),
+		lru:     list.New(),
+		entries: make(map[cacheKey]*list.Element),
+	}
+}
+
+// Unwrap returns the backend.
+func (s *Storage) Unwrap() db.Storage {
+	return s.backend
+}
+
+// Close closes the backend when it implements io.Closer.
+func (s *Storage) Close() error {
+	if closer, ok := s.backend.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Invalidate drops everything cached about a tree.
+func (s *Storage) Invalidate(address string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.invalidate(address)
+}
+
+func (s *Storage) invalidate(address string) {
+	if elem := s.trees[address]; elem != nil {
+		s.dropTree(elem)
+	} else {
+		// 进行中的读取不得缓存旧数据
+		s.clock++
+		s.dropped = s.clock
+	}
+	for key, elem := range s.entries {
+		if key.address == address {
+			s.lru.Remove(elem)
+			delete(s.entries, key)
+		}
+	}
+}
+
+func (s *Storage) Insert(ctx context.Context, node *db.TreeNode) error {
+	return s.write(node, s.backend.Insert(ctx, node))
+}
+
+func (s *Storage) Update(ctx context.Context, node *db.TreeNode) error {
+	return s.write(node, s.backend.Update(ctx, node))
+}
+
+func (s *Storage) write(node *db.TreeNode, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch err {
+	case nil:
+		s.written(node.MtAddress)
+		s.applyWrite(node)
+	case db.ErrNotFound:
+		s.written(node.MtAddress)
+	default:
+		s.invalidate(node.MtAddress)
+	}
+	return err
+}
+
+// writeBatch updates the cache after nodes were written as one batch.
+func (s *Storage) writeBatch(nodes []*db.TreeNode, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, node := range nodes {
+		if err != nil {
+			// 写入结果未知，丢弃缓存
+			s.invalidate(node.MtAddress)
+		} else {
+			s.written(node.MtAddress)
+			s.applyWrite(node)
+		}
+	}
+	return err
+}
+
+// applyWrite updates the tree state and the cached copy of a written node.
+func (s *Storage) applyWrite(node *db.TreeNode) {
+	state := s.tree(node.MtAddress)
+	if state != nil {
+		if state.maxNoKnown && node.Level == 0 && node.LevelNo > state.maxNo {
+			state.maxNo = node.LevelNo
+		}
+		if state.root != nil && (node.Level > state.root.Level ||
+			(node.Level == state.root.Level && node.LevelNo >= state.root.LevelNo)) {
+			state.root = node.Clone()
+		}
+	}
+
+	s.put(node)
+	if state != nil {
+		s.unpinStale(state)
+	}
+}
+
+func (s *Storage) FindRootNode(ctx context.Context, address string) (*db.TreeNode, error) {
+	s.mu.Lock()
+	if state := s.tree(address); state != nil && state.root != nil {
+		root := state.root.Clone()
+		s.mu.Unlock()
+		return root, nil
+	}
+	version := s.version(address)
+	s.mu.Unlock()
+
+	root, err := s.backend.FindRootNode(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.version(address) == version {
+		s.state(address).root = root.Clone()
+	}
+	return root, nil
+}
+
+func (s *Storage) FindMaxNoOfLeaf(ctx context.Context, address string) (int, error) {
+	s.mu.Lock()
+	if state := s.tree(address); state != nil && state.maxNoKnown {
+		maxNo := state.maxNo
+		s.mu.Unlock()
+		return maxNo, nil
+	}
+	version := s.version(address)
+	s.mu.Unlock()
+
+	maxNo, err := s.backend.FindMaxNoOfLeaf(ctx, address)
+	if err != nil {
+		return maxNo, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.version(address) == version {
+		state := s.state(address)
+		state.maxNo = maxNo
+		state.maxNoKnown = true
+		s.unpinStale(state)
+	}
+	return maxNo, nil
+}
+
+func (s *Storage) FindOneByLeafData(ctx context.Context, address string, data string) (*db.TreeNode, error) {
+	key := cacheKey{address: address, data: data}
+
+	s.mu.Lock()
+	if node, ok := s.get(key); ok {
+		s.mu.Unlock()
+		return node, nil
+	}
+	version := s.version(address)
+	s.mu.Unlock()
+
+	node, err := s.backend.FindOneByLeafData(ctx, address, data)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.version(address) == version {
+		s.put(node)
+	}
+	return node, nil
+}
+
+func (s *Storage) FindMultiTreeNode(ctx context.Context, address string, nodePoses []*db.NodePos) ([]*db.TreeNode, error) {
+	found := make(map[db.NodePos]*db.TreeNode, len(nodePoses))
+	var misses []*db.NodePos
+
+	s.mu.Lock()
+	version := s.version(address)
+	state := s.tree(address)
+	for _, pose := range nodePoses {
+		if state != nil && state.absent(*pose) {
+			continue
+		}
+		if node, ok := s.get(cacheKey{address: address, pos: *pose}); ok {
+			found[*pose] = node
+		} else {
+			misses = append(misses, pose)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(misses) > 0 {
+		nodes, err := s.backend.FindMultiTreeNode(ctx, address, misses)
+		if err != nil && err != db.ErrNotFound {
+			return nil, err
+		}
+
+		s.mu.Lock()
+		for _, node := range nodes {
+			if s.version(address) == version {
+				s.put(node)
+			}
+			found[db.NodePos{Level: node.Level, LevelNo: node.LevelNo}] = node
+		}
+		s.mu.Unlock()
+	}
+
+	var retTreeNodes []*db.TreeNode
+	for _, pose := range nodePoses {
+		if node := found[*pose]; node != nil {
+			retTreeNodes = append(retTreeNodes, node)
+		}
+	}
+
+	if len(retTreeNodes) == 0 {
+		return nil, db.ErrNotFound
+	}
+	return retTreeNodes, nil
+}
+
+// FindNodesByLevel is not cached: whole level scans would only flush the LRU.
+func (s *Storage) FindNodesByLevel(ctx context.Context, address string, level int) ([]*db.TreeNode, error) {
+	return s.backend.FindNodesByLevel(ctx, address, level)
+}
+
+// Begin opens a transaction whose reads are served by the cache. Its writes
+// are committed in one transaction of the backend when the backend implements
+// db.TxStorage, otherwise with the backend's WriteNodes.
+func (s *Storage) Begin(ctx context.Context) (db.Tx, error) {
+	if _, ok := s.backend.(db.TxStorage); ok {
+		return db.NewBufferedTx(s, s.commit), nil
+	}
+	if _, ok := s.backend.(db.BatchWriter); !ok {
+		return nil, db.ErrNotSupported
+	}
+	return db.NewBufferedTx(s, s.WriteNodes), nil
+}
+
+func (s *Storage) commit(ctx context.Context, nodes []*db.TreeNode) error {
+	return s.writeBatch(nodes, s.commitBackend(ctx, nodes))
+}
+
+// commitBackend writes nodes in one transaction of the backend.
+func (s *Storage) commitBackend(ctx context.Context, nodes []*db.TreeNode) error {
+	tx, err := s.backend.(db.TxStorage).Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		// 缓冲事务不区分新增与更新
+		err = tx.Update(ctx, node)
+		if err == db.ErrNotFound {
+			err = tx.Insert(ctx, node)
+		}
+		if err != nil {
+			if rbErr := tx.Rollback(ctx); rbErr != nil {
+				fmt.Printf("commitBackend Rollback err. err:%+v\n", rbErr)
+			}
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *Storage) WriteNodes(ctx context.Context, nodes []*db.TreeNode) error {
+	writer, ok := s.backend.(db.BatchWriter)
+	if !ok {
+		return db.ErrNotSupported
+	}
+	return s.writeBatch(nodes, writer.WriteNodes(ctx, nodes))
+}
+
+// RemoveNodes removes nodes from the backend and drops everything cached
+// about the tree.
+func (s *Storage) RemoveNodes(ctx context.Context, address string, poses []*db.NodePos) error {
+	remover, ok := s.backend.(db.NodeRemover)
+	if !ok {
+		return db.ErrNotSupported
+	}
+	err := remover.RemoveNodes(ctx, address, poses)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.invalidate(address)
+	return err
+}
+
+func (s *Storage) PutIntent(ctx context.Context, intent *db.AppendIntent) error {
+	journal, ok := s.backend.(db.IntentJournal)
+	if !ok {
+		return db.ErrNotSupported
+	}
+	return journal.PutIntent(ctx, intent)
+}
+
+func (s *Storage) FindIntent(ctx context.Context, address string) (*db.AppendIntent, error) {
+	journal, ok := s.backend.(db.IntentJournal)
+	if !ok {
+		return nil, db.ErrNotSupported
+	}
+	return journal.FindIntent(ctx, address)
+}
+
+func (s *Storage) DeleteIntent(ctx context.Context, address string) error {
+	journal, ok := s.backend.(db.IntentJournal)
+	if !ok {
+		return db.ErrNotSupported
+	}
+	return journal.DeleteIntent(ctx, address)
+}
+
+func (s *Storage) AppendAudit(ctx context.Context, entry *db.AuditEntry) error {
+	log, ok := s.backend.(db.AuditLog)
+	if !ok {
+		return db.ErrNotSupported
+	}
+	return log.AppendAudit(ctx, entry)
+}
+
+func (s *Storage) FindAudit(ctx context.Context, address string, from uint64, limit int) ([]*db.AuditEntry, error) {
+	log, ok := s.backend.(db.AuditLog)
+	if !ok {
+		return nil, db.ErrNotSupported
+	}
+	return log.FindAudit(ctx, address, from, limit)
+}
+
+func (s *Storage) LastAudit(ctx context.Context, address string) (*db.AuditEntry, error) {
+	log, ok := s.backend.(db.AuditLog)
+	if !ok {
+		return nil, db.ErrNotSupported
+	}
+	return log.LastAudit(ctx, address)
+}
+
+// DeleteTree deletes the tree from the backend and drops everything cached
+// about it.
+func (s *Storage) DeleteTree(ctx context.Context, address string) error {
+	deleter, ok := s.backend.(db.TreeDeleter)
+	if !ok {
+		return db.ErrNotSupported
+	}
+	err := deleter.DeleteTree(ctx, address)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.invalidate(address)
+	return err
+}
+
+func (s *Storage) ExpireTree(ctx context.Context, address string, expireAt time.Time) error {
+	deleter, ok := s.backend.(db.TreeDeleter)
+	if !ok {
+		return db.ErrNotSupported
+	}
+	return deleter.ExpireTree(ctx, address, expireAt)
+}
+
+func (s *Storage) FindExpiredTrees(ctx context.Context, now time.Time) ([]string, error) {
+	deleter, ok := s.backend.(db.TreeDeleter)
+	if !ok {
+		return nil, db.ErrNotSupported
+	}
+	return deleter.FindExpiredTrees(ctx, now)
+}
+
+func (s *Storage) InsertTreeInfo(ctx context.Context, info *db.TreeInfo) error {
+	registry, ok := s.backend.(db.TreeRegistry)
+	if !ok {
+		return db.ErrNotSupported
+	}
+	return registry.InsertTreeInfo(ctx, info)
+}
+
+func (s *Storage) UpdateTreeInfo(ctx context.Context, info *db.TreeInfo) error {
+	registry, ok := s.backend.(db.TreeRegistry)
+	if !ok {
+		return db.ErrNotSupported
+	}
+	return registry.UpdateTreeInfo(ctx, info)
+}
+
+func (s *Storage) FindTreeInfo(ctx context.Context, address string) (*db.TreeInfo, error) {
+	registry, ok := s.backend.(db.TreeRegistry)
+	if !ok {
+		return nil, db.ErrNotSupported
+	}
+	return registry.FindTreeInfo(ctx, address)
+}
+
+func (s *Storage) ListTreeInfos(ctx context.Context) ([]*db.TreeInfo, error) {
+	registry, ok := s.backend.(db.TreeRegistry)
+	if !ok {
+		return nil, db.ErrNotSupported
+	}
+	return registry.ListTreeInfos(ctx)
+}
+
+// FindTreeMeta is not cached, the backend answers it in one lookup.
+func (s *Storage) FindTreeMeta(ctx context.Context, address string) (*db.TreeMeta, error) {
+	store, ok := s.backend.(db.MetaStore)
+	if !ok {
+		return nil, db.ErrNotSupported
+	}
+	return store.FindTreeMeta(ctx, address)
+}
+
+func (s *Storage) ListTrees(ctx context.Context) ([]string, error) {
+	store, ok := s.backend.(db.MetaStore)
+	if !ok {
+		return nil, db.ErrNotSupported
+	}
+	return store.ListTrees(ctx)
+}
+
+// tree returns the state of a tree, or nil when it is not kept.
+func (s *Storage) tree(address string) *treeState {
+	elem := s.trees[address]
+	if elem == nil {
+		return nil
+	}
+	s.treeLRU.MoveToFront(elem)
+	return elem.Value.(*treeState)
+}
+
+// state returns the state of a tree, dropping the state of the tree used
+// least recently when one more is kept than MaxTrees.
+func (s *Storage) state(address string) *treeState {
+	if state := s.tree(address); state != nil {
+		return state
+	}
+	state := &treeState{address: address, version: s.dropped, pinned: make(map[db.NodePos]*db.TreeNode)}
+	s.trees[address] = s.treeLRU.PushFront(state)
+	for s.treeLRU.Len() > s.config.MaxTrees {
+		s.dropTree(s.treeLRU.Back())
+	}
+	return state
+}
+
+// dropTree forgets the state of a tree with its pinned nodes.
+func (s *Storage) dropTree(elem *list.Element) {
+	s.treeLRU.Remove(elem)
+	delete(s.trees, elem.Value.(*treeState).address)
+	s.clock++
+	s.dropped = s.clock
+}
+
+// version returns the version of a tree. Trees not kept share the version
+// of the last state dropped.
+func (s *Storage) version(address string) uint64 {
+	if elem := s.trees[address]; elem != nil {
+		return elem.Value.(*treeState).version
+	}
+	return s.dropped
+}
+
+// written records a write to a tree, so reads started before are not cached.
+func (s *Storage) written(address string) {
+	s.clock++
+	s.state(address).version = s.clock
+}
+
+// absent reports whether pos is known not to exist. Trees only grow on the
+// right, so level l holds exactly the positions 0..maxNo>>l up to the root.
+func (st *treeState) absent(pos db.NodePos) bool {
+	if st.root == nil || !st.maxNoKnown {
+		return false
+	}
+	return pos.Level > st.root.Level || pos.LevelNo < 0 || pos.LevelNo > st.maxNo>>pos.Level
+}
+
+// pins reports whether a node belongs to the top levels or the right edge
+// frontier, with its left sibling, of the tree.
+func (s *Storage) pins(st *treeState, pos db.NodePos) bool {
+	if st.root == nil || !st.maxNoKnown {
+		return false
+	}
+	if pos.Level > st.root.Level-s.config.PinnedLevels {
+		return true
+	}
+	return pos.LevelNo >= (st.maxNo>>pos.Level)-1
+}
+
+func (s *Storage) get(key cacheKey) (*db.TreeNode, bool) {
+	if key.data == "" {
+		if state := s.tree(key.address); state != nil {
+			if node := state.pinned[key.pos]; node != nil {
+				return node.Clone(), true
+			}
+		}
+	}
+
+	elem := s.entries[key]
+	if elem == nil {
+		return nil, false
+	}
+	s.lru.MoveToFront(elem)
+	return elem.Value.(*entry).node.Clone(), true
+}
+
+func (s *Storage) put(node *db.TreeNode) {
+	node = node.Clone()
+	pos := db.NodePos{Level: node.Level, LevelNo: node.LevelNo}
+
+	if node.IsLeaf() {
+		s.putLRU(cacheKey{address: node.MtAddress, data: node.Data}, node)
+	}
+
+	if state := s.tree(node.MtAddress); state != nil && s.pins(state, pos) {
+		state.pinned[pos] = node
+		s.removeLRU(cacheKey{address: node.MtAddress, pos: pos})
+		return
+	}
+	s.putLRU(cacheKey{address: node.MtAddress, pos: pos}, node)
+}
+
+// unpinStale moves nodes that left the frontier or the top levels to the LRU.
+func (s *Storage) unpinStale(st *treeState) {
+	for pos, node := range st.pinned {
+		if !s.pins(st, pos) {
+			delete(st.pinned, pos)
+			s.putLRU(cacheKey{address: node.MtAddress, pos: pos}, node)
+		}
+	}
+}
+
+func (s *Storage) putLRU(key cacheKey, node *db.TreeNode) {
+	if elem := s.entries[key]; elem != nil {
+		elem.Value.(*entry).node = node
+		s.lru.MoveToFront(elem)
+		return
+	}
+
+	s.entries[key] = s.lru.PushFront(&entry{key: key, node: node})
+	for s.lru.Len() > s.config.MaxNodes {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*entry).key)
+	}
+}
+
+func (s *Storage) removeLRU(key cacheKey) {
+	if elem := s.entries[key]; elem != nil {
+		s.lru.Remove(elem)
+		delete(s.entries, key)
+	}
+}
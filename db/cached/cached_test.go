@@ -0,0 +1,250 @@
+package cached_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"github.com/UXUYLabs/go-merkletree/db/cached"
+	"github.com/UXUYLabs/go-merkletree/db/memory"
+	"github.com/UXUYLabs/go-merkletree/db/storagetest"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) db.Storage {
+		return cached.NewStorage(memory.NewMemoryStorage(), cached.Config{MaxNodes: 4, PinnedLevels: 1})
+	})
+}
+
+// countingStorage counts the read calls reaching the backend.
+type countingStorage struct {
+	*memory.MemoryStorage
+	reads int64
+}
+
+func (s *countingStorage) FindRootNode(ctx context.Context, address string) (*db.TreeNode, error) {
+	atomic.AddInt64(&s.reads, 1)
+	return s.MemoryStorage.FindRootNode(ctx, address)
+}
+
+func (s *countingStorage) FindMaxNoOfLeaf(ctx context.Context, address string) (int, error) {
+	atomic.AddInt64(&s.reads, 1)
+	return s.MemoryStorage.FindMaxNoOfLeaf(ctx, address)
+}
+
+func (s *countingStorage) FindOneByLeafData(ctx context.Context, address string, data string) (*db.TreeNode, error) {
+	atomic.AddInt64(&s.reads, 1)
+	return s.MemoryStorage.FindOneByLeafData(ctx, address, data)
+}
+
+func (s *countingStorage) FindMultiTreeNode(ctx context.Context, address string, nodePoses []*db.NodePos) ([]*db.TreeNode, error) {
+	atomic.AddInt64(&s.reads, 1)
+	return s.MemoryStorage.FindMultiTreeNode(ctx, address, nodePoses)
+}
+
+func buildTree(t *testing.T, storage db.Storage, n int) *merkletree.MerkleTree {
+	tree, err := merkletree.NewMerkleTree(context.Background(), storage, "1637704523306766336", merkletree.WithLogger(merkletree.DiscardLogger))
+	assert.Nil(t, err)
+	for i := 1; i <= n; i++ {
+		assert.Nil(t, tree.AppendLeaf(fmt.Sprintf("0x%040x", i)))
+	}
+	for i := 1; i <= n; i++ {
+		data := fmt.Sprintf("0x%040x", i)
+		proofes, err := tree.GenerateProof(data)
+		assert.Nil(t, err)
+		proof, err := tree.VerifyProof(proofes, data)
+		assert.Nil(t, err)
+		assert.True(t, proof, data)
+	}
+	return tree
+}
+
+func TestCachedRoundTrips(t *testing.T) {
+	plain := &countingStorage{MemoryStorage: memory.NewMemoryStorage()}
+	plainTree := buildTree(t, plain, 100)
+
+	backend := &countingStorage{MemoryStorage: memory.NewMemoryStorage()}
+	cachedTree := buildTree(t, cached.NewStorage(backend, cached.DefaultConfig), 100)
+
+	plainRoot, err := plainTree.GetRootNode()
+	assert.Nil(t, err)
+	cachedRoot, err := cachedTree.GetRootNode()
+	assert.Nil(t, err)
+	assert.Equal(t, plainRoot, cachedRoot)
+
+	// 绝大多数读请求应由缓存直接返回
+	assert.Less(t, backend.reads*3, plain.reads, "backend reads %d, uncached reads %d", backend.reads, plain.reads)
+}
+
+func TestCachedEviction(t *testing.T) {
+	backend := &countingStorage{MemoryStorage: memory.NewMemoryStorage()}
+	storage := cached.NewStorage(backend, cached.Config{MaxNodes: 8, PinnedLevels: 2})
+	tree := buildTree(t, storage, 300)
+
+	root, err := tree.GetRootNode()
+	assert.Nil(t, err)
+	backendRoot, err := backend.MemoryStorage.FindRootNode(context.Background(), "1637704523306766336")
+	assert.Nil(t, err)
+	assert.Equal(t, backendRoot, root)
+}
+
+func TestCachedInvalidate(t *testing.T) {
+	backend := memory.NewMemoryStorage()
+	storage := cached.NewStorage(backend, cached.DefaultConfig)
+	ctx := context.Background()
+
+	node := &db.TreeNode{MtAddress: "tree", Data: "0x01", Hash: "01"}
+	assert.Nil(t, storage.Insert(ctx, node))
+	root, err := storage.FindRootNode(ctx, "tree")
+	assert.Nil(t, err)
+	assert.Equal(t, "01", root.Hash)
+
+	// 其他写入方直接修改了后端
+	changed := node.Clone()
+	changed.Hash = "02"
+	assert.Nil(t, backend.Update(ctx, changed))
+
+	root, err = storage.FindRootNode(ctx, "tree")
+	assert.Nil(t, err)
+	assert.Equal(t, "01", root.Hash)
+
+	storage.Invalidate("tree")
+	root, err = storage.FindRootNode(ctx, "tree")
+	assert.Nil(t, err)
+	assert.Equal(t, "02", root.Hash)
+}
+
+func TestCachedJournalAndAudit(t *testing.T) {
+	// 后端没有意图日志与审计日志时缓存也不支持
+	storage := cached.NewStorage(struct{ db.Storage }{memory.NewMemoryStorage()}, cached.DefaultConfig)
+	assert.False(t, db.Supports(storage, (*db.IntentJournal)(nil)))
+	assert.False(t, db.Supports(storage, (*db.AuditLog)(nil)))
+	_, err := storage.FindAudit(context.Background(), "1637704523306766336", 1, 10)
+	assert.Equal(t, db.ErrNotSupported, err)
+	manager, err := merkletree.NewMerkleTreeManager(context.Background(), storage, merkletree.WithLogger(merkletree.DiscardLogger))
+	assert.Nil(t, err)
+	_, err = manager.History("1637704523306766336", 1, 10)
+	assert.Equal(t, db.ErrNotSupported, err)
+
+	storage = cached.NewStorage(memory.NewMemoryStorage(), cached.DefaultConfig)
+	manager, err = merkletree.NewMerkleTreeManager(context.Background(), storage, merkletree.WithLogger(merkletree.DiscardLogger))
+	assert.Nil(t, err)
+	tree, err := manager.CreateTree("1637704523306766336")
+	assert.Nil(t, err)
+	assert.Nil(t, tree.AppendLeaves([]string{"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359"}))
+	entries, err := manager.History("1637704523306766336", 1, 10)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+}
+
+// txStorage is a backend with transactions but without batch writes, whose
+// commits fail once failing is set.
+type txStorage struct {
+	db.Storage
+	backend *memory.MemoryStorage
+	begins  int
+	failing bool
+}
+
+func (s *txStorage) Begin(ctx context.Context) (db.Tx, error) {
+	s.begins++
+	return db.NewBufferedTx(s.backend, func(ctx context.Context, nodes []*db.TreeNode) error {
+		if s.failing {
+			return errors.New("connection lost")
+		}
+		return s.backend.WriteNodes(ctx, nodes)
+	}), nil
+}
+
+func TestCachedTx(t *testing.T) {
+	// 后端既无事务也无批量写入时不支持事务
+	plain := cached.NewStorage(struct{ db.Storage }{memory.NewMemoryStorage()}, cached.DefaultConfig)
+	assert.False(t, db.Supports(plain, (*db.TxStorage)(nil)))
+	_, err := plain.Begin(context.Background())
+	assert.Equal(t, db.ErrNotSupported, err)
+
+	backend := memory.NewMemoryStorage()
+	txBackend := &txStorage{Storage: backend, backend: backend}
+	storage := cached.NewStorage(txBackend, cached.DefaultConfig)
+	assert.True(t, db.Supports(storage, (*db.TxStorage)(nil)))
+	assert.False(t, db.Supports(storage, (*db.BatchWriter)(nil)))
+	tree := buildTree(t, storage, 5)
+	assert.Equal(t, 5, txBackend.begins)
+
+	// 后端提交失败后缓存被丢弃，不会留下未写入的节点
+	txBackend.failing = true
+	assert.NotNil(t, tree.AppendLeaf(fmt.Sprintf("0x%040x", 6)))
+	root, err := storage.FindRootNode(context.Background(), "1637704523306766336")
+	assert.Nil(t, err)
+	backendRoot, err := backend.FindRootNode(context.Background(), "1637704523306766336")
+	assert.Nil(t, err)
+	assert.Equal(t, backendRoot, root)
+	maxNo, err := storage.FindMaxNoOfLeaf(context.Background(), "1637704523306766336")
+	assert.Nil(t, err)
+	assert.Equal(t, 4, maxNo)
+}
+
+func TestCachedClose(t *testing.T) {
+	dir := t.TempDir()
+	backend, err := memory.OpenMemoryStorage(dir, memory.PersistOptions{})
+	assert.Nil(t, err)
+	manager, err := merkletree.NewMerkleTreeManager(context.Background(), cached.NewStorage(backend, cached.DefaultConfig), merkletree.WithLogger(merkletree.DiscardLogger))
+	assert.Nil(t, err)
+	tree, err := manager.CreateTree("1637704523306766336")
+	assert.Nil(t, err)
+	assert.Nil(t, tree.AppendLeaves([]string{"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359"}))
+	want, err := tree.GetRootNode()
+	assert.Nil(t, err)
+
+	// 关闭管理器时经缓存关闭后端，写入最后的快照
+	_, err = os.Stat(filepath.Join(dir, "snapshot"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Nil(t, manager.Close())
+	_, err = os.Stat(filepath.Join(dir, "snapshot"))
+	assert.Nil(t, err)
+
+	reopened, err := merkletree.OpenMemoryMerkleTreeManager(context.Background(), dir, memory.PersistOptions{}, merkletree.WithLogger(merkletree.DiscardLogger))
+	assert.Nil(t, err)
+	defer reopened.Close()
+	tree, err = reopened.OpenTree("1637704523306766336")
+	assert.Nil(t, err)
+	root, err := tree.GetRootNode()
+	assert.Nil(t, err)
+	assert.Equal(t, want, root)
+}
+
+func TestCachedMaxTrees(t *testing.T) {
+	backend := &countingStorage{MemoryStorage: memory.NewMemoryStorage()}
+	storage := cached.NewStorage(backend, cached.Config{MaxNodes: 100, PinnedLevels: 2, MaxTrees: 2})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, storage.Insert(ctx, &db.TreeNode{MtAddress: fmt.Sprint("tree", i), Data: "0x01", Hash: "01"}))
+		_, err := storage.FindRootNode(ctx, fmt.Sprint("tree", i))
+		assert.Nil(t, err)
+	}
+
+	// 只保留最近使用的两棵树的状态
+	reads := backend.reads
+	_, err := storage.FindRootNode(ctx, "tree2")
+	assert.Nil(t, err)
+	assert.Equal(t, reads, backend.reads)
+	_, err = storage.FindRootNode(ctx, "tree0")
+	assert.Nil(t, err)
+	assert.Equal(t, reads+1, backend.reads)
+
+	// 删除的树不再保留状态
+	assert.Nil(t, storage.DeleteTree(ctx, "tree0"))
+	_, err = storage.FindRootNode(ctx, "tree0")
+	assert.Equal(t, db.ErrNotFound, err)
+	assert.Nil(t, storage.Insert(ctx, &db.TreeNode{MtAddress: "tree0", Data: "0x02", Hash: "02"}))
+	root, err := storage.FindRootNode(ctx, "tree0")
+	assert.Nil(t, err)
+	assert.Equal(t, "02", root.Hash)
+}
@@ -0,0 +1,112 @@
+package chache
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/UXUYLabs/go-merkletree/db"
+)
+
+// Redis values are tagged by their first byte. Values written before the
+// binary encoding are JSON objects and start with '{'.
+const (
+	// nodeFormatV1 is a tree node: uvarint level, uvarint levelNo, uvarint
+	// hash length, raw hash, then the leaf data up to the end of the value.
+	// The tree address is not stored, it is part of the key.
+	nodeFormatV1 byte = 0x01
+	// leafRefFormatV1 is a leaf index entry: uvarint levelNo of the leaf,
+	// whose node is read from its level 0 key.
+	leafRefFormatV1 byte = 0x02
+
+	legacyFormat byte = '{'
+)
+
+var errBadValue = errors.New("malformed redis value")
+
+// encodeNode returns the value stored at the level key of node. A hash that
+// is not lowercase hex cannot be stored raw, such a node keeps the JSON format.
+func encodeNode(node *db.TreeNode) string {
+	hash, err := hex.DecodeString(node.Hash)
+	if err != nil || hex.EncodeToString(hash) != node.Hash {
+		return node.ToString()
+	}
+
+	buf := make([]byte, 0, 1+3*binary.MaxVarintLen64+len(hash)+len(node.Data))
+	buf = append(buf, nodeFormatV1)
+	buf = binary.AppendUvarint(buf, uint64(node.Level))
+	buf = binary.AppendUvarint(buf, uint64(node.LevelNo))
+	buf = binary.AppendUvarint(buf, uint64(len(hash)))
+	buf = append(buf, hash...)
+	buf = append(buf, node.Data...)
+	return string(buf)
+}
+
+// encodeLeafRef returns the value stored at the leaf index key of a leaf.
+func encodeLeafRef(node *db.TreeNode) string {
+	buf := make([]byte, 0, 1+binary.MaxVarintLen64)
+	buf = append(buf, leafRefFormatV1)
+	buf = binary.AppendUvarint(buf, uint64(node.LevelNo))
+	return string(buf)
+}
+
+// decodeNode reads a node of tree address stored in either format.
+func decodeNode(address string, val string) (*db.TreeNode, error) {
+	if len(val) == 0 {
+		return nil, errBadValue
+	}
+
+	switch val[0] {
+	case legacyFormat:
+		var node db.TreeNode
+		if err := json.Unmarshal([]byte(val), &node); err != nil {
+			return nil, err
+		}
+		return &node, nil
+	case nodeFormatV1:
+		buf := []byte(val[1:])
+		level, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return nil, errBadValue
+		}
+		buf = buf[n:]
+		levelNo, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return nil, errBadValue
+		}
+		buf = buf[n:]
+		hashLen, n := binary.Uvarint(buf)
+		if n <= 0 || uint64(len(buf[n:])) < hashLen {
+			return nil, errBadValue
+		}
+		buf = buf[n:]
+
+		return &db.TreeNode{
+			MtAddress: address,
+			Data:      string(buf[hashLen:]),
+			Hash:      hex.EncodeToString(buf[:hashLen]),
+			Level:     int(level),
+			LevelNo:   int(levelNo),
+		}, nil
+	default:
+		return nil, errBadValue
+	}
+}
+
+// decodeLeafRef returns the levelNo referenced by a leaf index entry, or the
+// whole node for a legacy entry.
+func decodeLeafRef(address string, val string) (int, *db.TreeNode, error) {
+	if len(val) > 0 && val[0] == leafRefFormatV1 {
+		levelNo, n := binary.Uvarint([]byte(val[1:]))
+		if n <= 0 {
+			return 0, nil, errBadValue
+		}
+		return int(levelNo), nil, nil
+	}
+
+	node, err := decodeNode(address, val)
+	if err != nil {
+		return 0, nil, err
+	}
+	return node.LevelNo, node, nil
+}
@@ -0,0 +1,162 @@
+package chache
+
+import (
+	"context"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+const (
+	RedisTreeScan string = "merkletree:tree:*"
+
+	// RedisConvertBatch is the number of keys scanned per round trip by ConvertLegacyNodes.
+	RedisConvertBatch int64 = 1000
+)
+
+// convertScript replaces a value only if it has not changed since it was read.
+var convertScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// backfillMetaScript records the metadata computed for a tree written before
+// metadata existed, unless the tree changed since it was computed: an append
+// always writes the next leaf, an update of the root changes its value.
+var backfillMetaScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 or redis.call('EXISTS', KEYS[3]) == 1 then
+	return 0
+end
+if redis.call('GET', KEYS[2]) ~= ARGV[1] then
+	return 0
+end
+redis.call('HSET', KEYS[1], 'leafCount', ARGV[2], 'depth', ARGV[3], 'rootLevel', ARGV[4],
+	'rootLevelNo', ARGV[5], 'rootHash', ARGV[6], 'updatedAt', ARGV[7])
+return 1
+`)
+
+// ConvertLegacyNodes rewrites the nodes and leaf index entries still stored
+// as JSON in the binary encoding, and returns the number of values rewritten.
+// It also records the metadata of trees written before it was maintained.
+// Both formats are readable, so it can run in the background while trees are
+// in use: a value written concurrently is left alone. It stops when ctx is
+// done and can simply be run again.
+func (s *RedisStorage) ConvertLegacyNodes(ctx context.Context) (int, error) {
+	converted := 0
+	trees := make(map[string]bool)
+	var cursor uint64
+	for {
+		keys, next, err := s.redisClient.Scan(ctx, cursor, RedisTreeScan, RedisConvertBatch).Result()
+		if err != nil {
+			fmt.Printf("ConvertLegacyNodes Scan err. err:%+v\n", err)
+			return converted, err
+		}
+
+		for _, key := range keys {
+			if address, _, _, err := getInfoFromRedisKey(key); err == nil {
+				trees[address] = true
+			}
+		}
+
+		if len(keys) > 0 {
+			n, err := s.convertKeys(ctx, keys)
+			converted += n
+			if err != nil {
+				fmt.Printf("ConvertLegacyNodes convertKeys err. err:%+v\n", err)
+				return converted, err
+			}
+		}
+
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+
+	for address := range trees {
+		if err := s.backfillMeta(ctx, address); err != nil {
+			fmt.Printf("ConvertLegacyNodes backfillMeta err. err:%+v\n", err)
+			return converted, err
+		}
+	}
+
+	return converted, nil
+}
+
+func (s *RedisStorage) backfillMeta(ctx context.Context, address string) error {
+	exists, err := s.redisClient.Exists(ctx, getRedisMetaKey(address)).Result()
+	if err != nil || exists == 1 {
+		return err
+	}
+
+	meta, val, err := s.scanMeta(ctx, address)
+	if err == db.ErrNotFound {
+		// 树在扫描后被删除
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	keys := []string{
+		getRedisMetaKey(address),
+		getRedisTreeKey(address, meta.RootLevel, meta.RootLevelNo),
+		getRedisTreeKey(address, 0, meta.LeafCount),
+	}
+	return backfillMetaScript.Run(ctx, s.redisClient, keys, val,
+		meta.LeafCount, meta.Depth, meta.RootLevel, meta.RootLevelNo, meta.RootHash, time.Now().UnixMilli()).Err()
+}
+
+func (s *RedisStorage) convertKeys(ctx context.Context, keys []string) (int, error) {
+	vals, err := s.redisClient.MGet(ctx, keys...).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	var cmds []*redis.Cmd
+	_, err = s.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			val, ok := vals[i].(string)
+			if !ok || len(val) == 0 || val[0] != legacyFormat {
+				continue
+			}
+
+			node, err := decodeNode("", val)
+			if err != nil {
+				// 不是节点的JSON值，保持原样
+				continue
+			}
+
+			var encoded string
+			switch key {
+			case getRedisTreeKey(node.MtAddress, node.Level, node.LevelNo):
+				encoded = encodeNode(node)
+			case getRedisNodeKey(node.MtAddress, node.Data):
+				encoded = encodeLeafRef(node)
+			default:
+				continue
+			}
+			if encoded == val {
+				continue
+			}
+
+			cmds = append(cmds, convertScript.Eval(ctx, pipe, []string{key}, val, encoded))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	converted := 0
+	for _, cmd := range cmds {
+		if n, _ := cmd.Int(); n == 1 {
+			converted++
+		}
+	}
+	return converted, nil
+}
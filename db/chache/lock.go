@@ -0,0 +1,188 @@
+package chache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+const (
+	RedisLock      string = "merkletree:lock:%s"
+	RedisLockFence string = "merkletree:lock:%s:fence"
+)
+
+// acquireScript takes the lock and hands out the next fencing token in one step,
+// so a token can never be issued to a holder whose lock already expired.
+var acquireScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+return 0
+`)
+
+var renewScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisLocker is a db.Locker based on SET NX with a TTL. Leases are renewed in
+// the background every ttl/3 and reported lost once renewal is impossible.
+type RedisLocker struct {
+	redisClient   *redis.Client
+	ttl           time.Duration
+	retryInterval time.Duration
+}
+
+func NewRedisLocker(redisClient *redis.Client, ttl time.Duration) *RedisLocker {
+	return &RedisLocker{
+		redisClient:   redisClient,
+		ttl:           ttl,
+		retryInterval: ttl / 10,
+	}
+}
+
+func (l *RedisLocker) Acquire(ctx context.Context, key string) (db.Lease, error) {
+	owner, err := newOwnerID()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		token, err := acquireScript.Run(ctx, l.redisClient,
+			[]string{getRedisLockKey(key), getRedisLockFenceKey(key)},
+			owner, l.ttl.Milliseconds()).Int64()
+		if err != nil {
+			fmt.Printf("Acquire acquireScript err. err:%+v\n", err)
+			return nil, err
+		}
+
+		if token > 0 {
+			lease := &redisLease{
+				locker:   l,
+				key:      key,
+				owner:    owner,
+				token:    token,
+				deadline: time.Now().Add(l.ttl),
+				done:     make(chan struct{}),
+				stop:     make(chan struct{}),
+			}
+			go lease.renew()
+			return lease, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(l.retryInterval):
+		}
+	}
+}
+
+type redisLease struct {
+	locker   *RedisLocker
+	key      string
+	owner    string
+	token    int64
+	deadline time.Time
+
+	once sync.Once
+	mu   sync.Mutex
+	err  error
+	done chan struct{}
+	stop chan struct{}
+}
+
+func (le *redisLease) Token() int64 {
+	return le.token
+}
+
+func (le *redisLease) Done() <-chan struct{} {
+	return le.done
+}
+
+func (le *redisLease) Err() error {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	return le.err
+}
+
+func (le *redisLease) Release(ctx context.Context) error {
+	le.finish(nil)
+
+	err := releaseScript.Run(ctx, le.locker.redisClient, []string{getRedisLockKey(le.key)}, le.owner).Err()
+	if err != nil {
+		fmt.Printf("Release releaseScript err. err:%+v\n", err)
+		return err
+	}
+	return nil
+}
+
+func (le *redisLease) finish(err error) {
+	le.once.Do(func() {
+		le.mu.Lock()
+		le.err = err
+		le.mu.Unlock()
+		close(le.stop)
+		close(le.done)
+	})
+}
+
+// renew extends the lease until it is released. A failed renewal is retried
+// while the current lease is still known to be valid, after that it is lost.
+func (le *redisLease) renew() {
+	interval := le.locker.ttl / 3
+	for {
+		select {
+		case <-le.stop:
+			return
+		case <-time.After(interval):
+		}
+
+		ctx, cancel := context.WithDeadline(context.Background(), le.deadline)
+		start := time.Now()
+		renewed, err := renewScript.Run(ctx, le.locker.redisClient,
+			[]string{getRedisLockKey(le.key)}, le.owner, le.locker.ttl.Milliseconds()).Int64()
+		cancel()
+
+		switch {
+		case err == nil && renewed == 1:
+			le.deadline = start.Add(le.locker.ttl)
+		case err == nil || time.Now().After(le.deadline):
+			// 锁已被他人持有或已过期
+			le.finish(db.ErrLockLost)
+			return
+		default:
+			fmt.Printf("renew renewScript err. err:%+v\n", err)
+		}
+	}
+}
+
+func newOwnerID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func getRedisLockKey(key string) string {
+	return fmt.Sprintf(RedisLock, key)
+}
+
+func getRedisLockFenceKey(key string) string {
+	return fmt.Sprintf(RedisLockFence, key)
+}
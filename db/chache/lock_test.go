@@ -0,0 +1,85 @@
+package chache
+
+import (
+	"context"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	mr := miniredis.RunT(t)
+	return mr, redis.NewClient(&redis.Options{Addr: mr.Addr()})
+}
+
+func TestRedisLockerExclusive(t *testing.T) {
+	_, client := newTestClient(t)
+	locker := NewRedisLocker(client, time.Second)
+
+	first, err := locker.Acquire(context.Background(), "tree")
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	_, err = locker.Acquire(ctx, "tree")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	assert.Nil(t, first.Release(context.Background()))
+	<-first.Done()
+	assert.Nil(t, first.Err())
+
+	second, err := locker.Acquire(context.Background(), "tree")
+	assert.Nil(t, err)
+	assert.Greater(t, second.Token(), first.Token())
+	assert.Nil(t, second.Release(context.Background()))
+}
+
+func TestRedisLockerLeaseLost(t *testing.T) {
+	mr, client := newTestClient(t)
+	locker := NewRedisLocker(client, 300*time.Millisecond)
+
+	lease, err := locker.Acquire(context.Background(), "tree")
+	assert.Nil(t, err)
+
+	// 模拟锁过期后被其他实例抢占
+	mr.Del(getRedisLockKey("tree"))
+	assert.Nil(t, mr.Set(getRedisLockKey("tree"), "other"))
+
+	select {
+	case <-lease.Done():
+	case <-time.After(time.Second):
+		t.Fatal("lease not reported lost")
+	}
+	assert.Equal(t, db.ErrLockLost, lease.Err())
+
+	// 释放不能删除他人的锁
+	assert.Nil(t, lease.Release(context.Background()))
+	val, err := mr.Get(getRedisLockKey("tree"))
+	assert.Nil(t, err)
+	assert.Equal(t, "other", val)
+}
+
+func TestRedisFencedCommit(t *testing.T) {
+	_, client := newTestClient(t)
+	storage := NewRedisStorageWithClient(client)
+	node := &db.TreeNode{MtAddress: "tree", Data: "0x01", Hash: "01", Level: 0, LevelNo: 0}
+
+	tx, err := storage.Begin(db.WithFencingToken(context.Background(), 2))
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Insert(context.Background(), node))
+	assert.Nil(t, tx.Commit(db.WithFencingToken(context.Background(), 2)))
+
+	stale := node.Clone()
+	stale.Hash = "02"
+	tx, err = storage.Begin(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Update(context.Background(), stale))
+	assert.Equal(t, db.ErrFenced, tx.Commit(db.WithFencingToken(context.Background(), 1)))
+
+	found, err := storage.FindOneByLeafData(context.Background(), "tree", "0x01")
+	assert.Nil(t, err)
+	assert.Equal(t, "01", found.Hash)
+}
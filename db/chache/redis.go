@@ -8,17 +8,130 @@ import (
 	"github.com/UXUYLabs/go-merkletree/db"
 	"github.com/redis/go-redis/v9"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const (
 	RedisTreeKeys string = "merkletree:tree:%s:level:%d:*"
 	RedisTree     string = "merkletree:tree:%s:level:%d:no:%d"
 	RedisTreeNode string = "merkletree:tree:%s:node:%s"
+	RedisFence    string = "merkletree:tree:%s:fence"
+	RedisTreeMeta string = "merkletree:tree:%s:meta"
+	RedisIntent   string = "merkletree:tree:%s:intent"
+	// RedisAudit is kept outside the keys of the tree so it outlives DeleteTree
+	RedisAudit string = "merkletree:audit:%s"
+
+	RedisTreeLevelScan string = "merkletree:tree:%s:level:*"
+	RedisTreeNodeScan  string = "merkletree:tree:%s:node:*"
+	// RedisFirstLeafScan matches the first leaf of every tree, which any tree holding nodes has
+	RedisFirstLeafScan string = "merkletree:tree:*:level:0:no:0"
+	RedisGCExpiry      string = "merkletree:gc:expiry"
+	RedisGCDeleting    string = "merkletree:gc:deleting"
+	RedisRegistry      string = "merkletree:registry"
+
+	// RedisDeleteBatch is the number of keys scanned and unlinked per round trip by DeleteTree.
+	RedisDeleteBatch int64 = 1000
 
 	RedisInfoRegex string = "^merkletree:tree:(.*?):level:(.*?):no:(.*?)$"
 )
 
+// updateTreeInfoScript replaces the registry record of a tree only if the
+// tree is already registered, returning 0 otherwise.
+var updateTreeInfoScript = redis.NewScript(`
+if redis.call('HEXISTS', KEYS[1], ARGV[1]) == 1 then
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// writeNodesScript stores nodes of one tree and maintains its metadata.
+//
+//	KEYS: fence, meta, leaf 0, then per node its level key, followed by its
+//	      leaf index key for a leaf
+//	ARGV: fencing token or '', now in ms, 'xx' to only replace an existing
+//	      node, node count, then per node value, leaf index value or '',
+//	      level, levelNo, hash
+//
+// A tree written before metadata existed has nodes but no meta key, its
+// metadata is left to ConvertLegacyNodes.
+var writeNodesScript = redis.NewScript(`
+if ARGV[1] ~= '' then
+	local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+	if tonumber(ARGV[1]) < current then
+		return redis.error_reply('FENCED')
+	end
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+if ARGV[3] == 'xx' and redis.call('EXISTS', KEYS[4]) == 0 then
+	return 0
+end
+
+local track = redis.call('EXISTS', KEYS[2]) == 1 or redis.call('EXISTS', KEYS[3]) == 0
+local leafCount = tonumber(redis.call('HGET', KEYS[2], 'leafCount') or '0')
+local rootLevel = tonumber(redis.call('HGET', KEYS[2], 'rootLevel') or '-1')
+local rootLevelNo = tonumber(redis.call('HGET', KEYS[2], 'rootLevelNo') or '-1')
+local rootHash = redis.call('HGET', KEYS[2], 'rootHash') or ''
+
+local k = 4
+for i = 0, tonumber(ARGV[4]) - 1 do
+	local a = 5 + i * 5
+	redis.call('SET', KEYS[k], ARGV[a])
+	k = k + 1
+	if ARGV[a + 1] ~= '' then
+		redis.call('SET', KEYS[k], ARGV[a + 1])
+		k = k + 1
+	end
+
+	local level = tonumber(ARGV[a + 2])
+	local levelNo = tonumber(ARGV[a + 3])
+	if level == 0 and levelNo + 1 > leafCount then
+		leafCount = levelNo + 1
+	end
+	if level > rootLevel or (level == rootLevel and levelNo >= rootLevelNo) then
+		rootLevel, rootLevelNo, rootHash = level, levelNo, ARGV[a + 4]
+	end
+end
+
+if track then
+	redis.call('HSET', KEYS[2], 'leafCount', leafCount, 'depth', rootLevel + 1, 'rootLevel', rootLevel,
+		'rootLevelNo', rootLevelNo, 'rootHash', rootHash, 'updatedAt', ARGV[2])
+end
+return 1
+`)
+
+// removeNodesScript deletes nodes of one tree, and the leaf index entries
+// still referring to them, then drops the metadata of the tree for
+// RemoveNodes to recompute.
+//
+//	KEYS: fence, meta, the level key of every node, then leaf index keys
+//	ARGV: fencing token or '', number of level keys, then per leaf index key
+//	      the value referring to the removed leaf
+var removeNodesScript = redis.NewScript(`
+if ARGV[1] ~= '' then
+	local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+	if tonumber(ARGV[1]) < current then
+		return redis.error_reply('FENCED')
+	end
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+
+local n = tonumber(ARGV[2])
+for i = 3, 2 + n do
+	redis.call('DEL', KEYS[i])
+end
+for i = 3 + n, #KEYS do
+	if redis.call('GET', KEYS[i]) == ARGV[i - n] then
+		redis.call('DEL', KEYS[i])
+	end
+end
+redis.call('DEL', KEYS[2])
+return 1
+`)
+
 type RedisStorage struct {
 	db.Storage
 	redisClient *redis.Client
@@ -31,21 +144,93 @@ func NewRedisStorage() *RedisStorage {
 		DB:       0,  // use default DB
 	})
 
+	return NewRedisStorageWithClient(redisClient)
+}
+
+func NewRedisStorageWithClient(redisClient *redis.Client) *RedisStorage {
 	return &RedisStorage{
 		redisClient: redisClient,
 	}
 }
 
-func (s *RedisStorage) Insert(ctx context.Context, node *db.TreeNode) error {
-	err := s.redisClient.Set(ctx, getRedisNodeKey(node.MtAddress, node.Data), node.ToString(), 0).Err()
+// Begin opens a transaction whose writes are sent in one MULTI/EXEC block on Commit.
+func (s *RedisStorage) Begin(ctx context.Context) (db.Tx, error) {
+	return db.NewBufferedTx(s, s.WriteNodes), nil
+}
+
+// WriteNodes stores nodes atomically, guarded by the fencing token ctx
+// carries if any. Fenced writes must all belong to one tree.
+func (s *RedisStorage) WriteNodes(ctx context.Context, nodes []*db.TreeNode) error {
+	token, fenced := db.FencingToken(ctx)
+
+	// 按树分组，每棵树的节点与元数据由一个脚本写入
+	var groups [][]*db.TreeNode
+	index := make(map[string]int)
+	for _, node := range nodes {
+		i, ok := index[node.MtAddress]
+		if !ok {
+			if fenced && len(groups) > 0 {
+				return errors.New("fenced commit spans several trees")
+			}
+			i = len(groups)
+			index[node.MtAddress] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], node)
+	}
+
+	var err error
+	if len(groups) == 1 {
+		keys, args := writeNodesArgs(token, fenced, false, groups[0])
+		err = writeNodesScript.Run(ctx, s.redisClient, keys, args...).Err()
+	} else {
+		_, err = s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, group := range groups {
+				keys, args := writeNodesArgs(token, fenced, false, group)
+				writeNodesScript.Eval(ctx, pipe, keys, args...)
+			}
+			return nil
+		})
+	}
 	if err != nil {
-		fmt.Printf("Insert Set RedisNode err. err:%+v\n", err)
+		if strings.Contains(err.Error(), "FENCED") {
+			return db.ErrFenced
+		}
+		fmt.Printf("WriteNodes writeNodesScript err. err:%+v\n", err)
 		return err
 	}
 
-	err = s.redisClient.Set(ctx, getRedisTreeKey(node.MtAddress, node.Level, node.LevelNo), node.ToString(), 0).Err()
+	return nil
+}
+
+func writeNodesArgs(token int64, fenced bool, xx bool, nodes []*db.TreeNode) ([]string, []interface{}) {
+	address := nodes[0].MtAddress
+	keys := []string{getRedisFenceKey(address), getRedisMetaKey(address), getRedisTreeKey(address, 0, 0)}
+	args := []interface{}{"", time.Now().UnixMilli(), "", len(nodes)}
+	if fenced {
+		args[0] = token
+	}
+	if xx {
+		args[2] = "xx"
+	}
+
+	for _, node := range nodes {
+		keys = append(keys, getRedisTreeKey(address, node.Level, node.LevelNo))
+		leafRef := ""
+		if node.IsLeaf() {
+			keys = append(keys, getRedisNodeKey(address, node.Data))
+			leafRef = encodeLeafRef(node)
+		}
+		args = append(args, encodeNode(node), leafRef, node.Level, node.LevelNo, node.Hash)
+	}
+	return keys, args
+}
+
+func (s *RedisStorage) Insert(ctx context.Context, node *db.TreeNode) error {
+	keys, args := writeNodesArgs(0, false, false, []*db.TreeNode{node})
+	err := writeNodesScript.Run(ctx, s.redisClient, keys, args...).Err()
 	if err != nil {
-		fmt.Printf("Insert Set RedisNode err. err:%+v\n", err)
+		fmt.Printf("Insert writeNodesScript err. err:%+v\n", err)
 		return err
 	}
 
@@ -53,34 +238,116 @@ func (s *RedisStorage) Insert(ctx context.Context, node *db.TreeNode) error {
 }
 
 func (s *RedisStorage) Update(ctx context.Context, node *db.TreeNode) error {
-	err := s.redisClient.Set(ctx, getRedisNodeKey(node.MtAddress, node.Data), node.ToString(), 0).Err()
+	keys, args := writeNodesArgs(0, false, true, []*db.TreeNode{node})
+	written, err := writeNodesScript.Run(ctx, s.redisClient, keys, args...).Int()
 	if err != nil {
-		fmt.Printf("Insert Set RedisNode err. err:%+v\n", err)
+		fmt.Printf("Update writeNodesScript err. err:%+v\n", err)
 		return err
 	}
 
-	err = s.redisClient.Set(ctx, getRedisTreeKey(node.MtAddress, node.Level, node.LevelNo), node.ToString(), 0).Err()
-	if err != nil {
-		fmt.Printf("Insert Set RedisNode err. err:%+v\n", err)
-		return err
+	if written == 0 {
+		return db.ErrNotFound
 	}
 
 	return nil
 }
 
+// RemoveNodes deletes nodes of a tree, guarded by the fencing token ctx
+// carries if any, then recomputes its metadata. Until it has, the tree is
+// read as one written before metadata existed.
+func (s *RedisStorage) RemoveNodes(ctx context.Context, address string, poses []*db.NodePos) error {
+	token, fenced := db.FencingToken(ctx)
+	keys := []string{getRedisFenceKey(address), getRedisMetaKey(address)}
+	args := []interface{}{"", len(poses)}
+	if fenced {
+		args[0] = token
+	}
+
+	var indexKeys []string
+	for _, pos := range poses {
+		key := getRedisTreeKey(address, pos.Level, pos.LevelNo)
+		keys = append(keys, key)
+		if pos.Level != 0 {
+			continue
+		}
+
+		// 叶子索引仍指向被删除的叶子时才删除
+		val, err := s.redisClient.Get(ctx, key).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			fmt.Printf("RemoveNodes Get err. err:%+v\n", err)
+			return err
+		}
+		node, err := decodeNode(address, val)
+		if err != nil {
+			fmt.Printf("RemoveNodes decodeNode err. err:%+v\n", err)
+			return err
+		}
+		if node.IsLeaf() {
+			indexKeys = append(indexKeys, getRedisNodeKey(address, node.Data))
+			args = append(args, encodeLeafRef(node))
+		}
+	}
+	keys = append(keys, indexKeys...)
+
+	if err := removeNodesScript.Run(ctx, s.redisClient, keys, args...).Err(); err != nil {
+		if strings.Contains(err.Error(), "FENCED") {
+			return db.ErrFenced
+		}
+		fmt.Printf("RemoveNodes removeNodesScript err. err:%+v\n", err)
+		return err
+	}
+
+	return s.backfillMeta(ctx, address)
+}
+
 func (s *RedisStorage) FindRootNode(ctx context.Context, address string) (*db.TreeNode, error) {
+	meta, err := s.findMeta(ctx, address)
+	if err == db.ErrNotFound {
+		// 旧版本写入的树没有元数据
+		node, _, err := s.scanRootNode(ctx, address)
+		return node, err
+	}
+	if err != nil {
+		fmt.Printf("FindRootNode findMeta err. err:%+v\n", err)
+		return nil, err
+	}
+
+	val, err := s.redisClient.Get(ctx, getRedisTreeKey(address, meta.RootLevel, meta.RootLevelNo)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, db.ErrNotFound
+		}
+		fmt.Printf("FindRootNode Get err. err:%+v\n", err)
+		return nil, err
+	}
+
+	node, err := decodeNode(address, val)
+	if err != nil {
+		fmt.Printf("FindRootNode decodeNode err. err:%+v\n", err)
+		return nil, err
+	}
+
+	return node, nil
+}
+
+// scanRootNode finds the root of a tree by listing its levels, and returns
+// it with its raw value.
+func (s *RedisStorage) scanRootNode(ctx context.Context, address string) (*db.TreeNode, string, error) {
 	level := 0
 	keys, err := s.redisClient.Keys(ctx, getRedisTreeKeysKey(address, level)).Result()
 	if err != nil {
 		if err == redis.Nil {
-			return nil, db.ErrNotFound
+			return nil, "", db.ErrNotFound
 		}
 		fmt.Printf("FindRootNode get Keys err. err:%+v\n", err)
-		return nil, err
+		return nil, "", err
 	}
 
 	if keys == nil || len(keys) == 0 {
-		return nil, db.ErrNotFound
+		return nil, "", db.ErrNotFound
 	}
 
 	rootKeys := keys
@@ -89,7 +356,7 @@ func (s *RedisStorage) FindRootNode(ctx context.Context, address string) (*db.Tr
 		keys, err = s.redisClient.Keys(ctx, getRedisTreeKeysKey(address, level)).Result()
 		if err != nil && err != redis.Nil {
 			fmt.Printf("FindRootNode get Keys err. err:%+v\n", err)
-			return nil, err
+			return nil, "", err
 		}
 
 		if err == redis.Nil || len(keys) == 0 {
@@ -98,28 +365,53 @@ func (s *RedisStorage) FindRootNode(ctx context.Context, address string) (*db.Tr
 		rootKeys = keys
 	}
 
-	_, level, levelNo, err := getInfoFromRedisKey(rootKeys[0])
-	if err != nil {
-		fmt.Printf("FindRootNode getInfoFromRedisKey err. err:%+v\n", err)
-		return nil, err
+	// 最高层中序号最大的节点为根节点
+	level, levelNo := 0, -1
+	for _, key := range rootKeys {
+		_, keyLevel, keyLevelNo, err := getInfoFromRedisKey(key)
+		if err != nil {
+			fmt.Printf("FindRootNode getInfoFromRedisKey err. err:%+v\n", err)
+			return nil, "", err
+		}
+
+		if keyLevelNo > levelNo {
+			level, levelNo = keyLevel, keyLevelNo
+		}
 	}
 
 	val, err := s.redisClient.Get(ctx, getRedisTreeKey(address, level, levelNo)).Result()
 	if err != nil {
 		fmt.Printf("FindRootNode Get err. err:%+v\n", err)
-		return nil, err
+		return nil, "", err
 	}
 
-	var node db.TreeNode
-	if err = json.Unmarshal([]byte(val), &node); err != nil {
-		fmt.Printf("FindRootNode Unmarshal err. err:%+v\n", err)
-		return nil, err
+	node, err := decodeNode(address, val)
+	if err != nil {
+		fmt.Printf("FindRootNode decodeNode err. err:%+v\n", err)
+		return nil, "", err
 	}
 
-	return &node, nil
+	return node, val, nil
 }
 
 func (s *RedisStorage) FindMaxNoOfLeaf(ctx context.Context, address string) (int, error) {
+	meta, err := s.findMeta(ctx, address)
+	if err == db.ErrNotFound {
+		return s.scanMaxNoOfLeaf(ctx, address)
+	}
+	if err != nil {
+		fmt.Printf("FindMaxNoOfLeaf findMeta err. err:%+v\n", err)
+		return -1, err
+	}
+
+	if meta.LeafCount == 0 {
+		return -1, db.ErrNotFound
+	}
+	return meta.LeafCount - 1, nil
+}
+
+// scanMaxNoOfLeaf finds the last leaf of a tree by listing its level 0.
+func (s *RedisStorage) scanMaxNoOfLeaf(ctx context.Context, address string) (int, error) {
 	keys, err := s.redisClient.Keys(ctx, getRedisTreeKeysKey(address, 0)).Result()
 	if err != nil {
 		if err == redis.Nil {
@@ -160,13 +452,32 @@ func (s *RedisStorage) FindOneByLeafData(ctx context.Context, address string, da
 		return nil, err
 	}
 
-	var node db.TreeNode
-	if err = json.Unmarshal([]byte(val), &node); err != nil {
-		fmt.Printf("FindOneByLeafData Unmarshal err. err:%+v\n", err)
+	levelNo, node, err := decodeLeafRef(address, val)
+	if err != nil {
+		fmt.Printf("FindOneByLeafData decodeLeafRef err. err:%+v\n", err)
+		return nil, err
+	}
+	if node != nil {
+		return node, nil
+	}
+
+	// 索引只记录叶子的序号，节点本身从第0层读取
+	val, err = s.redisClient.Get(ctx, getRedisTreeKey(address, 0, levelNo)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, db.ErrNotFound
+		}
+		fmt.Printf("FindOneByLeafData Get node err. err:%+v\n", err)
+		return nil, err
+	}
+
+	node, err = decodeNode(address, val)
+	if err != nil {
+		fmt.Printf("FindOneByLeafData decodeNode err. err:%+v\n", err)
 		return nil, err
 	}
 
-	return &node, nil
+	return node, nil
 }
 
 func (s *RedisStorage) FindMultiTreeNode(ctx context.Context, address string, nodePoses []*db.NodePos) ([]*db.TreeNode, error) {
@@ -186,12 +497,12 @@ func (s *RedisStorage) FindMultiTreeNode(ctx context.Context, address string, no
 			return nil, err
 		}
 
-		var node db.TreeNode
-		if err = json.Unmarshal([]byte(val), &node); err != nil {
-			fmt.Printf("FindMultiTreeNode Unmarshal err. err:%+v\n", err)
+		node, err := decodeNode(address, val)
+		if err != nil {
+			fmt.Printf("FindMultiTreeNode decodeNode err. err:%+v\n", err)
 			return nil, err
 		}
-		retTreeNodes = append(retTreeNodes, &node)
+		retTreeNodes = append(retTreeNodes, node)
 	}
 
 	if retTreeNodes == nil || len(retTreeNodes) == 0 {
@@ -228,22 +539,456 @@ func (s *RedisStorage) FindNodesByLevel(ctx context.Context, address string, lev
 			return nil, err
 		}
 
-		var node db.TreeNode
-		if err = json.Unmarshal([]byte(val), &node); err != nil {
-			fmt.Printf("FindNodesByLevel Unmarshal err. err:%+v\n", err)
+		node, err := decodeNode(address, val)
+		if err != nil {
+			fmt.Printf("FindNodesByLevel decodeNode err. err:%+v\n", err)
 			return nil, err
 		}
 
-		retsz = append(retsz, &node)
+		retsz = append(retsz, node)
 	}
+	sort.Slice(retsz, func(i, j int) bool { return retsz[i].LevelNo < retsz[j].LevelNo })
 
 	return retsz, nil
 }
 
+// FindTreeMeta returns the metadata of a tree, computed from its nodes for a
+// tree written before metadata existed.
+func (s *RedisStorage) FindTreeMeta(ctx context.Context, address string) (*db.TreeMeta, error) {
+	meta, err := s.findMeta(ctx, address)
+	if err == nil {
+		return meta, nil
+	}
+	if err != db.ErrNotFound {
+		fmt.Printf("FindTreeMeta findMeta err. err:%+v\n", err)
+		return nil, err
+	}
+
+	meta, _, err = s.scanMeta(ctx, address)
+	return meta, err
+}
+
+// ListTrees returns the address of every tree holding nodes, sorted, found
+// by scanning for the first leaf of each tree.
+func (s *RedisStorage) ListTrees(ctx context.Context) ([]string, error) {
+	// SCAN可能重复返回同一键
+	trees := make(map[string]bool)
+	var cursor uint64
+	for {
+		keys, next, err := s.redisClient.Scan(ctx, cursor, RedisFirstLeafScan, RedisDeleteBatch).Result()
+		if err != nil {
+			fmt.Printf("ListTrees Scan err. err:%+v\n", err)
+			return nil, err
+		}
+
+		for _, key := range keys {
+			if address, _, _, err := getInfoFromRedisKey(key); err == nil {
+				trees[address] = true
+			}
+		}
+
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+
+	var retsz []string
+	for address := range trees {
+		retsz = append(retsz, address)
+	}
+	sort.Strings(retsz)
+
+	return retsz, nil
+}
+
+func (s *RedisStorage) findMeta(ctx context.Context, address string) (*db.TreeMeta, error) {
+	fields, err := s.redisClient.HGetAll(ctx, getRedisMetaKey(address)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, db.ErrNotFound
+	}
+
+	meta := &db.TreeMeta{MtAddress: address, RootHash: fields["rootHash"]}
+	for name, field := range map[string]*int{
+		"leafCount":   &meta.LeafCount,
+		"depth":       &meta.Depth,
+		"rootLevel":   &meta.RootLevel,
+		"rootLevelNo": &meta.RootLevelNo,
+	} {
+		if *field, err = strconv.Atoi(fields[name]); err != nil {
+			return nil, fmt.Errorf("tree meta %s: %w", name, err)
+		}
+	}
+	updatedAt, err := strconv.ParseInt(fields["updatedAt"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("tree meta updatedAt: %w", err)
+	}
+	meta.UpdatedAt = time.UnixMilli(updatedAt)
+
+	return meta, nil
+}
+
+// scanMeta computes the metadata of a tree from its nodes, and returns it
+// with the raw value of the root.
+func (s *RedisStorage) scanMeta(ctx context.Context, address string) (*db.TreeMeta, string, error) {
+	root, val, err := s.scanRootNode(ctx, address)
+	if err != nil {
+		return nil, "", err
+	}
+
+	meta := &db.TreeMeta{
+		MtAddress:   address,
+		Depth:       root.Level + 1,
+		RootLevel:   root.Level,
+		RootLevelNo: root.LevelNo,
+		RootHash:    root.Hash,
+	}
+	maxNo, err := s.scanMaxNoOfLeaf(ctx, address)
+	if err != nil && err != db.ErrNotFound {
+		return nil, "", err
+	}
+	meta.LeafCount = maxNo + 1
+
+	return meta, val, nil
+}
+
+// DeleteTree unlinks the keys of a tree in batches. The tree is registered as
+// being deleted first, so an interrupted deletion is reported by
+// FindExpiredTrees until a later call completes it.
+func (s *RedisStorage) DeleteTree(ctx context.Context, address string) error {
+	err := s.redisClient.SAdd(ctx, RedisGCDeleting, address).Err()
+	if err != nil {
+		fmt.Printf("DeleteTree SAdd err. err:%+v\n", err)
+		return err
+	}
+
+	for _, pattern := range []string{RedisTreeLevelScan, RedisTreeNodeScan} {
+		if err = s.unlinkKeys(ctx, fmt.Sprintf(pattern, escapeRedisPattern(address))); err != nil {
+			fmt.Printf("DeleteTree unlinkKeys err. err:%+v\n", err)
+			return err
+		}
+	}
+
+	_, err = s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Unlink(ctx, getRedisFenceKey(address), getRedisMetaKey(address), getRedisIntentKey(address))
+		pipe.ZRem(ctx, RedisGCExpiry, address)
+		pipe.HDel(ctx, RedisRegistry, address)
+		pipe.SRem(ctx, RedisGCDeleting, address)
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("DeleteTree TxPipelined err. err:%+v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *RedisStorage) unlinkKeys(ctx context.Context, pattern string) error {
+	var cursor uint64
+	for {
+		keys, next, err := s.redisClient.Scan(ctx, cursor, pattern, RedisDeleteBatch).Result()
+		if err != nil {
+			return err
+		}
+
+		if len(keys) > 0 {
+			if err = s.redisClient.Unlink(ctx, keys...).Err(); err != nil {
+				return err
+			}
+		}
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+func (s *RedisStorage) ExpireTree(ctx context.Context, address string, expireAt time.Time) error {
+	err := s.redisClient.ZAdd(ctx, RedisGCExpiry, redis.Z{Score: float64(expireAt.Unix()), Member: address}).Err()
+	if err != nil {
+		fmt.Printf("ExpireTree ZAdd err. err:%+v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *RedisStorage) FindExpiredTrees(ctx context.Context, now time.Time) ([]string, error) {
+	expired, err := s.redisClient.ZRangeByScore(ctx, RedisGCExpiry, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Unix(), 10),
+	}).Result()
+	if err != nil {
+		fmt.Printf("FindExpiredTrees ZRangeByScore err. err:%+v\n", err)
+		return nil, err
+	}
+
+	deleting, err := s.redisClient.SMembers(ctx, RedisGCDeleting).Result()
+	if err != nil {
+		fmt.Printf("FindExpiredTrees SMembers err. err:%+v\n", err)
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var retsz []string
+	for _, address := range append(expired, deleting...) {
+		if !seen[address] {
+			seen[address] = true
+			retsz = append(retsz, address)
+		}
+	}
+	sort.Strings(retsz)
+
+	return retsz, nil
+}
+
+func (s *RedisStorage) InsertTreeInfo(ctx context.Context, info *db.TreeInfo) error {
+	val, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	ok, err := s.redisClient.HSetNX(ctx, RedisRegistry, info.MtAddress, val).Result()
+	if err != nil {
+		fmt.Printf("InsertTreeInfo HSetNX err. err:%+v\n", err)
+		return err
+	}
+
+	if !ok {
+		return db.ErrAlreadyExists
+	}
+	return nil
+}
+
+func (s *RedisStorage) UpdateTreeInfo(ctx context.Context, info *db.TreeInfo) error {
+	val, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	updated, err := updateTreeInfoScript.Run(ctx, s.redisClient, []string{RedisRegistry}, info.MtAddress, val).Int()
+	if err != nil {
+		fmt.Printf("UpdateTreeInfo updateTreeInfoScript err. err:%+v\n", err)
+		return err
+	}
+
+	if updated == 0 {
+		return db.ErrNotFound
+	}
+	return nil
+}
+
+func (s *RedisStorage) FindTreeInfo(ctx context.Context, address string) (*db.TreeInfo, error) {
+	val, err := s.redisClient.HGet(ctx, RedisRegistry, address).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, db.ErrNotFound
+		}
+		fmt.Printf("FindTreeInfo HGet err. err:%+v\n", err)
+		return nil, err
+	}
+
+	var info db.TreeInfo
+	if err = json.Unmarshal([]byte(val), &info); err != nil {
+		fmt.Printf("FindTreeInfo Unmarshal err. err:%+v\n", err)
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+func (s *RedisStorage) PutIntent(ctx context.Context, intent *db.AppendIntent) error {
+	val, err := json.Marshal(intent)
+	if err != nil {
+		return err
+	}
+
+	err = s.redisClient.Set(ctx, getRedisIntentKey(intent.MtAddress), val, 0).Err()
+	if err != nil {
+		fmt.Printf("PutIntent Set err. err:%+v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *RedisStorage) FindIntent(ctx context.Context, address string) (*db.AppendIntent, error) {
+	val, err := s.redisClient.Get(ctx, getRedisIntentKey(address)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, db.ErrNotFound
+		}
+		fmt.Printf("FindIntent Get err. err:%+v\n", err)
+		return nil, err
+	}
+
+	var intent db.AppendIntent
+	if err = json.Unmarshal([]byte(val), &intent); err != nil {
+		fmt.Printf("FindIntent Unmarshal err. err:%+v\n", err)
+		return nil, err
+	}
+
+	return &intent, nil
+}
+
+func (s *RedisStorage) DeleteIntent(ctx context.Context, address string) error {
+	err := s.redisClient.Del(ctx, getRedisIntentKey(address)).Err()
+	if err != nil {
+		fmt.Printf("DeleteIntent Del err. err:%+v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// AppendAudit pushes entry on the list of its tree, its Seq being its
+// position in the list.
+func (s *RedisStorage) AppendAudit(ctx context.Context, entry *db.AuditEntry) error {
+	stored := *entry
+	stored.Seq = 0
+	val, err := json.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+
+	n, err := s.redisClient.RPush(ctx, getRedisAuditKey(entry.MtAddress), val).Result()
+	if err != nil {
+		fmt.Printf("AppendAudit RPush err. err:%+v\n", err)
+		return err
+	}
+
+	entry.Seq = uint64(n)
+	return nil
+}
+
+func (s *RedisStorage) FindAudit(ctx context.Context, address string, from uint64, limit int) ([]*db.AuditEntry, error) {
+	if from == 0 {
+		from = 1
+	}
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	vals, err := s.redisClient.LRange(ctx, getRedisAuditKey(address), int64(from-1), int64(from-1)+int64(limit)-1).Result()
+	if err != nil {
+		fmt.Printf("FindAudit LRange err. err:%+v\n", err)
+		return nil, err
+	}
+
+	var retsz []*db.AuditEntry
+	for i, val := range vals {
+		entry, err := decodeAudit(val, from+uint64(i))
+		if err != nil {
+			fmt.Printf("FindAudit decodeAudit err. err:%+v\n", err)
+			return nil, err
+		}
+		retsz = append(retsz, entry)
+	}
+	return retsz, nil
+}
+
+func (s *RedisStorage) LastAudit(ctx context.Context, address string) (*db.AuditEntry, error) {
+	var llen *redis.IntCmd
+	var last *redis.StringCmd
+	_, err := s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		llen = pipe.LLen(ctx, getRedisAuditKey(address))
+		last = pipe.LIndex(ctx, getRedisAuditKey(address), -1)
+		return nil
+	})
+	if err == redis.Nil {
+		return nil, db.ErrNotFound
+	}
+	if err != nil {
+		fmt.Printf("LastAudit TxPipelined err. err:%+v\n", err)
+		return nil, err
+	}
+
+	return decodeAudit(last.Val(), uint64(llen.Val()))
+}
+
+func decodeAudit(val string, seq uint64) (*db.AuditEntry, error) {
+	var entry db.AuditEntry
+	if err := json.Unmarshal([]byte(val), &entry); err != nil {
+		return nil, err
+	}
+	entry.Seq = seq
+	return &entry, nil
+}
+
+func (s *RedisStorage) ListTreeInfos(ctx context.Context) ([]*db.TreeInfo, error) {
+	// HSCAN可能重复返回同一字段
+	infos := make(map[string]*db.TreeInfo)
+	var cursor uint64
+	for {
+		fields, next, err := s.redisClient.HScan(ctx, RedisRegistry, cursor, "*", RedisDeleteBatch).Result()
+		if err != nil {
+			fmt.Printf("ListTreeInfos HScan err. err:%+v\n", err)
+			return nil, err
+		}
+
+		// HSCAN返回的是字段与值交替排列的列表
+		for i := 1; i < len(fields); i += 2 {
+			var info db.TreeInfo
+			if err = json.Unmarshal([]byte(fields[i]), &info); err != nil {
+				fmt.Printf("ListTreeInfos Unmarshal err. err:%+v\n", err)
+				return nil, err
+			}
+			infos[info.MtAddress] = &info
+		}
+
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+
+	var retsz []*db.TreeInfo
+	for _, info := range infos {
+		retsz = append(retsz, info)
+	}
+	sort.Slice(retsz, func(i, j int) bool { return retsz[i].MtAddress < retsz[j].MtAddress })
+
+	return retsz, nil
+}
+
+// escapeRedisPattern escapes the glob characters of a tree address used in a SCAN pattern.
+func escapeRedisPattern(str string) string {
+	var sb strings.Builder
+	for _, c := range str {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
 func getRedisNodeKey(address string, data string) string {
 	return fmt.Sprintf(RedisTreeNode, address, data)
 }
 
+func getRedisFenceKey(address string) string {
+	return fmt.Sprintf(RedisFence, address)
+}
+
+func getRedisMetaKey(address string) string {
+	return fmt.Sprintf(RedisTreeMeta, address)
+}
+
+func getRedisAuditKey(address string) string {
+	return fmt.Sprintf(RedisAudit, address)
+}
+
+func getRedisIntentKey(address string) string {
+	return fmt.Sprintf(RedisIntent, address)
+}
+
 func getRedisTreeKey(address string, level, levelNo int) string {
 	return fmt.Sprintf(RedisTree, address, level, levelNo)
 }
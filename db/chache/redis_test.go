@@ -0,0 +1,117 @@
+package chache
+
+import (
+	"context"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"github.com/UXUYLabs/go-merkletree/db/storagetest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) db.Storage {
+		_, client := newTestClient(t)
+		return NewRedisStorageWithClient(client)
+	})
+}
+
+func TestRedisMissingRoot(t *testing.T) {
+	mr, client := newTestClient(t)
+	storagetest.RunMissingRoot(t, NewRedisStorageWithClient(client), func(t *testing.T, address string, level, levelNo int) {
+		assert.True(t, mr.Del(getRedisTreeKey(address, level, levelNo)))
+	})
+}
+
+func TestRedisResumeDeleteTree(t *testing.T) {
+	mr, client := newTestClient(t)
+	storage := NewRedisStorageWithClient(client)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		node := &db.TreeNode{MtAddress: "tree*", Data: fmt.Sprintf("0x%040x", i+1), Hash: "01", LevelNo: i}
+		assert.Nil(t, storage.Insert(ctx, node))
+	}
+	assert.Nil(t, storage.Insert(ctx, &db.TreeNode{MtAddress: "tree", Data: "0x01", Hash: "01"}))
+
+	// 模拟删除在登记后中断
+	_, err := mr.SetAdd(RedisGCDeleting, "tree*")
+	assert.Nil(t, err)
+	expired, err := storage.FindExpiredTrees(ctx, time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"tree*"}, expired)
+
+	assert.Nil(t, storage.DeleteTree(ctx, "tree*"))
+	expired, err = storage.FindExpiredTrees(ctx, time.Now())
+	assert.Nil(t, err)
+	assert.Empty(t, expired)
+
+	// 地址中的通配符不能波及其他树
+	assert.Equal(t, []string{"merkletree:tree:tree:level:0:no:0", "merkletree:tree:tree:meta", "merkletree:tree:tree:node:0x01"}, mr.Keys())
+}
+
+func TestRedisLegacyNodes(t *testing.T) {
+	mr, client := newTestClient(t)
+	storage := NewRedisStorageWithClient(client)
+	ctx := context.Background()
+
+	leaves := []*db.TreeNode{
+		{MtAddress: "tree", Data: "0x8b1b201E91966957f18bBcDDB520c53c521bF5cd", Hash: fmt.Sprintf("%064x", 1), LevelNo: 0},
+		{MtAddress: "tree", Data: "0xeA726629EC5fe5cE300000d1a8c89B3054A22cE7", Hash: fmt.Sprintf("%064x", 2), LevelNo: 1},
+	}
+	root := &db.TreeNode{MtAddress: "tree", Hash: fmt.Sprintf("%064x", 3), Level: 1}
+
+	// 按旧格式直接写入JSON
+	for _, node := range leaves {
+		assert.Nil(t, mr.Set(getRedisTreeKey(node.MtAddress, node.Level, node.LevelNo), node.ToString()))
+		assert.Nil(t, mr.Set(getRedisNodeKey(node.MtAddress, node.Data), node.ToString()))
+	}
+	assert.Nil(t, mr.Set(getRedisTreeKey(root.MtAddress, root.Level, root.LevelNo), root.ToString()))
+	assert.Nil(t, mr.Set(getRedisFenceKey("tree"), "7"))
+
+	check := func() {
+		found, err := storage.FindRootNode(ctx, "tree")
+		assert.Nil(t, err)
+		assert.Equal(t, root, found)
+		for _, node := range leaves {
+			found, err = storage.FindOneByLeafData(ctx, "tree", node.Data)
+			assert.Nil(t, err)
+			assert.Equal(t, node, found)
+		}
+	}
+	check()
+
+	_, err := storage.FindTreeMeta(ctx, "tree")
+	assert.Nil(t, err)
+	assert.False(t, mr.Exists(getRedisMetaKey("tree")))
+
+	converted, err := storage.ConvertLegacyNodes(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, converted)
+	check()
+
+	meta, err := storage.FindTreeMeta(ctx, "tree")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, meta.LeafCount)
+	assert.Equal(t, 2, meta.Depth)
+	assert.Equal(t, root.Hash, meta.RootHash)
+	assert.True(t, mr.Exists(getRedisMetaKey("tree")))
+
+	val, err := mr.Get(getRedisTreeKey("tree", 0, 0))
+	assert.Nil(t, err)
+	assert.Equal(t, nodeFormatV1, val[0])
+	assert.Less(t, len(val), len(leaves[0].ToString())/2)
+	val, err = mr.Get(getRedisNodeKey("tree", leaves[0].Data))
+	assert.Nil(t, err)
+	assert.Equal(t, string([]byte{leafRefFormatV1, 0}), val)
+
+	// 其他值保持原样
+	val, err = mr.Get(getRedisFenceKey("tree"))
+	assert.Nil(t, err)
+	assert.Equal(t, "7", val)
+
+	converted, err = storage.ConvertLegacyNodes(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, converted)
+}
@@ -0,0 +1,343 @@
+// Package instrumented is a db.Storage decorator calling a hook around every
+// call to its backend, on which metrics and tracing decorators are built.
+package instrumented
+
+import (
+	"context"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"io"
+	"time"
+)
+
+// Call describes a call to the backend.
+type Call struct {
+	// Method is the name of the method called, e.g. "FindRootNode"
+	Method string
+	// Address is the tree called about, empty for calls not about one tree
+	Address string
+	// Nodes is the number of nodes written, or read once the call returned
+	Nodes int
+}
+
+// Hook is called before each call to the backend. The call is made with the
+// returned context, and done is called with its error once it returns.
+type Hook func(ctx context.Context, call *Call) (context.Context, func(err error))
+
+// Storage wraps a backend db.Storage, calling its hook around every call, and
+// hooks the calls made through the transactions it opens as well. It is a
+// db.Wrapper: the methods of the optional interfaces the backend lacks return
+// db.ErrNotSupported without calling the hook.
+type Storage struct {
+	backend db.Storage
+	hook    Hook
+}
+
+func NewStorage(backend db.Storage, hook Hook) *Storage {
+	return &Storage{backend: backend, hook: hook}
+}
+
+// Unwrap returns the backend.
+func (s *Storage) Unwrap() db.Storage {
+	return s.backend
+}
+
+// Close closes the backend when it implements io.Closer.
+func (s *Storage) Close() error {
+	if closer, ok := s.backend.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (s *Storage) call(ctx context.Context, call *Call, fn func(ctx context.Context) error) error {
+	ctx, done := s.hook(ctx, call)
+	err := fn(ctx)
+	done(err)
+	return err
+}
+
+// tx is a transaction of the backend whose calls are hooked.
+type tx struct {
+	*Storage
+	tx db.Tx
+}
+
+func (t *tx) Commit(ctx context.Context) error {
+	return t.call(ctx, &Call{Method: "Commit"}, t.tx.Commit)
+}
+
+func (t *tx) Rollback(ctx context.Context) error {
+	return t.call(ctx, &Call{Method: "Rollback"}, t.tx.Rollback)
+}
+
+func (s *Storage) Insert(ctx context.Context, node *db.TreeNode) error {
+	return s.call(ctx, &Call{Method: "Insert", Address: node.MtAddress, Nodes: 1}, func(ctx context.Context) error {
+		return s.backend.Insert(ctx, node)
+	})
+}
+
+func (s *Storage) Update(ctx context.Context, node *db.TreeNode) error {
+	return s.call(ctx, &Call{Method: "Update", Address: node.MtAddress, Nodes: 1}, func(ctx context.Context) error {
+		return s.backend.Update(ctx, node)
+	})
+}
+
+func (s *Storage) FindRootNode(ctx context.Context, address string) (node *db.TreeNode, err error) {
+	call := &Call{Method: "FindRootNode", Address: address}
+	err = s.call(ctx, call, func(ctx context.Context) (err error) {
+		node, err = s.backend.FindRootNode(ctx, address)
+		if node != nil {
+			call.Nodes = 1
+		}
+		return err
+	})
+	return node, err
+}
+
+func (s *Storage) FindMaxNoOfLeaf(ctx context.Context, address string) (maxNo int, err error) {
+	err = s.call(ctx, &Call{Method: "FindMaxNoOfLeaf", Address: address}, func(ctx context.Context) (err error) {
+		maxNo, err = s.backend.FindMaxNoOfLeaf(ctx, address)
+		return err
+	})
+	return maxNo, err
+}
+
+func (s *Storage) FindOneByLeafData(ctx context.Context, address string, data string) (node *db.TreeNode, err error) {
+	call := &Call{Method: "FindOneByLeafData", Address: address}
+	err = s.call(ctx, call, func(ctx context.Context) (err error) {
+		node, err = s.backend.FindOneByLeafData(ctx, address, data)
+		if node != nil {
+			call.Nodes = 1
+		}
+		return err
+	})
+	return node, err
+}
+
+func (s *Storage) FindMultiTreeNode(ctx context.Context, address string, nodePoses []*db.NodePos) (nodes []*db.TreeNode, err error) {
+	call := &Call{Method: "FindMultiTreeNode", Address: address}
+	err = s.call(ctx, call, func(ctx context.Context) (err error) {
+		nodes, err = s.backend.FindMultiTreeNode(ctx, address, nodePoses)
+		call.Nodes = len(nodes)
+		return err
+	})
+	return nodes, err
+}
+
+func (s *Storage) FindNodesByLevel(ctx context.Context, address string, level int) (nodes []*db.TreeNode, err error) {
+	call := &Call{Method: "FindNodesByLevel", Address: address}
+	err = s.call(ctx, call, func(ctx context.Context) (err error) {
+		nodes, err = s.backend.FindNodesByLevel(ctx, address, level)
+		call.Nodes = len(nodes)
+		return err
+	})
+	return nodes, err
+}
+
+// Begin opens a transaction of the backend when it implements db.TxStorage,
+// otherwise one committing through the backend's WriteNodes.
+func (s *Storage) Begin(ctx context.Context) (db.Tx, error) {
+	txStorage, ok := s.backend.(db.TxStorage)
+	if !ok {
+		if _, ok = s.backend.(db.BatchWriter); !ok {
+			return nil, db.ErrNotSupported
+		}
+		return db.NewBufferedTx(s, s.WriteNodes), nil
+	}
+
+	var backendTx db.Tx
+	err := s.call(ctx, &Call{Method: "Begin"}, func(ctx context.Context) (err error) {
+		backendTx, err = txStorage.Begin(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &tx{Storage: &Storage{backend: backendTx, hook: s.hook}, tx: backendTx}, nil
+}
+
+func (s *Storage) WriteNodes(ctx context.Context, nodes []*db.TreeNode) error {
+	writer, ok := s.backend.(db.BatchWriter)
+	if !ok {
+		return db.ErrNotSupported
+	}
+	return s.call(ctx, &Call{Method: "WriteNodes", Nodes: len(nodes)}, func(ctx context.Context) error {
+		return writer.WriteNodes(ctx, nodes)
+	})
+}
+
+func (s *Storage) RemoveNodes(ctx context.Context, address string, poses []*db.NodePos) error {
+	remover, ok := s.backend.(db.NodeRemover)
+	if !ok {
+		return db.ErrNotSupported
+	}
+	return s.call(ctx, &Call{Method: "RemoveNodes", Address: address}, func(ctx context.Context) error {
+		return remover.RemoveNodes(ctx, address, poses)
+	})
+}
+
+func (s *Storage) PutIntent(ctx context.Context, intent *db.AppendIntent) error {
+	journal, ok := s.backend.(db.IntentJournal)
+	if !ok {
+		return db.ErrNotSupported
+	}
+	return s.call(ctx, &Call{Method: "PutIntent", Address: intent.MtAddress}, func(ctx context.Context) error {
+		return journal.PutIntent(ctx, intent)
+	})
+}
+
+func (s *Storage) FindIntent(ctx context.Context, address string) (intent *db.AppendIntent, err error) {
+	journal, ok := s.backend.(db.IntentJournal)
+	if !ok {
+		return nil, db.ErrNotSupported
+	}
+	err = s.call(ctx, &Call{Method: "FindIntent", Address: address}, func(ctx context.Context) (err error) {
+		intent, err = journal.FindIntent(ctx, address)
+		return err
+	})
+	return intent, err
+}
+
+func (s *Storage) DeleteIntent(ctx context.Context, address string) error {
+	journal, ok := s.backend.(db.IntentJournal)
+	if !ok {
+		return db.ErrNotSupported
+	}
+	return s.call(ctx, &Call{Method: "DeleteIntent", Address: address}, func(ctx context.Context) error {
+		return journal.DeleteIntent(ctx, address)
+	})
+}
+
+func (s *Storage) AppendAudit(ctx context.Context, entry *db.AuditEntry) error {
+	log, ok := s.backend.(db.AuditLog)
+	if !ok {
+		return db.ErrNotSupported
+	}
+	return s.call(ctx, &Call{Method: "AppendAudit", Address: entry.MtAddress}, func(ctx context.Context) error {
+		return log.AppendAudit(ctx, entry)
+	})
+}
+
+func (s *Storage) FindAudit(ctx context.Context, address string, from uint64, limit int) (entries []*db.AuditEntry, err error) {
+	log, ok := s.backend.(db.AuditLog)
+	if !ok {
+		return nil, db.ErrNotSupported
+	}
+	err = s.call(ctx, &Call{Method: "FindAudit", Address: address}, func(ctx context.Context) (err error) {
+		entries, err = log.FindAudit(ctx, address, from, limit)
+		return err
+	})
+	return entries, err
+}
+
+func (s *Storage) LastAudit(ctx context.Context, address string) (entry *db.AuditEntry, err error) {
+	log, ok := s.backend.(db.AuditLog)
+	if !ok {
+		return nil, db.ErrNotSupported
+	}
+	err = s.call(ctx, &Call{Method: "LastAudit", Address: address}, func(ctx context.Context) (err error) {
+		entry, err = log.LastAudit(ctx, address)
+		return err
+	})
+	return entry, err
+}
+
+func (s *Storage) DeleteTree(ctx context.Context, address string) error {
+	deleter, ok := s.backend.(db.TreeDeleter)
+	if !ok {
+		return db.ErrNotSupported
+	}
+	return s.call(ctx, &Call{Method: "DeleteTree", Address: address}, func(ctx context.Context) error {
+		return deleter.DeleteTree(ctx, address)
+	})
+}
+
+func (s *Storage) ExpireTree(ctx context.Context, address string, expireAt time.Time) error {
+	deleter, ok := s.backend.(db.TreeDeleter)
+	if !ok {
+		return db.ErrNotSupported
+	}
+	return s.call(ctx, &Call{Method: "ExpireTree", Address: address}, func(ctx context.Context) error {
+		return deleter.ExpireTree(ctx, address, expireAt)
+	})
+}
+
+func (s *Storage) FindExpiredTrees(ctx context.Context, now time.Time) (addresses []string, err error) {
+	deleter, ok := s.backend.(db.TreeDeleter)
+	if !ok {
+		return nil, db.ErrNotSupported
+	}
+	err = s.call(ctx, &Call{Method: "FindExpiredTrees"}, func(ctx context.Context) (err error) {
+		addresses, err = deleter.FindExpiredTrees(ctx, now)
+		return err
+	})
+	return addresses, err
+}
+
+func (s *Storage) InsertTreeInfo(ctx context.Context, info *db.TreeInfo) error {
+	registry, ok := s.backend.(db.TreeRegistry)
+	if !ok {
+		return db.ErrNotSupported
+	}
+	return s.call(ctx, &Call{Method: "InsertTreeInfo", Address: info.MtAddress}, func(ctx context.Context) error {
+		return registry.InsertTreeInfo(ctx, info)
+	})
+}
+
+func (s *Storage) UpdateTreeInfo(ctx context.Context, info *db.TreeInfo) error {
+	registry, ok := s.backend.(db.TreeRegistry)
+	if !ok {
+		return db.ErrNotSupported
+	}
+	return s.call(ctx, &Call{Method: "UpdateTreeInfo", Address: info.MtAddress}, func(ctx context.Context) error {
+		return registry.UpdateTreeInfo(ctx, info)
+	})
+}
+
+func (s *Storage) FindTreeInfo(ctx context.Context, address string) (info *db.TreeInfo, err error) {
+	registry, ok := s.backend.(db.TreeRegistry)
+	if !ok {
+		return nil, db.ErrNotSupported
+	}
+	err = s.call(ctx, &Call{Method: "FindTreeInfo", Address: address}, func(ctx context.Context) (err error) {
+		info, err = registry.FindTreeInfo(ctx, address)
+		return err
+	})
+	return info, err
+}
+
+func (s *Storage) ListTreeInfos(ctx context.Context) (infos []*db.TreeInfo, err error) {
+	registry, ok := s.backend.(db.TreeRegistry)
+	if !ok {
+		return nil, db.ErrNotSupported
+	}
+	err = s.call(ctx, &Call{Method: "ListTreeInfos"}, func(ctx context.Context) (err error) {
+		infos, err = registry.ListTreeInfos(ctx)
+		return err
+	})
+	return infos, err
+}
+
+func (s *Storage) FindTreeMeta(ctx context.Context, address string) (meta *db.TreeMeta, err error) {
+	store, ok := s.backend.(db.MetaStore)
+	if !ok {
+		return nil, db.ErrNotSupported
+	}
+	err = s.call(ctx, &Call{Method: "FindTreeMeta", Address: address}, func(ctx context.Context) (err error) {
+		meta, err = store.FindTreeMeta(ctx, address)
+		return err
+	})
+	return meta, err
+}
+
+func (s *Storage) ListTrees(ctx context.Context) (addresses []string, err error) {
+	store, ok := s.backend.(db.MetaStore)
+	if !ok {
+		return nil, db.ErrNotSupported
+	}
+	err = s.call(ctx, &Call{Method: "ListTrees"}, func(ctx context.Context) (err error) {
+		addresses, err = store.ListTrees(ctx)
+		return err
+	})
+	return addresses, err
+}
@@ -0,0 +1,170 @@
+package instrumented_test
+
+import (
+	"context"
+	"github.com/UXUYLabs/go-merkletree"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"github.com/UXUYLabs/go-merkletree/db/instrumented"
+	"github.com/UXUYLabs/go-merkletree/db/memory"
+	"github.com/UXUYLabs/go-merkletree/db/storagetest"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+type ctxKey struct{}
+
+// recorder counts the hooked calls, their errors and the nodes they read or
+// wrote by method.
+type recorder struct {
+	mu     sync.Mutex
+	calls  map[string]int
+	errors map[string]int
+	nodes  map[string]int
+	// unmarked counts the calls whose context lost the hook's value
+	unmarked int
+}
+
+func newRecorder() *recorder {
+	return &recorder{calls: make(map[string]int), errors: make(map[string]int), nodes: make(map[string]int)}
+}
+
+func (r *recorder) hook(ctx context.Context, call *instrumented.Call) (context.Context, func(error)) {
+	ctx = context.WithValue(ctx, ctxKey{}, call.Method)
+	return ctx, func(err error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.calls[call.Method]++
+		r.nodes[call.Method] += call.Nodes
+		if err != nil && err != db.ErrNotFound {
+			r.errors[call.Method]++
+		}
+	}
+}
+
+// markedStorage checks that the backend is called with the hook's context.
+type markedStorage struct {
+	*memory.MemoryStorage
+	r *recorder
+}
+
+func (s *markedStorage) FindRootNode(ctx context.Context, address string) (*db.TreeNode, error) {
+	if ctx.Value(ctxKey{}) != "FindRootNode" {
+		s.r.mu.Lock()
+		s.r.unmarked++
+		s.r.mu.Unlock()
+	}
+	return s.MemoryStorage.FindRootNode(ctx, address)
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) db.Storage {
+		return instrumented.NewStorage(memory.NewMemoryStorage(), newRecorder().hook)
+	})
+}
+
+func TestInstrumentedCalls(t *testing.T) {
+	r := newRecorder()
+	storage := instrumented.NewStorage(&markedStorage{MemoryStorage: memory.NewMemoryStorage(), r: r}, r.hook)
+	tree, err := merkletree.NewMerkleTree(context.Background(), storage, "1637704523306766336", merkletree.WithLogger(merkletree.DiscardLogger))
+	assert.Nil(t, err)
+
+	leaves := []string{
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+		"0x9965507D1a55bcC2695C58ba16FB37d819B0A4dc",
+	}
+	assert.Nil(t, tree.AppendLeaves(leaves))
+	proof, err := tree.GenerateProof(leaves[1])
+	assert.Nil(t, err)
+	ok, err := tree.VerifyProof(proof, leaves[1])
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// 每次追加一个事务，事务内的读写同样经过钩子
+	assert.Equal(t, 3, r.calls["Begin"])
+	assert.Equal(t, 3, r.calls["Commit"])
+	assert.Equal(t, 0, r.calls["Rollback"])
+	// 一个批次只记录一次意图和审计
+	assert.Equal(t, 1, r.calls["PutIntent"])
+	assert.Equal(t, 1, r.calls["AppendAudit"])
+	assert.Equal(t, 1, r.calls["DeleteIntent"])
+	assert.Less(t, 0, r.calls["FindOneByLeafData"])
+	assert.Less(t, 0, r.calls["FindRootNode"])
+	assert.Equal(t, 0, r.unmarked)
+	// 三次追加共写入七个节点
+	assert.Equal(t, 7, r.nodes["Insert"]+r.nodes["Update"])
+	assert.Less(t, 0, r.nodes["FindMultiTreeNode"])
+	assert.Empty(t, r.errors)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = storage.FindRootNode(ctx, "1637704523306766336")
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, r.errors["FindRootNode"])
+}
+
+// batchStorage is a backend writing batches atomically but without
+// transactions of its own.
+type batchStorage struct {
+	db.Storage
+	writer db.BatchWriter
+}
+
+func (s *batchStorage) WriteNodes(ctx context.Context, nodes []*db.TreeNode) error {
+	return s.writer.WriteNodes(ctx, nodes)
+}
+
+func TestInstrumentedCapabilities(t *testing.T) {
+	// 只支持后端实现的可选接口
+	storage := instrumented.NewStorage(struct{ db.Storage }{memory.NewMemoryStorage()}, newRecorder().hook)
+	assert.Empty(t, interfaces(storage))
+	manager, err := merkletree.NewMerkleTreeManager(context.Background(), storage, merkletree.WithLogger(merkletree.DiscardLogger))
+	assert.Nil(t, err)
+	_, err = manager.History("1637704523306766336", 1, 10)
+	assert.Equal(t, db.ErrNotSupported, err)
+
+	assert.Len(t, interfaces(instrumented.NewStorage(memory.NewMemoryStorage(), newRecorder().hook)), 8)
+
+	// 仅支持批量写入的后端通过WriteNodes提交事务
+	r := newRecorder()
+	backend := memory.NewMemoryStorage()
+	storage = instrumented.NewStorage(&batchStorage{Storage: backend, writer: backend}, r.hook)
+	assert.Equal(t, []string{"TxStorage", "BatchWriter"}, interfaces(storage))
+	tree, err := merkletree.NewMerkleTree(context.Background(), storage, "1637704523306766336", merkletree.WithLogger(merkletree.DiscardLogger))
+	assert.Nil(t, err)
+	assert.Nil(t, tree.AppendLeaves([]string{"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359"}))
+	assert.Equal(t, 0, r.calls["Begin"])
+	assert.Equal(t, 2, r.calls["WriteNodes"])
+	assert.Equal(t, 0, r.calls["Insert"])
+}
+
+// interfaces lists the optional interfaces of db that storage supports.
+func interfaces(storage db.Storage) []string {
+	var names []string
+	if db.Supports(storage, (*db.TxStorage)(nil)) {
+		names = append(names, "TxStorage")
+	}
+	if db.Supports(storage, (*db.BatchWriter)(nil)) {
+		names = append(names, "BatchWriter")
+	}
+	if db.Supports(storage, (*db.NodeRemover)(nil)) {
+		names = append(names, "NodeRemover")
+	}
+	if db.Supports(storage, (*db.IntentJournal)(nil)) {
+		names = append(names, "IntentJournal")
+	}
+	if db.Supports(storage, (*db.AuditLog)(nil)) {
+		names = append(names, "AuditLog")
+	}
+	if db.Supports(storage, (*db.TreeDeleter)(nil)) {
+		names = append(names, "TreeDeleter")
+	}
+	if db.Supports(storage, (*db.TreeRegistry)(nil)) {
+		names = append(names, "TreeRegistry")
+	}
+	if db.Supports(storage, (*db.MetaStore)(nil)) {
+		names = append(names, "MetaStore")
+	}
+	return names
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrLockLost is returned when a lease expired or could not be renewed while
+// a mutation was running. Nothing of that mutation has been committed.
+var ErrLockLost = errors.New("lock lease lost")
+
+// ErrFenced is returned by a storage rejecting a write whose fencing token is
+// older than one it has already accepted for the same tree.
+var ErrFenced = errors.New("write rejected by fencing token")
+
+// Locker grants exclusive, lease based ownership of a tree across processes.
+type Locker interface {
+	// Acquire blocks until the lock on key is held or ctx is done.
+	Acquire(ctx context.Context, key string) (Lease, error)
+}
+
+// Lease is an acquired lock. It stays valid until Release or until the
+// Locker fails to renew it.
+type Lease interface {
+	// Token is the fencing token of this grant. Tokens of the same key only increase.
+	Token() int64
+	// Done is closed once the lease is released or lost.
+	Done() <-chan struct{}
+	// Err returns ErrLockLost once the lease has been lost, nil otherwise.
+	Err() error
+	Release(ctx context.Context) error
+}
+
+type fencingTokenKey struct{}
+
+// WithFencingToken attaches a lease's fencing token to ctx. Storages that
+// support fencing reject commits carrying a token older than the newest one seen.
+func WithFencingToken(ctx context.Context, token int64) context.Context {
+	return context.WithValue(ctx, fencingTokenKey{}, token)
+}
+
+// FencingToken returns the fencing token attached to ctx, if any.
+func FencingToken(ctx context.Context) (int64, bool) {
+	token, ok := ctx.Value(fencingTokenKey{}).(int64)
+	return token, ok
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"github.com/UXUYLabs/go-merkletree/db"
+	"sort"
+	"sync"
+	"time"
 )
 
 // Tree record a single trees
@@ -15,10 +18,22 @@ type TreeMap map[string]Tree
 // DataMap is Position to a data node of the tree
 type DataMap map[string]map[string]*db.TreeNode
 
+// MemoryStorage keeps every tree in process memory. It is safe for concurrent
+// use, and every method fails with ctx.Err() once ctx is done.
 type MemoryStorage struct {
 	db.Storage
-	dataMap DataMap
-	treeMap TreeMap
+	mu        sync.RWMutex
+	dataMap   DataMap
+	treeMap   TreeMap
+	expireMap map[string]time.Time
+	infoMap   map[string]*db.TreeInfo
+	metaMap   map[string]*db.TreeMeta
+	intentMap map[string]*db.AppendIntent
+	// auditMap survives DeleteTree
+	auditMap map[string][]*db.AuditEntry
+
+	// wal is nil unless the storage was opened with OpenMemoryStorage
+	wal *wal
 }
 
 func NewMemoryStorage() *MemoryStorage {
@@ -26,18 +41,109 @@ func NewMemoryStorage() *MemoryStorage {
 	treeMap := make(TreeMap)
 
 	return &MemoryStorage{
-		dataMap: dataMap,
-		treeMap: treeMap,
+		dataMap:   dataMap,
+		treeMap:   treeMap,
+		expireMap: make(map[string]time.Time),
+		infoMap:   make(map[string]*db.TreeInfo),
+		metaMap:   make(map[string]*db.TreeMeta),
+		intentMap: make(map[string]*db.AppendIntent),
+		auditMap:  make(map[string][]*db.AuditEntry),
+	}
+}
+
+// Begin opens a copy-on-write transaction: writes stay in the transaction
+// until Commit applies them all at once.
+func (s *MemoryStorage) Begin(ctx context.Context) (db.Tx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
+
+	return db.NewBufferedTx(s, s.WriteNodes), nil
+}
+
+// WriteNodes stores nodes as one atomic step.
+func (s *MemoryStorage) WriteNodes(ctx context.Context, nodes []*db.TreeNode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.commit(&record{Op: opInsert, Nodes: nodes})
 }
 
 func (s *MemoryStorage) Insert(ctx context.Context, node *db.TreeNode) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.commit(&record{Op: opInsert, Nodes: []*db.TreeNode{node}})
+}
+
+// commit logs a change when the storage is persistent, then applies it. The
+// caller holds the write lock.
+func (s *MemoryStorage) commit(rec *record) error {
+	rec.Time = time.Now()
+	if s.wal != nil {
+		if err := s.wal.append(rec); err != nil {
+			fmt.Printf("commit wal append err. err:%+v\n", err)
+			return err
+		}
+	}
+	s.apply(rec)
+	return nil
+}
+
+// apply makes a change already validated, and logged, visible.
+func (s *MemoryStorage) apply(rec *record) {
+	switch rec.Op {
+	case opInsert:
+		for _, node := range rec.Nodes {
+			s.insert(node, rec.Time)
+		}
+	case opUpdate:
+		s.update(rec.Nodes[0], rec.Time)
+	case opDeleteTree:
+		delete(s.treeMap, rec.Address)
+		delete(s.dataMap, rec.Address)
+		delete(s.expireMap, rec.Address)
+		delete(s.infoMap, rec.Address)
+		delete(s.metaMap, rec.Address)
+		delete(s.intentMap, rec.Address)
+	case opExpireTree:
+		s.expireMap[rec.Address] = rec.ExpireAt
+	case opPutTreeInfo:
+		infoCopy := *rec.Info
+		s.infoMap[rec.Info.MtAddress] = &infoCopy
+	case opRemoveNodes:
+		s.removeNodes(rec.Address, rec.Poses, rec.Time)
+	case opPutIntent:
+		intentCopy := *rec.Intent
+		s.intentMap[rec.Intent.MtAddress] = &intentCopy
+	case opDelIntent:
+		delete(s.intentMap, rec.Address)
+	case opAudit:
+		entry := *rec.Audit
+		entry.Seq = uint64(len(s.auditMap[entry.MtAddress]) + 1)
+		s.auditMap[entry.MtAddress] = append(s.auditMap[entry.MtAddress], &entry)
+	}
+}
+
+func (s *MemoryStorage) insert(node *db.TreeNode, now time.Time) {
 	//fmt.Printf("Insert node %+v\n", node)
-	// 记录数据
-	if s.dataMap[node.MtAddress] == nil {
-		s.dataMap[node.MtAddress] = make(map[string]*db.TreeNode)
+	// 保存副本，调用方后续修改不会影响已存数据
+	node = node.Clone()
+	// 记录数据，只有叶子节点可以按数据查找
+	if node.IsLeaf() {
+		if s.dataMap[node.MtAddress] == nil {
+			s.dataMap[node.MtAddress] = make(map[string]*db.TreeNode)
+		}
+		s.dataMap[node.MtAddress][node.Data] = node
 	}
-	s.dataMap[node.MtAddress][node.Data] = node
 
 	tree := s.treeMap[node.MtAddress]
 	if tree == nil {
@@ -45,47 +151,138 @@ func (s *MemoryStorage) Insert(ctx context.Context, node *db.TreeNode) error {
 		s.treeMap[node.MtAddress] = tree
 	}
 
-	if len(tree) <= node.Level {
+	if tree[node.Level] == nil {
 		tree[node.Level] = make(map[int]*db.TreeNode)
 	}
 	tree[int(node.Level)][int(node.LevelNo)] = node
+	s.applyMeta(node, now)
 	//fmt.Printf("Insert tree, Level:%d LevelNo:%d node:%+v\n", node.Level, node.LevelNo, tree[node.Level][node.LevelNo])
-	return nil
 }
 
 func (s *MemoryStorage) Update(ctx context.Context, node *db.TreeNode) error {
-	s.dataMap[node.MtAddress][node.Data] = node
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	tree := s.treeMap[node.MtAddress]
-	if tree == nil || len(tree) < node.Level+1 || len(tree[node.Level]) < (node.LevelNo+1) {
+	if tree == nil || tree[node.Level] == nil || tree[node.Level][node.LevelNo] == nil {
 		return db.ErrNotFound
 	}
-	tree[node.Level][node.LevelNo] = node
-	return nil
+	return s.commit(&record{Op: opUpdate, Nodes: []*db.TreeNode{node}})
 }
 
-func (s *MemoryStorage) FindRootNode(ctx context.Context, address string) (*db.TreeNode, error) {
+func (s *MemoryStorage) update(node *db.TreeNode, now time.Time) {
+	node = node.Clone()
+	if node.IsLeaf() {
+		if s.dataMap[node.MtAddress] == nil {
+			s.dataMap[node.MtAddress] = make(map[string]*db.TreeNode)
+		}
+		s.dataMap[node.MtAddress][node.Data] = node
+	}
+	s.treeMap[node.MtAddress][node.Level][node.LevelNo] = node
+	s.applyMeta(node, now)
+}
+
+// RemoveNodes deletes nodes of a tree and recomputes its metadata.
+func (s *MemoryStorage) RemoveNodes(ctx context.Context, address string, poses []*db.NodePos) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.commit(&record{Op: opRemoveNodes, Address: address, Poses: poses})
+}
+
+func (s *MemoryStorage) removeNodes(address string, poses []*db.NodePos, now time.Time) {
 	tree := s.treeMap[address]
-	if tree == nil {
+	for _, pos := range poses {
+		node := tree[pos.Level][pos.LevelNo]
+		if node == nil {
+			continue
+		}
+		delete(tree[pos.Level], pos.LevelNo)
+		if len(tree[pos.Level]) == 0 {
+			delete(tree, pos.Level)
+		}
+		// 索引可能已指向同数据的另一个叶子
+		if node.IsLeaf() && s.dataMap[address][node.Data] == node {
+			delete(s.dataMap[address], node.Data)
+		}
+	}
+
+	// 元数据只会前移，删除节点后按剩余节点重新计算
+	delete(s.metaMap, address)
+	for _, levelMap := range tree {
+		for _, node := range levelMap {
+			s.applyMeta(node, now)
+		}
+	}
+	if len(tree) == 0 {
+		delete(s.treeMap, address)
+	}
+}
+
+func (s *MemoryStorage) applyMeta(node *db.TreeNode, now time.Time) {
+	meta := s.metaMap[node.MtAddress]
+	if meta == nil {
+		meta = &db.TreeMeta{MtAddress: node.MtAddress}
+		s.metaMap[node.MtAddress] = meta
+	}
+	meta.Apply(node, now)
+}
+
+func (s *MemoryStorage) FindRootNode(ctx context.Context, address string) (*db.TreeNode, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	meta := s.metaMap[address]
+	if meta == nil {
 		return nil, db.ErrNotFound
 	}
 
-	level := len(tree) - 1
-	//fmt.Printf("FindRootNode level:%d, levelNo:%d\n", level, len(tree[level])-1)
-	return tree[level][len(tree[level])-1], nil
+	//fmt.Printf("FindRootNode level:%d, levelNo:%d\n", meta.RootLevel, meta.RootLevelNo)
+	node := s.treeMap[address][meta.RootLevel][meta.RootLevelNo]
+	if node == nil {
+		return nil, db.ErrNotFound
+	}
+	return node.Clone(), nil
 }
 
 func (s *MemoryStorage) FindMaxNoOfLeaf(ctx context.Context, address string) (int, error) {
-	tree := s.treeMap[address]
-	if tree == nil {
+	if err := ctx.Err(); err != nil {
+		return -1, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	meta := s.metaMap[address]
+	if meta == nil || meta.LeafCount == 0 {
 		return -1, db.ErrNotFound
 	}
 
-	//fmt.Printf("FindMaxNoOfLeaf MaxNo:%d\n", len(tree[0])-1)
+	//fmt.Printf("FindMaxNoOfLeaf MaxNo:%d\n", meta.LeafCount-1)
 
-	return len(tree[0]) - 1, nil
+	return meta.LeafCount - 1, nil
 }
 
 func (s *MemoryStorage) FindOneByLeafData(ctx context.Context, address string, data string) (*db.TreeNode, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	treeMap := s.dataMap[address]
 	if treeMap == nil {
 		return nil, db.ErrNotFound
@@ -95,10 +292,17 @@ func (s *MemoryStorage) FindOneByLeafData(ctx context.Context, address string, d
 		return nil, db.ErrNotFound
 	}
 
-	return treeMap[data], nil
+	return treeMap[data].Clone(), nil
 }
 
 func (s *MemoryStorage) FindMultiTreeNode(ctx context.Context, address string, nodePoses []*db.NodePos) ([]*db.TreeNode, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	if nodePoses == nil || len(nodePoses) == 0 {
 		fmt.Printf("FindMultiTreeNode invalid params\n")
 		return nil, db.ErrNotFound
@@ -106,20 +310,19 @@ func (s *MemoryStorage) FindMultiTreeNode(ctx context.Context, address string, n
 
 	tree := s.treeMap[address]
 	if tree == nil {
-		fmt.Printf("FindMultiTreeNode tree is null, address:%s\n", address)
+		//fmt.Printf("FindMultiTreeNode tree is null, address:%s\n", address)
 		return nil, db.ErrNotFound
 	}
 
 	var retTreeNodes []*db.TreeNode
 	for _, pose := range nodePoses {
-		if len(tree) > pose.Level && tree[pose.Level] != nil &&
-			len(tree[pose.Level]) > pose.LevelNo && tree[pose.Level][pose.LevelNo] != nil {
-			retTreeNodes = append(retTreeNodes, tree[pose.Level][pose.LevelNo])
+		if tree[pose.Level] != nil && tree[pose.Level][pose.LevelNo] != nil {
+			retTreeNodes = append(retTreeNodes, tree[pose.Level][pose.LevelNo].Clone())
 		}
 	}
 
 	if retTreeNodes == nil || len(retTreeNodes) == 0 {
-		fmt.Printf("FindMultiTreeNode retTreeNodes is null, address:%s\n", address)
+		//fmt.Printf("FindMultiTreeNode retTreeNodes is null, address:%s\n", address)
 		return nil, db.ErrNotFound
 	}
 
@@ -127,8 +330,15 @@ func (s *MemoryStorage) FindMultiTreeNode(ctx context.Context, address string, n
 }
 
 func (s *MemoryStorage) FindNodesByLevel(ctx context.Context, address string, level int) ([]*db.TreeNode, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	tree := s.treeMap[address]
-	if tree == nil || len(tree) < (level+1) {
+	if tree == nil || len(tree[level]) == 0 {
 		return nil, db.ErrNotFound
 	}
 
@@ -136,8 +346,228 @@ func (s *MemoryStorage) FindNodesByLevel(ctx context.Context, address string, le
 
 	var retsz []*db.TreeNode
 	for _, node := range levelMap {
-		retsz = append(retsz, node)
+		retsz = append(retsz, node.Clone())
 	}
+	sort.Slice(retsz, func(i, j int) bool { return retsz[i].LevelNo < retsz[j].LevelNo })
 
 	return retsz, nil
 }
+
+func (s *MemoryStorage) FindTreeMeta(ctx context.Context, address string) (*db.TreeMeta, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	meta := s.metaMap[address]
+	if meta == nil {
+		return nil, db.ErrNotFound
+	}
+	metaCopy := *meta
+	return &metaCopy, nil
+}
+
+// ListTrees returns the address of every tree holding nodes, sorted.
+func (s *MemoryStorage) ListTrees(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.TreeAddresses(), nil
+}
+
+func (s *MemoryStorage) DeleteTree(ctx context.Context, address string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.commit(&record{Op: opDeleteTree, Address: address})
+}
+
+func (s *MemoryStorage) ExpireTree(ctx context.Context, address string, expireAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.commit(&record{Op: opExpireTree, Address: address, ExpireAt: expireAt})
+}
+
+func (s *MemoryStorage) FindExpiredTrees(ctx context.Context, now time.Time) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var retsz []string
+	for address, expireAt := range s.expireMap {
+		if !expireAt.After(now) {
+			retsz = append(retsz, address)
+		}
+	}
+	sort.Strings(retsz)
+
+	return retsz, nil
+}
+
+func (s *MemoryStorage) InsertTreeInfo(ctx context.Context, info *db.TreeInfo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.infoMap[info.MtAddress] != nil {
+		return db.ErrAlreadyExists
+	}
+	return s.commit(&record{Op: opPutTreeInfo, Info: info})
+}
+
+func (s *MemoryStorage) UpdateTreeInfo(ctx context.Context, info *db.TreeInfo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.infoMap[info.MtAddress] == nil {
+		return db.ErrNotFound
+	}
+	return s.commit(&record{Op: opPutTreeInfo, Info: info})
+}
+
+func (s *MemoryStorage) FindTreeInfo(ctx context.Context, address string) (*db.TreeInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	info := s.infoMap[address]
+	if info == nil {
+		return nil, db.ErrNotFound
+	}
+	infoCopy := *info
+	return &infoCopy, nil
+}
+
+func (s *MemoryStorage) ListTreeInfos(ctx context.Context) ([]*db.TreeInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var retsz []*db.TreeInfo
+	for _, info := range s.infoMap {
+		infoCopy := *info
+		retsz = append(retsz, &infoCopy)
+	}
+	sort.Slice(retsz, func(i, j int) bool { return retsz[i].MtAddress < retsz[j].MtAddress })
+
+	return retsz, nil
+}
+
+func (s *MemoryStorage) PutIntent(ctx context.Context, intent *db.AppendIntent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.commit(&record{Op: opPutIntent, Intent: intent})
+}
+
+func (s *MemoryStorage) FindIntent(ctx context.Context, address string) (*db.AppendIntent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	intent := s.intentMap[address]
+	if intent == nil {
+		return nil, db.ErrNotFound
+	}
+	intentCopy := *intent
+	return &intentCopy, nil
+}
+
+func (s *MemoryStorage) DeleteIntent(ctx context.Context, address string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.intentMap[address] == nil {
+		return nil
+	}
+	return s.commit(&record{Op: opDelIntent, Address: address})
+}
+
+func (s *MemoryStorage) AppendAudit(ctx context.Context, entry *db.AuditEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.commit(&record{Op: opAudit, Audit: entry}); err != nil {
+		return err
+	}
+	entry.Seq = uint64(len(s.auditMap[entry.MtAddress]))
+	return nil
+}
+
+func (s *MemoryStorage) FindAudit(ctx context.Context, address string, from uint64, limit int) ([]*db.AuditEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := s.auditMap[address]
+	if from == 0 {
+		from = 1
+	}
+	var retsz []*db.AuditEntry
+	for i := from - 1; i < uint64(len(entries)) && len(retsz) < limit; i++ {
+		entry := *entries[i]
+		retsz = append(retsz, &entry)
+	}
+	return retsz, nil
+}
+
+func (s *MemoryStorage) LastAudit(ctx context.Context, address string) (*db.AuditEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := s.auditMap[address]
+	if len(entries) == 0 {
+		return nil, db.ErrNotFound
+	}
+	entry := *entries[len(entries)-1]
+	return &entry, nil
+}
@@ -0,0 +1,20 @@
+package memory
+
+import (
+	"github.com/UXUYLabs/go-merkletree/db"
+	"github.com/UXUYLabs/go-merkletree/db/storagetest"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) db.Storage {
+		return NewMemoryStorage()
+	})
+}
+
+func TestMissingRoot(t *testing.T) {
+	storage := NewMemoryStorage()
+	storagetest.RunMissingRoot(t, storage, func(t *testing.T, address string, level, levelNo int) {
+		delete(storage.treeMap[address][level], levelNo)
+	})
+}
@@ -0,0 +1,480 @@
+package memory
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrCorrupted is returned by OpenMemoryStorage when a snapshot, or a log
+// record other than the last one, fails its checksum.
+var ErrCorrupted = errors.New("memory storage files are corrupted")
+
+const (
+	snapshotFile    = "snapshot"
+	walFilePattern  = "wal-%020d.log"
+	walFileGlob     = "wal-*.log"
+	frameHeaderSize = 8
+	maxFrameSize    = 1 << 30
+)
+
+// PersistOptions configures the durability of a MemoryStorage opened with
+// OpenMemoryStorage.
+type PersistOptions struct {
+	// SnapshotInterval is the period of full snapshots, 0 to only take one on Close
+	SnapshotInterval time.Duration
+	// SyncWrites fsyncs the log on every write. Without it the last writes
+	// survive a crash of the process but not of the machine.
+	SyncWrites bool
+}
+
+type op string
+
+const (
+	opInsert      op = "insert"
+	opUpdate      op = "update"
+	opDeleteTree  op = "deleteTree"
+	opExpireTree  op = "expireTree"
+	opPutTreeInfo op = "putTreeInfo"
+	opRemoveNodes op = "removeNodes"
+	opPutIntent   op = "putIntent"
+	opDelIntent   op = "deleteIntent"
+	opAudit       op = "audit"
+)
+
+// record is one write-ahead log entry, one per mutating call.
+type record struct {
+	Seq      uint64
+	Time     time.Time
+	Op       op
+	Nodes    []*db.TreeNode `json:",omitempty"`
+	Poses    []*db.NodePos  `json:",omitempty"`
+	Address  string         `json:",omitempty"`
+	ExpireAt time.Time
+	Info     *db.TreeInfo     `json:",omitempty"`
+	Intent   *db.AppendIntent `json:",omitempty"`
+	Audit    *db.AuditEntry   `json:",omitempty"`
+}
+
+// snapshot is the whole content of a storage as of the record Seq.
+type snapshot struct {
+	Seq     uint64
+	Nodes   []*db.TreeNode
+	Metas   []*db.TreeMeta
+	Expires map[string]time.Time
+	Infos   []*db.TreeInfo
+	Intents []*db.AppendIntent
+	Audits  []*db.AuditEntry
+}
+
+// OpenMemoryStorage returns a MemoryStorage persisted in dir. It loads the
+// latest snapshot and replays the write-ahead log written since, then logs
+// every write before applying it. A record torn by a crash at the end of the
+// log is discarded. Call Close to stop it.
+func OpenMemoryStorage(dir string, opts PersistOptions) (*MemoryStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := NewMemoryStorage()
+	seq, err := s.loadSnapshot(filepath.Join(dir, snapshotFile))
+	if err != nil {
+		return nil, err
+	}
+
+	seq, err = s.replay(dir, seq)
+	if err != nil {
+		return nil, err
+	}
+
+	s.wal = &wal{dir: dir, seq: seq, sync: opts.SyncWrites, done: make(chan struct{})}
+	if err = s.wal.openSegment(seq + 1); err != nil {
+		return nil, err
+	}
+
+	if opts.SnapshotInterval > 0 {
+		s.wal.stopped = make(chan struct{})
+		go s.snapshotLoop(opts.SnapshotInterval)
+	}
+	return s, nil
+}
+
+// TreeAddresses returns the address of every tree holding nodes, sorted.
+func (s *MemoryStorage) TreeAddresses() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var retsz []string
+	for address := range s.metaMap {
+		retsz = append(retsz, address)
+	}
+	sort.Strings(retsz)
+	return retsz
+}
+
+// Snapshot writes the whole storage to its snapshot file and drops the log
+// segments it covers. It is a no-op for a storage which is not persistent.
+func (s *MemoryStorage) Snapshot() error {
+	if s.wal == nil {
+		return nil
+	}
+	s.wal.snapshotMu.Lock()
+	defer s.wal.snapshotMu.Unlock()
+
+	// 持有读锁时写入被阻塞，快照与日志切换在同一时刻
+	s.mu.RLock()
+	state := s.snapshotState()
+	err := s.wal.openSegment(state.Seq + 1)
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err = writeFileAtomic(filepath.Join(s.wal.dir, snapshotFile), frame(data)); err != nil {
+		fmt.Printf("Snapshot write err. err:%+v\n", err)
+		return err
+	}
+
+	return s.wal.removeSegmentsBefore(state.Seq + 1)
+}
+
+// Close takes a last snapshot and closes the log. The storage must not be
+// written to afterwards.
+func (s *MemoryStorage) Close() error {
+	if s.wal == nil {
+		return nil
+	}
+
+	close(s.wal.done)
+	if s.wal.stopped != nil {
+		<-s.wal.stopped
+	}
+
+	err := s.Snapshot()
+	if closeErr := s.wal.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (s *MemoryStorage) snapshotLoop(interval time.Duration) {
+	defer close(s.wal.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.wal.done:
+			return
+		case <-ticker.C:
+			if err := s.Snapshot(); err != nil {
+				fmt.Printf("snapshotLoop Snapshot err. err:%+v\n", err)
+			}
+		}
+	}
+}
+
+func (s *MemoryStorage) snapshotState() *snapshot {
+	state := &snapshot{Seq: s.wal.seq, Expires: make(map[string]time.Time)}
+	for _, tree := range s.treeMap {
+		for _, levelMap := range tree {
+			for _, node := range levelMap {
+				state.Nodes = append(state.Nodes, node)
+			}
+		}
+	}
+	// 元数据会被原地修改，需要复制；节点与登记记录写入时整体替换
+	for _, meta := range s.metaMap {
+		metaCopy := *meta
+		state.Metas = append(state.Metas, &metaCopy)
+	}
+	for address, expireAt := range s.expireMap {
+		state.Expires[address] = expireAt
+	}
+	for _, info := range s.infoMap {
+		state.Infos = append(state.Infos, info)
+	}
+	for _, intent := range s.intentMap {
+		state.Intents = append(state.Intents, intent)
+	}
+	for _, entries := range s.auditMap {
+		state.Audits = append(state.Audits, entries...)
+	}
+	return state
+}
+
+func (s *MemoryStorage) loadSnapshot(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	data, err := readFrame(bufio.NewReader(f))
+	if err != nil {
+		return 0, fmt.Errorf("%w: snapshot: %v", ErrCorrupted, err)
+	}
+
+	var state snapshot
+	if err = json.Unmarshal(data, &state); err != nil {
+		return 0, fmt.Errorf("%w: snapshot: %v", ErrCorrupted, err)
+	}
+
+	for _, node := range state.Nodes {
+		s.insert(node, time.Time{})
+	}
+	for _, meta := range state.Metas {
+		s.metaMap[meta.MtAddress] = meta
+	}
+	for address, expireAt := range state.Expires {
+		s.expireMap[address] = expireAt
+	}
+	for _, info := range state.Infos {
+		s.infoMap[info.MtAddress] = info
+	}
+	for _, intent := range state.Intents {
+		s.intentMap[intent.MtAddress] = intent
+	}
+	// 同一棵树的记录按序号顺序保存
+	for _, entry := range state.Audits {
+		s.auditMap[entry.MtAddress] = append(s.auditMap[entry.MtAddress], entry)
+	}
+	return state.Seq, nil
+}
+
+// replay applies the records of every log segment newer than seq, and
+// returns the sequence number of the last one.
+func (s *MemoryStorage) replay(dir string, seq uint64) (uint64, error) {
+	segments, err := filepath.Glob(filepath.Join(dir, walFileGlob))
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(segments)
+
+	for i, path := range segments {
+		last := i == len(segments)-1
+		if seq, err = s.replaySegment(path, seq, last); err != nil {
+			return 0, err
+		}
+	}
+	return seq, nil
+}
+
+func (s *MemoryStorage) replaySegment(path string, seq uint64, last bool) (uint64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		data, err := readFrame(r)
+		if err == io.EOF {
+			return seq, nil
+		}
+		if err != nil {
+			if !last {
+				return 0, fmt.Errorf("%w: %s at offset %d: %v", ErrCorrupted, filepath.Base(path), offset, err)
+			}
+			// 崩溃时写了一半的记录，截断后继续
+			fmt.Printf("replaySegment truncate torn record. path:%s offset:%d err:%+v\n", path, offset, err)
+			return seq, f.Truncate(offset)
+		}
+
+		var rec record
+		if err = json.Unmarshal(data, &rec); err != nil {
+			return 0, fmt.Errorf("%w: %s at offset %d: %v", ErrCorrupted, filepath.Base(path), offset, err)
+		}
+		offset += int64(frameHeaderSize + len(data))
+
+		// 快照已包含的记录
+		if rec.Seq <= seq {
+			continue
+		}
+		s.apply(&rec)
+		seq = rec.Seq
+	}
+}
+
+// wal is the write-ahead log of a persistent MemoryStorage, split in segments
+// named after the first sequence number they may hold.
+type wal struct {
+	dir  string
+	seq  uint64
+	sync bool
+	file segment
+	// torn is set when a failed append could not be cut off, records appended
+	// after it would be lost on replay
+	torn error
+
+	snapshotMu sync.Mutex
+	done       chan struct{}
+	stopped    chan struct{}
+}
+
+// segment is the open log segment, an *os.File opened for appending.
+type segment interface {
+	io.Writer
+	Name() string
+	Stat() (os.FileInfo, error)
+	Truncate(size int64) error
+	Seek(offset int64, whence int) (int64, error)
+	Sync() error
+	Close() error
+}
+
+// append writes rec at the end of the log. A record failing to be written or
+// synced is cut off, so the records appended after it stay readable.
+func (w *wal) append(rec *record) error {
+	if w.torn != nil {
+		return w.torn
+	}
+	rec.Seq = w.seq + 1
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	info, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err = w.file.Write(frame(data)); err == nil && w.sync {
+		err = w.file.Sync()
+	}
+	if err != nil {
+		w.truncate(info.Size())
+		return err
+	}
+	w.seq = rec.Seq
+	return nil
+}
+
+// truncate cuts the segment back to size after a failed append.
+func (w *wal) truncate(size int64) {
+	err := w.file.Truncate(size)
+	if err == nil {
+		_, err = w.file.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		fmt.Printf("wal truncate err. err:%+v\n", err)
+		w.torn = fmt.Errorf("torn record left in %s: %w", filepath.Base(w.file.Name()), err)
+	}
+}
+
+// openSegment switches to the segment starting at seq. A segment which
+// already exists is appended to.
+func (w *wal) openSegment(seq uint64) error {
+	path := filepath.Join(w.dir, fmt.Sprintf(walFilePattern, seq))
+	if w.file != nil && w.file.Name() == path {
+		return nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if err = w.close(); err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	return nil
+}
+
+func (w *wal) removeSegmentsBefore(seq uint64) error {
+	segments, err := filepath.Glob(filepath.Join(w.dir, walFileGlob))
+	if err != nil {
+		return err
+	}
+
+	keep := fmt.Sprintf(walFilePattern, seq)
+	for _, path := range segments {
+		if filepath.Base(path) < keep {
+			if err = os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (w *wal) close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Sync()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.file = nil
+	return err
+}
+
+// frame prefixes data with its length and CRC-32.
+func frame(data []byte) []byte {
+	buf := make([]byte, frameHeaderSize, frameHeaderSize+len(data))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(data))
+	return append(buf, data...)
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errors.New("short record header")
+		}
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > maxFrameSize {
+		return nil, errors.New("record too large")
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, errors.New("short record")
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, errors.New("checksum mismatch")
+	}
+	return data, nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,186 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"github.com/UXUYLabs/go-merkletree/db/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPersistentConformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) db.Storage {
+		s, err := OpenMemoryStorage(t.TempDir(), PersistOptions{})
+		require.Nil(t, err)
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func node(address string, level, no int) *db.TreeNode {
+	node := &db.TreeNode{MtAddress: address, Hash: fmt.Sprintf("%064x", level<<16|no), Level: level, LevelNo: no}
+	if level == 0 {
+		node.Data = fmt.Sprintf("0x%040x", no+1)
+	}
+	return node
+}
+
+// dump returns everything a storage holds about address.
+func dump(t *testing.T, s *MemoryStorage, address string) []interface{} {
+	ctx := context.Background()
+	var ret []interface{}
+	for level := 0; ; level++ {
+		nodes, err := s.FindNodesByLevel(ctx, address, level)
+		if err == db.ErrNotFound {
+			break
+		}
+		require.Nil(t, err)
+		ret = append(ret, nodes)
+	}
+	meta, err := s.FindTreeMeta(ctx, address)
+	if err == nil {
+		meta.UpdatedAt = meta.UpdatedAt.UTC()
+	}
+	info, _ := s.FindTreeInfo(ctx, address)
+	return append(ret, meta, info)
+}
+
+func TestPersistRecovery(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := OpenMemoryStorage(dir, PersistOptions{SyncWrites: true})
+	require.Nil(t, err)
+	require.Nil(t, s.InsertTreeInfo(ctx, &db.TreeInfo{MtAddress: "tree", CreatedAt: time.Unix(1700000000, 0).UTC(), Hasher: "keccak256"}))
+	require.Nil(t, s.WriteNodes(ctx, []*db.TreeNode{node("tree", 0, 0), node("tree", 0, 1), node("tree", 1, 0)}))
+	require.Nil(t, s.Insert(ctx, node("gone", 0, 0)))
+	require.Nil(t, s.Snapshot())
+
+	updated := node("tree", 1, 0)
+	updated.Hash = fmt.Sprintf("%064x", 99)
+	require.Nil(t, s.Update(ctx, updated))
+	require.Nil(t, s.Insert(ctx, node("tree", 0, 2)))
+	require.Nil(t, s.DeleteTree(ctx, "gone"))
+	require.Nil(t, s.ExpireTree(ctx, "tree", time.Unix(1800000000, 0)))
+	want := dump(t, s, "tree")
+
+	// 不调用Close，模拟进程崩溃：快照之后的写入从日志恢复
+	recovered, err := OpenMemoryStorage(dir, PersistOptions{})
+	require.Nil(t, err)
+	assert.Equal(t, want, dump(t, recovered, "tree"))
+	assert.Equal(t, []string{"tree"}, recovered.TreeAddresses())
+	expired, err := recovered.FindExpiredTrees(ctx, time.Unix(1900000000, 0))
+	require.Nil(t, err)
+	assert.Equal(t, []string{"tree"}, expired)
+
+	// 关闭时写入快照并清理日志
+	require.Nil(t, recovered.Insert(ctx, node("tree", 1, 1)))
+	want = dump(t, recovered, "tree")
+	require.Nil(t, recovered.Close())
+	segments, err := filepath.Glob(filepath.Join(dir, walFileGlob))
+	require.Nil(t, err)
+	assert.Len(t, segments, 1)
+
+	reopened, err := OpenMemoryStorage(dir, PersistOptions{})
+	require.Nil(t, err)
+	assert.Equal(t, want, dump(t, reopened, "tree"))
+	require.Nil(t, reopened.Close())
+}
+
+func TestPersistTornRecord(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := OpenMemoryStorage(dir, PersistOptions{})
+	require.Nil(t, err)
+	require.Nil(t, s.Insert(ctx, node("tree", 0, 0)))
+	require.Nil(t, s.Insert(ctx, node("tree", 0, 1)))
+
+	// 最后一条记录只写了一半
+	segments, err := filepath.Glob(filepath.Join(dir, walFileGlob))
+	require.Nil(t, err)
+	path := segments[len(segments)-1]
+	data, err := os.ReadFile(path)
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(path, data[:len(data)-5], 0o644))
+
+	recovered, err := OpenMemoryStorage(dir, PersistOptions{})
+	require.Nil(t, err)
+	maxNo, err := recovered.FindMaxNoOfLeaf(ctx, "tree")
+	require.Nil(t, err)
+	assert.Equal(t, 0, maxNo)
+
+	require.Nil(t, recovered.Insert(ctx, node("tree", 0, 1)))
+	require.Nil(t, recovered.Close())
+
+	// 快照损坏时拒绝启动
+	data, err = os.ReadFile(filepath.Join(dir, snapshotFile))
+	require.Nil(t, err)
+	data[len(data)-2] ^= 0xff
+	require.Nil(t, os.WriteFile(filepath.Join(dir, snapshotFile), data, 0o644))
+	_, err = OpenMemoryStorage(dir, PersistOptions{})
+	assert.ErrorIs(t, err, ErrCorrupted)
+}
+
+// shortSegment writes only the first half of a record while failing is set.
+type shortSegment struct {
+	segment
+	failing bool
+}
+
+func (f *shortSegment) Write(p []byte) (int, error) {
+	if !f.failing {
+		return f.segment.Write(p)
+	}
+	n, err := f.segment.Write(p[:len(p)/2])
+	if err == nil {
+		err = io.ErrShortWrite
+	}
+	return n, err
+}
+
+func TestPersistShortWrite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := OpenMemoryStorage(dir, PersistOptions{})
+	require.Nil(t, err)
+	require.Nil(t, s.Insert(ctx, node("tree", 0, 0)))
+
+	// 写入失败的记录被截掉，之后的记录仍可恢复
+	short := &shortSegment{segment: s.wal.file, failing: true}
+	s.wal.file = short
+	assert.ErrorIs(t, s.Insert(ctx, node("tree", 0, 1)), io.ErrShortWrite)
+	short.failing = false
+	require.Nil(t, s.Insert(ctx, node("tree", 0, 2)))
+	require.Nil(t, s.Insert(ctx, node("tree", 0, 3)))
+	want := dump(t, s, "tree")
+
+	recovered, err := OpenMemoryStorage(dir, PersistOptions{})
+	require.Nil(t, err)
+	assert.Equal(t, want, dump(t, recovered, "tree"))
+	_, err = recovered.FindOneByLeafData(ctx, "tree", node("tree", 0, 1).Data)
+	assert.Equal(t, db.ErrNotFound, err)
+	require.Nil(t, recovered.Close())
+}
+
+func TestPersistPeriodicSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := OpenMemoryStorage(dir, PersistOptions{SnapshotInterval: 10 * time.Millisecond})
+	require.Nil(t, err)
+	defer s.Close()
+
+	require.Nil(t, s.Insert(ctx, node("tree", 0, 0)))
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, snapshotFile))
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+}
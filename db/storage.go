@@ -4,12 +4,21 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"reflect"
+	"time"
 )
 
 // ErrNotFound is used by the implementations of the interface db.Storage for
 // when a key is not found in the storage
 var ErrNotFound = errors.New("key not found")
 
+// ErrAlreadyExists is returned when inserting a record whose key is taken.
+var ErrAlreadyExists = errors.New("key already exists")
+
+// ErrNotSupported is returned by a decorator whose backend lacks an optional
+// capability such as NodeRemover.
+var ErrNotSupported = errors.New("operation not supported by the storage")
+
 type TreeNode struct {
 	MtAddress string
 	Data      string
@@ -23,6 +32,44 @@ type NodePos struct {
 	LevelNo int
 }
 
+// TreeInfo is the registry record of a tree.
+type TreeInfo struct {
+	MtAddress  string
+	CreatedAt  time.Time
+	Hasher     string
+	LeafSchema string
+	Sealed     bool
+}
+
+// TreeMeta summarizes a tree. A MetaStore maintains it on every write, so the
+// root and the leaf count of a tree are found without scanning its nodes.
+type TreeMeta struct {
+	MtAddress string
+	// LeafCount is the highest LevelNo of level 0 plus one
+	LeafCount int
+	// Depth is the number of levels, leaves included
+	Depth       int
+	RootLevel   int
+	RootLevelNo int
+	RootHash    string
+	UpdatedAt   time.Time
+}
+
+// Apply records a written node. The root is the node of the highest level,
+// the one with the highest LevelNo when that level holds several.
+func (m *TreeMeta) Apply(node *TreeNode, now time.Time) {
+	if node.Level == 0 && node.LevelNo+1 > m.LeafCount {
+		m.LeafCount = node.LevelNo + 1
+	}
+	if m.Depth == 0 || node.Level > m.RootLevel || (node.Level == m.RootLevel && node.LevelNo >= m.RootLevelNo) {
+		m.Depth = node.Level + 1
+		m.RootLevel = node.Level
+		m.RootLevelNo = node.LevelNo
+		m.RootHash = node.Hash
+	}
+	m.UpdatedAt = now
+}
+
 type Storage interface {
 	Insert(ctx context.Context, node *TreeNode) error
 	Update(ctx context.Context, node *TreeNode) error
@@ -33,6 +80,179 @@ type Storage interface {
 	FindNodesByLevel(ctx context.Context, address string, level int) ([]*TreeNode, error)
 }
 
+// Wrapper is implemented by storage decorators. A decorator implements every
+// optional interface of db, and its methods return ErrNotSupported when the
+// storage it wraps, returned by Unwrap, lacks the interface. Ask Supports
+// whether such a storage has an optional interface.
+type Wrapper interface {
+	Storage
+	Unwrap() Storage
+}
+
+var txStorageType = reflect.TypeOf((*TxStorage)(nil)).Elem()
+
+// Supports reports whether s supports the optional interface iface points
+// to, e.g. Supports(s, (*AuditLog)(nil)): whether s implements it and, for a
+// Wrapper, whether the storage it wraps supports it. Decorators run
+// transactions over a wrapped BatchWriter as well.
+func Supports(s Storage, iface interface{}) bool {
+	typ := reflect.TypeOf(iface).Elem()
+	for {
+		if !reflect.TypeOf(s).Implements(typ) {
+			return false
+		}
+		wrapper, ok := s.(Wrapper)
+		if !ok {
+			return true
+		}
+		s = wrapper.Unwrap()
+		if typ == txStorageType && Supports(s, (*BatchWriter)(nil)) {
+			return true
+		}
+	}
+}
+
+// MetaStore is implemented by storages maintaining the TreeMeta of each tree.
+type MetaStore interface {
+	// FindTreeMeta returns the metadata of a tree, or ErrNotFound for a tree without nodes.
+	FindTreeMeta(ctx context.Context, address string) (*TreeMeta, error)
+	// ListTrees returns the address of every tree holding nodes, registered
+	// or not, sorted.
+	ListTrees(ctx context.Context) ([]string, error)
+}
+
+// FindTreeMeta returns the metadata of a tree kept by a MetaStore. For other
+// storages it is derived from FindRootNode and FindMaxNoOfLeaf, UpdatedAt
+// being left zero. It returns ErrNotFound for a tree without nodes.
+func FindTreeMeta(ctx context.Context, s Storage, address string) (*TreeMeta, error) {
+	if Supports(s, (*MetaStore)(nil)) {
+		return s.(MetaStore).FindTreeMeta(ctx, address)
+	}
+
+	root, err := s.FindRootNode(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	meta := &TreeMeta{
+		MtAddress:   address,
+		Depth:       root.Level + 1,
+		RootLevel:   root.Level,
+		RootLevelNo: root.LevelNo,
+		RootHash:    root.Hash,
+	}
+	maxNo, err := s.FindMaxNoOfLeaf(ctx, address)
+	if err == nil {
+		meta.LeafCount = maxNo + 1
+	} else if err != ErrNotFound {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// TreeRegistry is implemented by storages keeping a record of each tree,
+// which creating, listing and sealing trees need.
+type TreeRegistry interface {
+	// InsertTreeInfo registers a tree, or returns ErrAlreadyExists.
+	InsertTreeInfo(ctx context.Context, info *TreeInfo) error
+	// UpdateTreeInfo replaces the record of a registered tree, or returns ErrNotFound.
+	UpdateTreeInfo(ctx context.Context, info *TreeInfo) error
+	FindTreeInfo(ctx context.Context, address string) (*TreeInfo, error)
+	// ListTreeInfos returns every registered tree ordered by address.
+	ListTreeInfos(ctx context.Context) ([]*TreeInfo, error)
+}
+
+// TreeDeleter is implemented by storages able to delete whole trees, which
+// deleting, expiring and garbage collecting trees need.
+type TreeDeleter interface {
+	// DeleteTree removes every node, leaf index entry and record, metadata
+	// and registry record included, of a tree.
+	// Deleting an unknown tree is not an error, and an interrupted deletion
+	// can be completed by calling DeleteTree again.
+	DeleteTree(ctx context.Context, address string) error
+	// ExpireTree marks a tree for garbage collection once expireAt has passed.
+	ExpireTree(ctx context.Context, address string, expireAt time.Time) error
+	// FindExpiredTrees returns the trees expired at now, and the trees whose
+	// deletion was started but not completed.
+	FindExpiredTrees(ctx context.Context, now time.Time) ([]string, error)
+}
+
+// AppendIntent records a batch of appends in progress on a tree. It is
+// written before the batch touches any node and removed once it has completed.
+type AppendIntent struct {
+	MtAddress string
+	// Leaves are the leaves of the batch as given, in order, leaves already
+	// in the tree included. The batch skips those, so recovery takes the
+	// leaves stored from LevelNo on, at most len(Leaves) of them
+	Leaves []string
+	// LevelNo is the position the first leaf appended takes
+	LevelNo int
+	// OldRoot and Actor are recorded in the audit log with the batch
+	OldRoot   string
+	Actor     string
+	CreatedAt time.Time
+}
+
+// IntentJournal is implemented by storages able to record append intents, so
+// that an append interrupted by a crash is detected and completed or undone.
+// A tree has at most one intent, appends to a tree being exclusive.
+type IntentJournal interface {
+	// PutIntent records the intent of a tree, replacing any previous one.
+	PutIntent(ctx context.Context, intent *AppendIntent) error
+	// FindIntent returns the intent of a tree, or ErrNotFound.
+	FindIntent(ctx context.Context, address string) (*AppendIntent, error)
+	// DeleteIntent removes the intent of a tree, if any.
+	DeleteIntent(ctx context.Context, address string) error
+}
+
+// AuditOp is the kind of mutation an AuditEntry records.
+type AuditOp string
+
+const (
+	AuditCreate  AuditOp = "create"
+	AuditAppend  AuditOp = "append"
+	AuditSeal    AuditOp = "seal"
+	AuditRebuild AuditOp = "rebuild"
+	AuditDelete  AuditOp = "delete"
+)
+
+// AuditEntry is one mutation in the history of a tree.
+type AuditEntry struct {
+	MtAddress string
+	// Seq numbers the entries of a tree from 1, it is set by AppendAudit
+	Seq uint64
+	Op  AuditOp
+	// Leaves are the leaves appended by one batch in order, and LeafIndex
+	// the index of the first one; LeafIndex is -1 for other operations
+	Leaves    []string
+	LeafIndex int
+	OldRoot   string
+	NewRoot   string
+	Time      time.Time
+	// Actor is who made the mutation, empty when unknown
+	Actor string
+}
+
+// AuditLog is implemented by storages keeping an append-only history of the
+// mutations of each tree. The history of a tree outlives DeleteTree.
+type AuditLog interface {
+	// AppendAudit adds entry to the history of its tree and sets its Seq.
+	AppendAudit(ctx context.Context, entry *AuditEntry) error
+	// FindAudit returns at most limit entries of a tree in order, starting
+	// with the entry numbered from.
+	FindAudit(ctx context.Context, address string, from uint64, limit int) ([]*AuditEntry, error)
+	// LastAudit returns the latest entry of a tree, or ErrNotFound.
+	LastAudit(ctx context.Context, address string) (*AuditEntry, error)
+}
+
+// NodeRemover is implemented by storages able to remove single nodes, which
+// repairing a tree needs.
+type NodeRemover interface {
+	// RemoveNodes deletes the nodes at poses, with the leaf index entries
+	// still referring to them, then recomputes the metadata of the tree from
+	// the nodes left. Positions without a node are ignored.
+	RemoveNodes(ctx context.Context, address string, poses []*NodePos) error
+}
+
 func (tn *TreeNode) ToString() string {
 	jsonStr, err := json.Marshal(tn)
 	if err != nil {
@@ -41,3 +261,18 @@ func (tn *TreeNode) ToString() string {
 
 	return string(jsonStr)
 }
+
+// Clone returns a copy of the node so callers can modify it freely.
+func (tn *TreeNode) Clone() *TreeNode {
+	if tn == nil {
+		return nil
+	}
+
+	node := *tn
+	return &node
+}
+
+// IsLeaf reports whether the node is a data leaf at level 0.
+func (tn *TreeNode) IsLeaf() bool {
+	return tn.Level == 0 && tn.Data != ""
+}
@@ -0,0 +1,709 @@
+// Package storagetest is a conformance suite for db.Storage implementations.
+//
+// A backend passes when, from the test file of its own package:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.RunConformance(t, func(t *testing.T) db.Storage {
+//			return NewMyStorage()
+//		})
+//	}
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// Factory returns an empty storage. It is called once per sub test.
+type Factory func(t *testing.T) db.Storage
+
+const (
+	treeA = "conformance-a"
+	treeB = "conformance-b"
+)
+
+// RunConformance checks the contract every db.Storage must honour:
+//
+//   - every lookup on an unknown tree returns db.ErrNotFound, and
+//     FindMaxNoOfLeaf returns -1 with it;
+//   - FindRootNode returns the node of the highest level, the one with the
+//     highest LevelNo when that level holds several;
+//   - FindMaxNoOfLeaf returns the highest LevelNo of level 0;
+//   - FindOneByLeafData only finds leaves, never branch nodes;
+//   - FindMultiTreeNode returns the nodes that exist in the requested order,
+//     skipping missing positions, and db.ErrNotFound only when none exist;
+//   - FindNodesByLevel returns the level ordered by LevelNo, db.ErrNotFound
+//     when the level is empty;
+//   - Update replaces an existing node and returns db.ErrNotFound otherwise;
+//   - nodes are stored and returned by value: changing a node after Insert,
+//     or a returned node, does not change the stored one;
+//   - trees are isolated from each other by address;
+//   - calls made with a cancelled context fail and write nothing.
+//
+// Storages implementing db.TreeDeleter are also checked for deletion: DeleteTree
+// removes a tree and its expiry mark, leaves other trees untouched and accepts
+// unknown trees, and FindExpiredTrees returns, sorted, the trees whose expiry
+// has passed. Storages implementing db.MetaStore are checked to agree in
+// FindTreeMeta with FindRootNode and FindMaxNoOfLeaf after every write, to
+// return db.ErrNotFound for a tree without nodes, and to list in ListTrees
+// the trees holding nodes. Storages implementing
+// db.TreeRegistry are checked to refuse a
+// registered address in InsertTreeInfo with db.ErrAlreadyExists and an unknown
+// one in UpdateTreeInfo with db.ErrNotFound, and to list the registry ordered
+// by address. Storages implementing db.TxStorage are checked for transaction
+// visibility, commit and rollback. For a db.Wrapper, an optional interface is
+// only checked when db.Supports reports it supported.
+func RunConformance(t *testing.T, factory Factory) {
+	t.Run("EmptyTree", func(t *testing.T) { testEmptyTree(t, factory(t)) })
+	t.Run("RootNode", func(t *testing.T) { testRootNode(t, factory(t)) })
+	t.Run("MaxNoOfLeaf", func(t *testing.T) { testMaxNoOfLeaf(t, factory(t)) })
+	t.Run("LeafData", func(t *testing.T) { testLeafData(t, factory(t)) })
+	t.Run("MultiTreeNode", func(t *testing.T) { testMultiTreeNode(t, factory(t)) })
+	t.Run("NodesByLevel", func(t *testing.T) { testNodesByLevel(t, factory(t)) })
+	t.Run("Update", func(t *testing.T) { testUpdate(t, factory(t)) })
+	t.Run("TreeMeta", func(t *testing.T) {
+		if !db.Supports(factory(t), (*db.MetaStore)(nil)) {
+			t.Skip("storage does not support db.MetaStore")
+		}
+		testTreeMeta(t, factory(t))
+	})
+	t.Run("ValueSemantics", func(t *testing.T) { testValueSemantics(t, factory(t)) })
+	t.Run("Isolation", func(t *testing.T) { testIsolation(t, factory(t)) })
+	t.Run("Cancelled", func(t *testing.T) { testCancelled(t, factory(t)) })
+	t.Run("DeleteTree", func(t *testing.T) {
+		if !db.Supports(factory(t), (*db.TreeDeleter)(nil)) {
+			t.Skip("storage does not support db.TreeDeleter")
+		}
+		testDeleteTree(t, factory(t))
+	})
+	t.Run("ExpiredTrees", func(t *testing.T) {
+		if !db.Supports(factory(t), (*db.TreeDeleter)(nil)) {
+			t.Skip("storage does not support db.TreeDeleter")
+		}
+		testExpiredTrees(t, factory(t))
+	})
+	t.Run("Registry", func(t *testing.T) {
+		if !db.Supports(factory(t), (*db.TreeRegistry)(nil)) {
+			t.Skip("storage does not support db.TreeRegistry")
+		}
+		testRegistry(t, factory(t).(db.TreeRegistry))
+	})
+
+	t.Run("RemoveNodes", func(t *testing.T) {
+		if !db.Supports(factory(t), (*db.NodeRemover)(nil)) {
+			t.Skip("storage does not support db.NodeRemover")
+		}
+		testRemoveNodes(t, factory(t))
+	})
+
+	t.Run("Intents", func(t *testing.T) {
+		if !db.Supports(factory(t), (*db.IntentJournal)(nil)) {
+			t.Skip("storage does not support db.IntentJournal")
+		}
+		testIntents(t, factory(t))
+	})
+
+	t.Run("Audit", func(t *testing.T) {
+		if !db.Supports(factory(t), (*db.AuditLog)(nil)) {
+			t.Skip("storage does not support db.AuditLog")
+		}
+		testAudit(t, factory(t))
+	})
+
+	t.Run("Tx", func(t *testing.T) {
+		if !db.Supports(factory(t), (*db.TxStorage)(nil)) {
+			t.Skip("storage does not support db.TxStorage")
+		}
+		t.Run("Visibility", func(t *testing.T) { testTxVisibility(t, factory(t).(db.TxStorage)) })
+		t.Run("Rollback", func(t *testing.T) { testTxRollback(t, factory(t).(db.TxStorage)) })
+	})
+}
+
+// Dropper removes the node at level and levelNo of a tree from a storage
+// without updating the metadata of the tree, as a write interrupted between
+// the two would leave it.
+type Dropper func(t *testing.T, address string, level, levelNo int)
+
+// RunMissingRoot checks that FindRootNode of s, a db.MetaStore, returns
+// db.ErrNotFound when the metadata of a tree names a root node that drop has
+// removed, as the other lookups do for a missing node.
+func RunMissingRoot(t *testing.T, s db.Storage, drop Dropper) {
+	ctx := context.Background()
+
+	insertTree(t, s, treeA, 5)
+	root, err := s.FindRootNode(ctx, treeA)
+	require.Nil(t, err)
+	drop(t, treeA, root.Level, root.LevelNo)
+
+	_, err = s.FindRootNode(ctx, treeA)
+	assert.Equal(t, db.ErrNotFound, err)
+}
+
+func leaf(address string, no int) *db.TreeNode {
+	return &db.TreeNode{
+		MtAddress: address,
+		Data:      fmt.Sprintf("0x%040x", no+1),
+		Hash:      fmt.Sprintf("%064x", no+1),
+		Level:     0,
+		LevelNo:   no,
+	}
+}
+
+func branch(address string, level, no int) *db.TreeNode {
+	return &db.TreeNode{
+		MtAddress: address,
+		Hash:      fmt.Sprintf("%060x%02x%02x", 0, level, no),
+		Level:     level,
+		LevelNo:   no,
+	}
+}
+
+// insertTree stores a complete tree of n leaves the way the engine lays it out.
+func insertTree(t *testing.T, s db.Storage, address string, n int) {
+	ctx := context.Background()
+	for i := 0; i < n; i++ {
+		require.Nil(t, s.Insert(ctx, leaf(address, i)))
+	}
+	for level, width := 1, n; width > 1; level++ {
+		width = (width + 1) / 2
+		for i := 0; i < width; i++ {
+			require.Nil(t, s.Insert(ctx, branch(address, level, i)))
+		}
+	}
+}
+
+func testEmptyTree(t *testing.T, s db.Storage) {
+	ctx := context.Background()
+
+	root, err := s.FindRootNode(ctx, treeA)
+	assert.Equal(t, db.ErrNotFound, err)
+	assert.Nil(t, root)
+
+	maxNo, err := s.FindMaxNoOfLeaf(ctx, treeA)
+	assert.Equal(t, db.ErrNotFound, err)
+	assert.Equal(t, -1, maxNo)
+
+	_, err = s.FindOneByLeafData(ctx, treeA, leaf(treeA, 0).Data)
+	assert.Equal(t, db.ErrNotFound, err)
+
+	_, err = s.FindMultiTreeNode(ctx, treeA, []*db.NodePos{{Level: 0, LevelNo: 0}})
+	assert.Equal(t, db.ErrNotFound, err)
+
+	_, err = s.FindNodesByLevel(ctx, treeA, 0)
+	assert.Equal(t, db.ErrNotFound, err)
+}
+
+func testRootNode(t *testing.T, s db.Storage) {
+	ctx := context.Background()
+
+	require.Nil(t, s.Insert(ctx, leaf(treeA, 0)))
+	root, err := s.FindRootNode(ctx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, leaf(treeA, 0), root)
+
+	insertTree(t, s, treeA, 5)
+	root, err = s.FindRootNode(ctx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, branch(treeA, 3, 0), root)
+
+	// 同层有多个节点时取序号最大的
+	require.Nil(t, s.Insert(ctx, branch(treeA, 3, 1)))
+	root, err = s.FindRootNode(ctx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, branch(treeA, 3, 1), root)
+}
+
+func testMaxNoOfLeaf(t *testing.T, s db.Storage) {
+	ctx := context.Background()
+
+	insertTree(t, s, treeA, 11)
+	maxNo, err := s.FindMaxNoOfLeaf(ctx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, 10, maxNo)
+}
+
+func testLeafData(t *testing.T, s db.Storage) {
+	ctx := context.Background()
+
+	insertTree(t, s, treeA, 3)
+	found, err := s.FindOneByLeafData(ctx, treeA, leaf(treeA, 1).Data)
+	require.Nil(t, err)
+	assert.Equal(t, leaf(treeA, 1), found)
+
+	// 分支节点没有数据，不能被查到
+	_, err = s.FindOneByLeafData(ctx, treeA, "")
+	assert.Equal(t, db.ErrNotFound, err)
+
+	_, err = s.FindOneByLeafData(ctx, treeA, leaf(treeA, 3).Data)
+	assert.Equal(t, db.ErrNotFound, err)
+}
+
+func testMultiTreeNode(t *testing.T, s db.Storage) {
+	ctx := context.Background()
+
+	insertTree(t, s, treeA, 3)
+	nodes, err := s.FindMultiTreeNode(ctx, treeA, []*db.NodePos{
+		{Level: 0, LevelNo: 2},
+		{Level: 0, LevelNo: 3},
+		{Level: 1, LevelNo: 1},
+		{Level: 1, LevelNo: 0},
+		{Level: 2, LevelNo: 0},
+		{Level: 3, LevelNo: 0},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, []*db.TreeNode{leaf(treeA, 2), branch(treeA, 1, 1), branch(treeA, 1, 0), branch(treeA, 2, 0)}, nodes)
+
+	_, err = s.FindMultiTreeNode(ctx, treeA, []*db.NodePos{{Level: 5, LevelNo: 0}})
+	assert.Equal(t, db.ErrNotFound, err)
+
+	_, err = s.FindMultiTreeNode(ctx, treeA, nil)
+	assert.Equal(t, db.ErrNotFound, err)
+}
+
+func testNodesByLevel(t *testing.T, s db.Storage) {
+	ctx := context.Background()
+
+	// 乱序插入，返回结果必须按序号排列
+	for _, no := range []int{3, 0, 11, 2, 1, 10} {
+		require.Nil(t, s.Insert(ctx, leaf(treeA, no)))
+	}
+
+	nodes, err := s.FindNodesByLevel(ctx, treeA, 0)
+	require.Nil(t, err)
+	var nos []int
+	for _, node := range nodes {
+		nos = append(nos, node.LevelNo)
+	}
+	assert.Equal(t, []int{0, 1, 2, 3, 10, 11}, nos)
+
+	_, err = s.FindNodesByLevel(ctx, treeA, 1)
+	assert.Equal(t, db.ErrNotFound, err)
+}
+
+func testUpdate(t *testing.T, s db.Storage) {
+	ctx := context.Background()
+
+	insertTree(t, s, treeA, 2)
+	updated := branch(treeA, 1, 0)
+	updated.Hash = fmt.Sprintf("%064x", 99)
+	require.Nil(t, s.Update(ctx, updated))
+
+	root, err := s.FindRootNode(ctx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, updated, root)
+
+	updatedLeaf := leaf(treeA, 1)
+	updatedLeaf.Hash = fmt.Sprintf("%064x", 98)
+	require.Nil(t, s.Update(ctx, updatedLeaf))
+	found, err := s.FindOneByLeafData(ctx, treeA, updatedLeaf.Data)
+	require.Nil(t, err)
+	assert.Equal(t, updatedLeaf, found)
+
+	assert.Equal(t, db.ErrNotFound, s.Update(ctx, branch(treeA, 1, 1)))
+	assert.Equal(t, db.ErrNotFound, s.Update(ctx, leaf(treeB, 0)))
+}
+
+func testTreeMeta(t *testing.T, s db.Storage) {
+	ctx := context.Background()
+	store := s.(db.MetaStore)
+
+	_, err := store.FindTreeMeta(ctx, treeA)
+	assert.Equal(t, db.ErrNotFound, err)
+	trees, err := store.ListTrees(ctx)
+	require.Nil(t, err)
+	assert.Empty(t, trees)
+
+	before := time.Now().Add(-time.Second)
+	insertTree(t, s, treeB, 2)
+	insertTree(t, s, treeA, 5)
+	trees, err = store.ListTrees(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, []string{treeA, treeB}, trees)
+	meta, err := store.FindTreeMeta(ctx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, treeA, meta.MtAddress)
+	assert.Equal(t, 5, meta.LeafCount)
+	assert.Equal(t, 4, meta.Depth)
+	assert.Equal(t, 3, meta.RootLevel)
+	assert.Equal(t, 0, meta.RootLevelNo)
+	assert.Equal(t, branch(treeA, 3, 0).Hash, meta.RootHash)
+	assert.True(t, meta.UpdatedAt.After(before))
+
+	updated := branch(treeA, 3, 0)
+	updated.Hash = fmt.Sprintf("%064x", 99)
+	require.Nil(t, s.Update(ctx, updated))
+	meta, err = store.FindTreeMeta(ctx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, updated.Hash, meta.RootHash)
+
+	// 更新非根节点不影响根
+	require.Nil(t, s.Update(ctx, branch(treeA, 1, 2)))
+	root, err := s.FindRootNode(ctx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, updated, root)
+
+	if db.Supports(s, (*db.TreeDeleter)(nil)) {
+		deleter := s.(db.TreeDeleter)
+		require.Nil(t, deleter.DeleteTree(ctx, treeA))
+		_, err = store.FindTreeMeta(ctx, treeA)
+		assert.Equal(t, db.ErrNotFound, err)
+		trees, err = store.ListTrees(ctx)
+		require.Nil(t, err)
+		assert.Equal(t, []string{treeB}, trees)
+	}
+}
+
+func testValueSemantics(t *testing.T, s db.Storage) {
+	ctx := context.Background()
+
+	node := leaf(treeA, 0)
+	require.Nil(t, s.Insert(ctx, node))
+	node.Hash = "changed after insert"
+
+	found, err := s.FindOneByLeafData(ctx, treeA, node.Data)
+	require.Nil(t, err)
+	assert.Equal(t, leaf(treeA, 0), found)
+
+	found.Hash = "changed after find"
+	again, err := s.FindRootNode(ctx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, leaf(treeA, 0), again)
+}
+
+func testIsolation(t *testing.T, s db.Storage) {
+	ctx := context.Background()
+
+	insertTree(t, s, treeA, 4)
+	insertTree(t, s, treeB, 1)
+
+	maxNo, err := s.FindMaxNoOfLeaf(ctx, treeB)
+	require.Nil(t, err)
+	assert.Equal(t, 0, maxNo)
+
+	root, err := s.FindRootNode(ctx, treeB)
+	require.Nil(t, err)
+	assert.Equal(t, leaf(treeB, 0), root)
+
+	_, err = s.FindOneByLeafData(ctx, treeB, leaf(treeA, 1).Data)
+	assert.Equal(t, db.ErrNotFound, err)
+}
+
+func testCancelled(t *testing.T, s db.Storage) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, s.Insert(ctx, leaf(treeA, 0)), context.Canceled)
+	_, err := s.FindRootNode(ctx, treeA)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = s.FindMaxNoOfLeaf(ctx, treeA)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	if db.Supports(s, (*db.BatchWriter)(nil)) {
+		writer := s.(db.BatchWriter)
+		assert.ErrorIs(t, writer.WriteNodes(ctx, []*db.TreeNode{leaf(treeA, 1)}), context.Canceled)
+	}
+
+	testEmptyTree(t, s)
+}
+
+func testDeleteTree(t *testing.T, s db.Storage) {
+	ctx := context.Background()
+	deleter := s.(db.TreeDeleter)
+
+	insertTree(t, s, treeA, 5)
+	insertTree(t, s, treeB, 3)
+	registered := db.Supports(s, (*db.TreeRegistry)(nil))
+	registry, _ := s.(db.TreeRegistry)
+	if registered {
+		require.Nil(t, registry.InsertTreeInfo(ctx, info(treeA)))
+		require.Nil(t, registry.InsertTreeInfo(ctx, info(treeB)))
+	}
+	require.Nil(t, deleter.ExpireTree(ctx, treeA, time.Now().Add(-time.Hour)))
+	require.Nil(t, deleter.DeleteTree(ctx, treeA))
+
+	testEmptyTree(t, s)
+	if registered {
+		_, err := registry.FindTreeInfo(ctx, treeA)
+		assert.Equal(t, db.ErrNotFound, err)
+		infos, err := registry.ListTreeInfos(ctx)
+		require.Nil(t, err)
+		assert.Equal(t, []*db.TreeInfo{info(treeB)}, infos)
+	}
+
+	expired, err := deleter.FindExpiredTrees(ctx, time.Now())
+	require.Nil(t, err)
+	assert.Empty(t, expired)
+
+	maxNo, err := s.FindMaxNoOfLeaf(ctx, treeB)
+	require.Nil(t, err)
+	assert.Equal(t, 2, maxNo)
+	found, err := s.FindOneByLeafData(ctx, treeB, leaf(treeB, 0).Data)
+	require.Nil(t, err)
+	assert.Equal(t, leaf(treeB, 0), found)
+
+	require.Nil(t, deleter.DeleteTree(ctx, treeA))
+	require.Nil(t, deleter.DeleteTree(ctx, "conformance-unknown"))
+}
+
+func testRemoveNodes(t *testing.T, s db.Storage) {
+	ctx := context.Background()
+	remover := s.(db.NodeRemover)
+
+	// 5个叶子的树多出一个叶子、一个分支和一个更高的根
+	insertTree(t, s, treeA, 5)
+	insertTree(t, s, treeB, 3)
+	require.Nil(t, s.Insert(ctx, leaf(treeA, 5)))
+	require.Nil(t, s.Insert(ctx, branch(treeA, 1, 3)))
+	require.Nil(t, s.Insert(ctx, branch(treeA, 4, 0)))
+
+	require.Nil(t, remover.RemoveNodes(ctx, treeA, []*db.NodePos{
+		{Level: 0, LevelNo: 5}, {Level: 1, LevelNo: 3}, {Level: 4, LevelNo: 0}, {Level: 7, LevelNo: 7},
+	}))
+
+	root, err := s.FindRootNode(ctx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, branch(treeA, 3, 0), root)
+	maxNo, err := s.FindMaxNoOfLeaf(ctx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, 4, maxNo)
+	meta, err := db.FindTreeMeta(ctx, s, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, 5, meta.LeafCount)
+	assert.Equal(t, 4, meta.Depth)
+	assert.Equal(t, branch(treeA, 3, 0).Hash, meta.RootHash)
+
+	_, err = s.FindOneByLeafData(ctx, treeA, leaf(treeA, 5).Data)
+	assert.Equal(t, db.ErrNotFound, err)
+	_, err = s.FindNodesByLevel(ctx, treeA, 4)
+	assert.Equal(t, db.ErrNotFound, err)
+	nodes, err := s.FindNodesByLevel(ctx, treeA, 1)
+	require.Nil(t, err)
+	assert.Len(t, nodes, 3)
+
+	// 其他树不受影响
+	root, err = s.FindRootNode(ctx, treeB)
+	require.Nil(t, err)
+	assert.Equal(t, branch(treeB, 2, 0), root)
+
+	// 新写入的节点继续维护元数据
+	require.Nil(t, s.Insert(ctx, leaf(treeA, 5)))
+	maxNo, err = s.FindMaxNoOfLeaf(ctx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, 5, maxNo)
+}
+
+func testIntents(t *testing.T, s db.Storage) {
+	ctx := context.Background()
+	journal := s.(db.IntentJournal)
+
+	_, err := journal.FindIntent(ctx, treeA)
+	assert.Equal(t, db.ErrNotFound, err)
+	require.Nil(t, journal.DeleteIntent(ctx, treeA))
+
+	intent := &db.AppendIntent{MtAddress: treeA, Leaves: []string{leaf(treeA, 0).Data}, CreatedAt: time.Unix(1700000000, 0).UTC()}
+	require.Nil(t, journal.PutIntent(ctx, intent))
+	next := &db.AppendIntent{MtAddress: treeA, Leaves: []string{leaf(treeA, 1).Data, leaf(treeA, 2).Data}, LevelNo: 1, CreatedAt: time.Unix(1700000001, 0).UTC()}
+	require.Nil(t, journal.PutIntent(ctx, next))
+	require.Nil(t, journal.PutIntent(ctx, &db.AppendIntent{MtAddress: treeB, Leaves: []string{leaf(treeB, 0).Data}}))
+
+	found, err := journal.FindIntent(ctx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, next, found)
+
+	require.Nil(t, journal.DeleteIntent(ctx, treeA))
+	_, err = journal.FindIntent(ctx, treeA)
+	assert.Equal(t, db.ErrNotFound, err)
+
+	if db.Supports(s, (*db.TreeDeleter)(nil)) {
+		deleter := s.(db.TreeDeleter)
+		insertTree(t, s, treeB, 1)
+		require.Nil(t, deleter.DeleteTree(ctx, treeB))
+		_, err = journal.FindIntent(ctx, treeB)
+		assert.Equal(t, db.ErrNotFound, err)
+	}
+}
+
+func audit(address string, no int) *db.AuditEntry {
+	return &db.AuditEntry{
+		MtAddress: address,
+		Op:        db.AuditAppend,
+		Leaves:    []string{leaf(address, no).Data, leaf(address, no+1).Data},
+		LeafIndex: no,
+		OldRoot:   fmt.Sprintf("%064x", no),
+		NewRoot:   fmt.Sprintf("%064x", no+1),
+		Time:      time.Unix(1700000000+int64(no), 0).UTC(),
+		Actor:     "ops",
+	}
+}
+
+func testAudit(t *testing.T, s db.Storage) {
+	ctx := context.Background()
+	log := s.(db.AuditLog)
+
+	_, err := log.LastAudit(ctx, treeA)
+	assert.Equal(t, db.ErrNotFound, err)
+	entries, err := log.FindAudit(ctx, treeA, 1, 10)
+	require.Nil(t, err)
+	assert.Empty(t, entries)
+
+	for i := 0; i < 5; i++ {
+		entry := audit(treeA, i)
+		require.Nil(t, log.AppendAudit(ctx, entry))
+		assert.Equal(t, uint64(i+1), entry.Seq)
+	}
+	require.Nil(t, log.AppendAudit(ctx, audit(treeB, 0)))
+
+	entries, err = log.FindAudit(ctx, treeA, 2, 3)
+	require.Nil(t, err)
+	require.Len(t, entries, 3)
+	for i, entry := range entries {
+		expected := audit(treeA, i+1)
+		expected.Seq = uint64(i + 2)
+		assert.Equal(t, expected, entry)
+	}
+	entries, err = log.FindAudit(ctx, treeA, 5, 3)
+	require.Nil(t, err)
+	assert.Len(t, entries, 1)
+	entries, err = log.FindAudit(ctx, treeA, 6, 3)
+	require.Nil(t, err)
+	assert.Empty(t, entries)
+
+	last, err := log.LastAudit(ctx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, uint64(5), last.Seq)
+	assert.Equal(t, audit(treeA, 4).Leaves, last.Leaves)
+
+	// 删除树后历史仍然保留
+	if db.Supports(s, (*db.TreeDeleter)(nil)) {
+		deleter := s.(db.TreeDeleter)
+		insertTree(t, s, treeA, 2)
+		require.Nil(t, deleter.DeleteTree(ctx, treeA))
+		last, err = log.LastAudit(ctx, treeA)
+		require.Nil(t, err)
+		assert.Equal(t, uint64(5), last.Seq)
+	}
+}
+
+func testExpiredTrees(t *testing.T, s db.Storage) {
+	ctx := context.Background()
+	deleter := s.(db.TreeDeleter)
+	now := time.Now()
+
+	require.Nil(t, deleter.ExpireTree(ctx, treeB, now.Add(-time.Minute)))
+	require.Nil(t, deleter.ExpireTree(ctx, treeA, now.Add(-time.Hour)))
+	require.Nil(t, deleter.ExpireTree(ctx, "conformance-later", now.Add(time.Hour)))
+
+	expired, err := deleter.FindExpiredTrees(ctx, now)
+	require.Nil(t, err)
+	assert.Equal(t, []string{treeA, treeB}, expired)
+
+	expired, err = deleter.FindExpiredTrees(ctx, now.Add(2*time.Hour))
+	require.Nil(t, err)
+	assert.Equal(t, []string{treeA, treeB, "conformance-later"}, expired)
+}
+
+func info(address string) *db.TreeInfo {
+	return &db.TreeInfo{
+		MtAddress:  address,
+		CreatedAt:  time.Unix(1700000000, 0).UTC(),
+		Hasher:     "keccak256",
+		LeafSchema: "address",
+	}
+}
+
+func testRegistry(t *testing.T, s db.TreeRegistry) {
+	ctx := context.Background()
+
+	_, err := s.FindTreeInfo(ctx, treeA)
+	assert.Equal(t, db.ErrNotFound, err)
+	infos, err := s.ListTreeInfos(ctx)
+	require.Nil(t, err)
+	assert.Empty(t, infos)
+
+	require.Nil(t, s.InsertTreeInfo(ctx, info(treeB)))
+	require.Nil(t, s.InsertTreeInfo(ctx, info(treeA)))
+	assert.Equal(t, db.ErrAlreadyExists, s.InsertTreeInfo(ctx, info(treeA)))
+
+	sealed := info(treeA)
+	sealed.Sealed = true
+	require.Nil(t, s.UpdateTreeInfo(ctx, sealed))
+	assert.Equal(t, db.ErrNotFound, s.UpdateTreeInfo(ctx, info("conformance-unknown")))
+
+	found, err := s.FindTreeInfo(ctx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, sealed, found)
+
+	infos, err = s.ListTreeInfos(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, []*db.TreeInfo{sealed, info(treeB)}, infos)
+}
+
+func testTxVisibility(t *testing.T, s db.TxStorage) {
+	ctx := context.Background()
+
+	insertTree(t, s, treeA, 2)
+	tx, err := s.Begin(ctx)
+	require.Nil(t, err)
+
+	require.Nil(t, tx.Insert(ctx, leaf(treeA, 2)))
+	require.Nil(t, tx.Insert(ctx, branch(treeA, 1, 1)))
+	require.Nil(t, tx.Insert(ctx, branch(treeA, 2, 0)))
+
+	// 事务内可见，事务外不可见
+	maxNo, err := tx.FindMaxNoOfLeaf(ctx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, 2, maxNo)
+	root, err := tx.FindRootNode(ctx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, branch(treeA, 2, 0), root)
+	meta, err := db.FindTreeMeta(ctx, tx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, 3, meta.LeafCount)
+	assert.Equal(t, branch(treeA, 2, 0).Hash, meta.RootHash)
+
+	maxNo, err = s.FindMaxNoOfLeaf(ctx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, 1, maxNo)
+	_, err = s.FindOneByLeafData(ctx, treeA, leaf(treeA, 2).Data)
+	assert.Equal(t, db.ErrNotFound, err)
+
+	require.Nil(t, tx.Commit(ctx))
+	assert.Equal(t, db.ErrTxDone, tx.Commit(ctx))
+
+	root, err = s.FindRootNode(ctx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, branch(treeA, 2, 0), root)
+	found, err := s.FindOneByLeafData(ctx, treeA, leaf(treeA, 2).Data)
+	require.Nil(t, err)
+	assert.Equal(t, leaf(treeA, 2), found)
+	meta, err = db.FindTreeMeta(ctx, s, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, 3, meta.Depth)
+}
+
+func testTxRollback(t *testing.T, s db.TxStorage) {
+	ctx := context.Background()
+
+	insertTree(t, s, treeA, 2)
+	tx, err := s.Begin(ctx)
+	require.Nil(t, err)
+
+	updated := branch(treeA, 1, 0)
+	updated.Hash = fmt.Sprintf("%064x", 99)
+	require.Nil(t, tx.Update(ctx, updated))
+	require.Nil(t, tx.Insert(ctx, leaf(treeA, 2)))
+	require.Nil(t, tx.Rollback(ctx))
+
+	root, err := s.FindRootNode(ctx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, branch(treeA, 1, 0), root)
+
+	maxNo, err := s.FindMaxNoOfLeaf(ctx, treeA)
+	require.Nil(t, err)
+	assert.Equal(t, 1, maxNo)
+}
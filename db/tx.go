@@ -0,0 +1,256 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// ErrTxDone is returned when a Tx is used after Commit or Rollback.
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
+
+// Tx is a unit of work opened by TxStorage.Begin. Reads through a Tx observe
+// its own pending writes, other readers see none of them until Commit.
+type Tx interface {
+	Storage
+	Commit(ctx context.Context) error
+	Rollback(ctx context.Context) error
+}
+
+// TxStorage is implemented by storages able to apply a group of writes
+// atomically. The tree engine runs every mutation inside one Tx when the
+// configured storage implements it.
+type TxStorage interface {
+	Storage
+	Begin(ctx context.Context) (Tx, error)
+}
+
+// BatchWriter is implemented by storages able to write several nodes in one
+// atomic step. Such a storage gets transactions for free from NewBufferedTx,
+// and so does any decorator wrapping it.
+type BatchWriter interface {
+	WriteNodes(ctx context.Context, nodes []*TreeNode) error
+}
+
+// CommitFunc applies the writes buffered by a BufferedTx in a single atomic step.
+type CommitFunc func(ctx context.Context, nodes []*TreeNode) error
+
+// BufferedTx is a copy-on-write Tx usable by any Storage: writes are kept in
+// an overlay in front of the base storage and handed to a CommitFunc on Commit.
+type BufferedTx struct {
+	base   Storage
+	commit CommitFunc
+	done   bool
+
+	// 按写入顺序记录，同一位置只保留最后一次写入
+	order  []nodeKey
+	nodes  map[nodeKey]*TreeNode
+	leaves map[string]map[string]*TreeNode
+}
+
+type nodeKey struct {
+	address string
+	pos     NodePos
+}
+
+func NewBufferedTx(base Storage, commit CommitFunc) *BufferedTx {
+	return &BufferedTx{
+		base:   base,
+		commit: commit,
+		nodes:  make(map[nodeKey]*TreeNode),
+		leaves: make(map[string]map[string]*TreeNode),
+	}
+}
+
+func (tx *BufferedTx) Insert(ctx context.Context, node *TreeNode) error {
+	return tx.write(ctx, node)
+}
+
+func (tx *BufferedTx) Update(ctx context.Context, node *TreeNode) error {
+	return tx.write(ctx, node)
+}
+
+func (tx *BufferedTx) write(ctx context.Context, node *TreeNode) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	// 写入只进入缓冲区，同样要响应取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	node = node.Clone()
+	key := nodeKey{address: node.MtAddress, pos: NodePos{Level: node.Level, LevelNo: node.LevelNo}}
+	if _, ok := tx.nodes[key]; !ok {
+		tx.order = append(tx.order, key)
+	}
+	tx.nodes[key] = node
+
+	if node.IsLeaf() {
+		if tx.leaves[node.MtAddress] == nil {
+			tx.leaves[node.MtAddress] = make(map[string]*TreeNode)
+		}
+		tx.leaves[node.MtAddress][node.Data] = node
+	}
+	return nil
+}
+
+func (tx *BufferedTx) FindRootNode(ctx context.Context, address string) (*TreeNode, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	root, err := tx.base.FindRootNode(ctx, address)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+
+	for _, key := range tx.order {
+		node := tx.nodes[key]
+		if key.address != address {
+			continue
+		}
+		if root == nil || node.Level > root.Level || (node.Level == root.Level && node.LevelNo >= root.LevelNo) {
+			root = node
+		}
+	}
+
+	if root == nil {
+		return nil, ErrNotFound
+	}
+	return root.Clone(), nil
+}
+
+func (tx *BufferedTx) FindMaxNoOfLeaf(ctx context.Context, address string) (int, error) {
+	if tx.done {
+		return -1, ErrTxDone
+	}
+
+	maxNo, err := tx.base.FindMaxNoOfLeaf(ctx, address)
+	if err != nil && err != ErrNotFound {
+		return -1, err
+	}
+	found := err == nil
+
+	for _, key := range tx.order {
+		if key.address != address || key.pos.Level != 0 {
+			continue
+		}
+		if !found || key.pos.LevelNo > maxNo {
+			maxNo = key.pos.LevelNo
+			found = true
+		}
+	}
+
+	if !found {
+		return -1, ErrNotFound
+	}
+	return maxNo, nil
+}
+
+func (tx *BufferedTx) FindOneByLeafData(ctx context.Context, address string, data string) (*TreeNode, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	if node := tx.leaves[address][data]; node != nil {
+		return node.Clone(), nil
+	}
+	return tx.base.FindOneByLeafData(ctx, address, data)
+}
+
+func (tx *BufferedTx) FindMultiTreeNode(ctx context.Context, address string, nodePoses []*NodePos) ([]*TreeNode, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	baseNodes, err := tx.base.FindMultiTreeNode(ctx, address, nodePoses)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+
+	found := make(map[NodePos]*TreeNode, len(baseNodes))
+	for _, node := range baseNodes {
+		found[NodePos{Level: node.Level, LevelNo: node.LevelNo}] = node
+	}
+
+	// 保持与nodePoses一致的顺序，调用方依赖最后一个节点的层级
+	var retTreeNodes []*TreeNode
+	for _, pose := range nodePoses {
+		if node := tx.nodes[nodeKey{address: address, pos: *pose}]; node != nil {
+			retTreeNodes = append(retTreeNodes, node.Clone())
+		} else if node := found[*pose]; node != nil {
+			retTreeNodes = append(retTreeNodes, node)
+		}
+	}
+
+	if len(retTreeNodes) == 0 {
+		return nil, ErrNotFound
+	}
+	return retTreeNodes, nil
+}
+
+func (tx *BufferedTx) FindNodesByLevel(ctx context.Context, address string, level int) ([]*TreeNode, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+
+	baseNodes, err := tx.base.FindNodesByLevel(ctx, address, level)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+
+	var retsz []*TreeNode
+	seen := make(map[int]bool)
+	for _, node := range baseNodes {
+		if pending := tx.nodes[nodeKey{address: address, pos: NodePos{Level: level, LevelNo: node.LevelNo}}]; pending != nil {
+			node = pending.Clone()
+		}
+		seen[node.LevelNo] = true
+		retsz = append(retsz, node)
+	}
+
+	for _, key := range tx.order {
+		if key.address != address || key.pos.Level != level || seen[key.pos.LevelNo] {
+			continue
+		}
+		retsz = append(retsz, tx.nodes[key].Clone())
+	}
+	sort.Slice(retsz, func(i, j int) bool { return retsz[i].LevelNo < retsz[j].LevelNo })
+
+	if len(retsz) == 0 {
+		return nil, ErrNotFound
+	}
+	return retsz, nil
+}
+
+// Commit hands every pending write to the CommitFunc. The Tx is finished
+// afterwards whatever the outcome.
+func (tx *BufferedTx) Commit(ctx context.Context) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+
+	if len(tx.order) == 0 {
+		return nil
+	}
+
+	nodes := make([]*TreeNode, 0, len(tx.order))
+	for _, key := range tx.order {
+		nodes = append(nodes, tx.nodes[key])
+	}
+	return tx.commit(ctx, nodes)
+}
+
+// Rollback discards every pending write.
+func (tx *BufferedTx) Rollback(ctx context.Context) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	tx.order = nil
+	tx.nodes = nil
+	tx.leaves = nil
+	return nil
+}
@@ -0,0 +1,251 @@
+package merkletree
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ProofManifestFile is the name of the manifest ExportProofs writes.
+const ProofManifestFile = "manifest.json"
+
+// DefaultPrefixLength is the number of hex digits naming a proof shard.
+const DefaultPrefixLength = 2
+
+// ErrUnshardable is returned by ExportProofs for a leaf not starting with
+// enough hex digits to pick its shard.
+var ErrUnshardable = errors.New("leaf has no hex prefix to shard by")
+
+// ProofExportOptions configures ExportProofs.
+type ProofExportOptions struct {
+	// PrefixLength is the number of hex digits of a leaf, after its 0x
+	// prefix, naming its shard; DefaultPrefixLength when zero
+	PrefixLength int
+}
+
+// ProofManifest describes the proofs ExportProofs wrote. Hashes are 0x
+// prefixed hex.
+type ProofManifest struct {
+	Tree         string       `json:"tree"`
+	Root         string       `json:"root"`
+	LeafCount    int          `json:"leafCount"`
+	Hasher       string       `json:"hasher"`
+	LeafSchema   string       `json:"leafSchema"`
+	PrefixLength int          `json:"prefixLength"`
+	Shards       []ProofShard `json:"shards"`
+}
+
+// ProofShard is a file of proofs, holding the leaves starting with Prefix.
+type ProofShard struct {
+	Prefix string `json:"prefix"`
+	File   string `json:"file"`
+	Leaves int    `json:"leaves"`
+}
+
+// LeafProof is the proof of a leaf in a shard, which maps the lower case
+// leaves to them.
+type LeafProof struct {
+	Leaf  string   `json:"leaf"`
+	Index int      `json:"index"`
+	Proof []string `json:"proof"`
+}
+
+// ExportProofs is ExportProofsCtx with the context the tree was created with.
+func (t *MerkleTree) ExportProofs(dir string, opts ProofExportOptions) (*ProofManifest, error) {
+	return t.ExportProofsCtx(t.ctx, dir, opts)
+}
+
+// ExportProofsCtx writes the proof of every leaf into dir, reading each
+// level of the tree once instead of calling GenerateProof per leaf. Leaves
+// are sharded by the lower case hex digits following their 0x prefix, e.g.
+// 0xab.json, each shard a JSON object from lower case leaf to LeafProof;
+// ProofManifestFile lists the shards with the root, leaf count and hasher.
+// Shards are built and written one at a time, and shard files of dir from a
+// previous export the manifest no longer lists are removed. The output only
+// depends on the tree, so unchanged trees export the same files. Proofs are
+// those GenerateProof returns.
+func (t *MerkleTree) ExportProofsCtx(ctx context.Context, dir string, opts ProofExportOptions) (_ *ProofManifest, err error) {
+	ctx, end := t.observe(ctx, OpExportProofs)
+	defer func() { end(err) }()
+
+	if opts.PrefixLength <= 0 {
+		opts.PrefixLength = DefaultPrefixLength
+	}
+
+	manifest, snapshot, err := t.collectProofs(ctx, opts.PrefixLength)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	for i := range manifest.Shards {
+		shard := &manifest.Shards[i]
+		if err = writeJSONFile(filepath.Join(dir, shard.File), snapshot.shardProofs(shard.Prefix)); err != nil {
+			return nil, err
+		}
+	}
+	// 清单最后写入，读到清单即可读到全部分片
+	if err = writeJSONFile(filepath.Join(dir, ProofManifestFile), manifest); err != nil {
+		return nil, err
+	}
+	if err = removeStaleShards(dir, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// proofSnapshot holds the hashes of a tree needed to build the proofs of its
+// leaves, and its leaves by shard.
+type proofSnapshot struct {
+	// levels[l][no] 为第 l 层第 no 个节点的哈希，根所在层不需要
+	levels [][]string
+	shards map[string][]*db.TreeNode
+}
+
+// shardProofs returns the proofs of the leaves of a shard by lower case leaf.
+func (s *proofSnapshot) shardProofs(prefix string) map[string]*LeafProof {
+	leaves := s.shards[prefix]
+	proofs := make(map[string]*LeafProof, len(leaves))
+	for _, leaf := range leaves {
+		proof := &LeafProof{Leaf: leaf.Data, Index: leaf.LevelNo, Proof: []string{}}
+		no := leaf.LevelNo
+		for _, level := range s.levels {
+			// 与 GenerateProof 相同：兄弟节点不存在时该层被提升，不产生证明
+			if sibling := no ^ 1; sibling < len(level) {
+				proof.Proof = append(proof.Proof, level[sibling])
+			}
+			no /= 2
+		}
+		proofs[strings.ToLower(leaf.Data)] = proof
+	}
+	return proofs
+}
+
+// collectProofs reads the tree level by level under the read lock, and
+// returns its manifest and the snapshot to build the proofs of each shard
+// from.
+func (t *MerkleTree) collectProofs(ctx context.Context, prefixLength int) (*ProofManifest, *proofSnapshot, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	manifest := &ProofManifest{
+		Tree:         t.mtAddress,
+		Hasher:       t.hasher.Name(),
+		LeafSchema:   t.schema.Name(),
+		PrefixLength: prefixLength,
+		Shards:       []ProofShard{},
+	}
+	snapshot := &proofSnapshot{shards: make(map[string][]*db.TreeNode)}
+
+	root, err := t.storage.FindRootNode(ctx, t.mtAddress)
+	if err == db.ErrNotFound {
+		return manifest, snapshot, nil
+	}
+	if err != nil {
+		t.Error("ExportProofs FindRootNode err: ", err)
+		return nil, nil, err
+	}
+	manifest.Root = "0x" + root.Hash
+	observed(ctx, -1, root.Level+1)
+
+	snapshot.levels = make([][]string, root.Level)
+	var leaves []*db.TreeNode
+	for l := 0; l < root.Level; l++ {
+		nodes, err := t.storage.FindNodesByLevel(ctx, t.mtAddress, l)
+		if err != nil {
+			t.Error("ExportProofs FindNodesByLevel err: ", err)
+			return nil, nil, err
+		}
+		snapshot.levels[l] = make([]string, len(nodes))
+		for no, node := range nodes {
+			if node.LevelNo != no {
+				return nil, nil, fmt.Errorf("%w: tree %s has no node at level %d levelNo %d", ErrMissingLeaves, t.mtAddress, l, no)
+			}
+			snapshot.levels[l][no] = "0x" + node.Hash
+		}
+		if l == 0 {
+			leaves = nodes
+		}
+	}
+	if root.Level == 0 {
+		leaves = []*db.TreeNode{root}
+	}
+	manifest.LeafCount = len(leaves)
+
+	for _, leaf := range leaves {
+		prefix, err := shardPrefix(leaf.Data, prefixLength)
+		if err != nil {
+			return nil, nil, err
+		}
+		snapshot.shards[prefix] = append(snapshot.shards[prefix], leaf)
+	}
+
+	for prefix, shard := range snapshot.shards {
+		manifest.Shards = append(manifest.Shards, ProofShard{Prefix: prefix, File: prefix + ".json", Leaves: len(shard)})
+	}
+	sort.Slice(manifest.Shards, func(i, j int) bool {
+		return manifest.Shards[i].Prefix < manifest.Shards[j].Prefix
+	})
+	return manifest, snapshot, nil
+}
+
+// removeStaleShards removes the files of dir named like shards, e.g.
+// 0xab.json, that manifest does not list. Other files are left alone.
+func removeStaleShards(dir string, manifest *ProofManifest) error {
+	listed := make(map[string]bool, len(manifest.Shards))
+	for _, shard := range manifest.Shards {
+		listed[shard.File] = true
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || listed[name] || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		prefix := strings.TrimSuffix(name, ".json")
+		// 只删除分片命名的文件，即 0x 加上小写十六进制数字
+		if shard, err := shardPrefix(prefix, len(prefix)-2); err != nil || shard != prefix || len(prefix) <= 2 {
+			continue
+		}
+		if err = os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shardPrefix returns the 0x prefix and the first prefixLength hex digits
+// of leaf, in lower case.
+func shardPrefix(leaf string, prefixLength int) (string, error) {
+	prefix := strings.ToLower(leaf)
+	if !strings.HasPrefix(prefix, "0x") || len(prefix) < 2+prefixLength {
+		return "", fmt.Errorf("%w: %q", ErrUnshardable, leaf)
+	}
+	prefix = prefix[:2+prefixLength]
+	for _, c := range prefix[2:] {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return "", fmt.Errorf("%w: %q", ErrUnshardable, leaf)
+		}
+	}
+	return prefix, nil
+}
+
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
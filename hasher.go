@@ -0,0 +1,191 @@
+package merkletree
+
+import (
+	"errors"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree/keccak256"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidAddress is returned for leaf data that is not a 0x prefixed, 20 byte hex address.
+var ErrInvalidAddress = errors.New("data address invalid.")
+
+// ErrBadChecksum is returned by ChecksumAddressSchema for a mixed case
+// address whose case does not match its EIP-55 checksum.
+var ErrBadChecksum = errors.New("address checksum invalid")
+
+// ErrInvalidLeaf matches, with errors.Is, every error of ValidateLeaf, whatever
+// the schema and the reason it rejected the leaf for.
+var ErrInvalidLeaf = errors.New("invalid leaf")
+
+var (
+	// ErrUnknownHasher is returned by LookupHasher for a name never registered.
+	ErrUnknownHasher = errors.New("unknown hasher")
+	// ErrUnknownLeafSchema is returned by LookupLeafSchema for a name never registered.
+	ErrUnknownLeafSchema = errors.New("unknown leaf schema")
+)
+
+// Hasher computes the leaf and branch hashes of a tree.
+type Hasher interface {
+	// Name identifies the hasher in the tree registry.
+	Name() string
+	HashLeaf(data string) []byte
+	HashPair(left, right []byte) []byte
+}
+
+// LeafSchema defines what a leaf of a tree holds.
+type LeafSchema interface {
+	// Name identifies the schema in the tree registry.
+	Name() string
+	// Validate returns an error describing why data is not a valid leaf.
+	Validate(data string) error
+}
+
+// ValidateLeaf validates data against schema. The error it returns matches
+// ErrInvalidLeaf as well as the error of the schema.
+func ValidateLeaf(schema LeafSchema, data string) error {
+	if err := schema.Validate(data); err != nil {
+		return &invalidLeafError{err: err}
+	}
+	return nil
+}
+
+// invalidLeafError marks the error of a schema as an ErrInvalidLeaf.
+type invalidLeafError struct {
+	err error
+}
+
+func (e *invalidLeafError) Error() string {
+	return e.err.Error()
+}
+
+func (e *invalidLeafError) Unwrap() error {
+	return e.err
+}
+
+func (e *invalidLeafError) Is(target error) bool {
+	return target == ErrInvalidLeaf
+}
+
+// Keccak256Hasher hashes leaves as keccak256(keccak256(bytes32(data))) and
+// branches as keccak256 of the sorted pair. These are the hashes of
+// OpenZeppelin's StandardMerkleTree, but not its layout: the same leaves
+// only give the same root for the leaf counts OZLayoutMatches accepts.
+var Keccak256Hasher Hasher = keccak256Hasher{}
+
+// AddressSchema accepts 0x prefixed, 20 byte hex addresses.
+var AddressSchema LeafSchema = addressSchema{}
+
+type keccak256Hasher struct{}
+
+func (keccak256Hasher) Name() string {
+	return "keccak256"
+}
+
+func (keccak256Hasher) HashLeaf(data string) []byte {
+	return keccak256.HashLeaf(data[2:])
+}
+
+func (keccak256Hasher) HashPair(left, right []byte) []byte {
+	return keccak256.HashByteBranch(left, right)
+}
+
+type addressSchema struct{}
+
+func (addressSchema) Name() string {
+	return "address"
+}
+
+func (addressSchema) Validate(data string) error {
+	if !IsAddress(data) {
+		return ErrInvalidAddress
+	}
+	return nil
+}
+
+// ChecksumAddressSchema accepts the addresses AddressSchema does, but
+// rejects mixed case ones failing their EIP-55 checksum. Addresses all in
+// lower or upper case carry no checksum and are accepted.
+var ChecksumAddressSchema LeafSchema = checksumAddressSchema{}
+
+type checksumAddressSchema struct{}
+
+func (checksumAddressSchema) Name() string {
+	return "address-checksum"
+}
+
+func (checksumAddressSchema) Validate(data string) error {
+	if !IsAddress(data) {
+		return ErrInvalidAddress
+	}
+	hexAddress := data[2:]
+	lower := strings.ToLower(hexAddress)
+	if hexAddress == lower || hexAddress == strings.ToUpper(hexAddress) {
+		return nil
+	}
+
+	// 字母位对应哈希半字节 >= 8 时应为大写
+	hash := keccak256.Hash([]byte(lower))
+	for i := 0; i < len(lower); i++ {
+		c := lower[i]
+		if c < 'a' {
+			continue
+		}
+		nibble := hash[i/2] >> 4
+		if i%2 == 1 {
+			nibble = hash[i/2] & 0x0f
+		}
+		if (nibble >= 8) != (hexAddress[i] != c) {
+			return ErrBadChecksum
+		}
+	}
+	return nil
+}
+
+var (
+	registryMu  sync.RWMutex
+	hashers     = map[string]Hasher{Keccak256Hasher.Name(): Keccak256Hasher}
+	leafSchemas = map[string]LeafSchema{
+		AddressSchema.Name():         AddressSchema,
+		ChecksumAddressSchema.Name(): ChecksumAddressSchema,
+	}
+)
+
+// RegisterHasher makes a hasher available to trees opened from the registry.
+func RegisterHasher(hasher Hasher) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	hashers[hasher.Name()] = hasher
+}
+
+// RegisterLeafSchema makes a leaf schema available to trees opened from the registry.
+func RegisterLeafSchema(schema LeafSchema) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	leafSchemas[schema.Name()] = schema
+}
+
+// LookupHasher returns the hasher registered under name.
+func LookupHasher(name string) (Hasher, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	hasher := hashers[name]
+	if hasher == nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknownHasher, name)
+	}
+	return hasher, nil
+}
+
+// LookupLeafSchema returns the leaf schema registered under name.
+func LookupLeafSchema(name string) (LeafSchema, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	schema := leafSchemas[name]
+	if schema == nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknownLeafSchema, name)
+	}
+	return schema, nil
+}
@@ -0,0 +1,371 @@
+// Package importer appends leaves read from CSV, JSON or NDJSON files to a
+// merkle tree, validating every row with the tree's leaf schema, and reports
+// what became of each row.
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree"
+	"github.com/UXUYLabs/go-merkletree/keccak256"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultBatchSize is the number of leaves appended at once.
+const DefaultBatchSize = 1000
+
+// Format is the encoding of an import file.
+type Format string
+
+const (
+	// FormatCSV reads one leaf per row, from a column
+	FormatCSV Format = "csv"
+	// FormatJSON reads an array of leaves, or of objects holding one
+	FormatJSON Format = "json"
+	// FormatNDJSON reads one leaf, or object holding one, per line
+	FormatNDJSON Format = "ndjson"
+)
+
+// FormatOf returns the format named by the extension of path, FormatCSV
+// when it is neither .json nor .ndjson/.jsonl.
+func FormatOf(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON
+	default:
+		return FormatCSV
+	}
+}
+
+// Options configures an import.
+type Options struct {
+	// Format defaults to FormatCSV
+	Format Format
+	// Column is the CSV header or JSON object field holding the leaf. When
+	// empty the first CSV column is read, and its first row skipped if it is
+	// not a valid leaf; JSON values must then be strings.
+	Column string
+	// BatchSize defaults to DefaultBatchSize
+	BatchSize int
+	// DryRun validates and dedupes the rows without appending anything
+	DryRun bool
+}
+
+// Status is what became of a row.
+type Status string
+
+const (
+	StatusAccepted  Status = "accepted"
+	StatusDuplicate Status = "duplicate"
+	StatusRejected  Status = "rejected"
+)
+
+// Row is the outcome of one row of the input.
+type Row struct {
+	// Line is the 1-based line the row starts on
+	Line   int    `json:"line"`
+	Leaf   string `json:"leaf"`
+	Status Status `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Report describes an import. Blank rows are only counted.
+type Report struct {
+	MtAddress  string `json:"mtAddress"`
+	Accepted   int    `json:"accepted"`
+	Duplicates int    `json:"duplicates"`
+	Rejected   int    `json:"rejected"`
+	Blank      int    `json:"blank"`
+	// Appended is the number of leaves the tree grew by. The dedupe against
+	// the tree is not done under its lock: it is fewer than Accepted when
+	// accepted leaves reached the tree in between, and counts the leaves
+	// other writers appended during the import. It is 0 for a dry run.
+	Appended int    `json:"appended"`
+	Root     string `json:"root"`
+	DryRun   bool   `json:"dryRun"`
+	Rows     []*Row `json:"rows"`
+}
+
+// errBlank marks a row without any value.
+var errBlank = errors.New("blank row")
+
+// Import reads the rows of r, validates each with the leaf schema of tree
+// and dedupes them by leaf hash, within the input and against the tree,
+// then appends the accepted leaves in batches, in input order.
+// Rows which cannot be read are rejected as well; only an unreadable input
+// ends the import early. On a failed append the report so far is returned
+// with the error.
+func Import(ctx context.Context, tree *merkletree.MerkleTree, r io.Reader, opts Options) (*Report, error) {
+	if opts.Format == "" {
+		opts.Format = FormatCSV
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	report := &Report{MtAddress: tree.Address(), DryRun: opts.DryRun, Rows: []*Row{}}
+	seen := make(map[string]int)
+	// 按叶子哈希比对树中已有的叶子，大小写不同的同一地址同样视为重复
+	var existing map[string]int
+	var leaves []string
+	visit := func(line int, leaf string, err error) error {
+		if err == errBlank {
+			report.Blank++
+			return nil
+		}
+		row := &Row{Line: line, Leaf: leaf}
+		report.Rows = append(report.Rows, row)
+		if err == nil {
+			err = merkletree.ValidateLeaf(tree.LeafSchema(), leaf)
+		}
+		if err != nil {
+			row.Status, row.Reason = StatusRejected, err.Error()
+			report.Rejected++
+			return nil
+		}
+
+		key := keccak256.Bytes2Hex(tree.Hasher().HashLeaf(leaf))
+		if first, ok := seen[key]; ok {
+			row.Status, row.Reason = StatusDuplicate, fmt.Sprintf("duplicate of line %d", first)
+			report.Duplicates++
+			return nil
+		}
+		seen[key] = line
+		if existing == nil {
+			if existing, err = tree.LeafHashesCtx(ctx); err != nil {
+				return err
+			}
+		}
+		if index, ok := existing[key]; ok {
+			row.Status, row.Reason = StatusDuplicate, fmt.Sprintf("already in tree at index %d", index)
+			report.Duplicates++
+			return nil
+		}
+
+		row.Status = StatusAccepted
+		report.Accepted++
+		leaves = append(leaves, leaf)
+		return nil
+	}
+
+	var err error
+	switch opts.Format {
+	case FormatCSV:
+		err = readCSV(r, opts.Column, tree.LeafSchema(), visit)
+	case FormatJSON:
+		err = readJSON(r, opts.Column, visit)
+	case FormatNDJSON:
+		err = readNDJSON(r, opts.Column, visit)
+	default:
+		err = fmt.Errorf("unknown format %q", opts.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.DryRun && len(leaves) > 0 {
+		// 已在树中的叶子被跳过，追加数以树的增长计
+		before, err := tree.LeafCountCtx(ctx)
+		if err != nil {
+			return report, err
+		}
+		for len(leaves) > 0 {
+			n := len(leaves)
+			if n > opts.BatchSize {
+				n = opts.BatchSize
+			}
+			err = tree.AppendLeavesCtx(ctx, leaves[:n])
+			after, countErr := tree.LeafCountCtx(ctx)
+			if countErr == nil {
+				report.Appended = after - before
+			}
+			if err != nil {
+				return report, err
+			}
+			if countErr != nil {
+				return report, countErr
+			}
+			leaves = leaves[n:]
+		}
+	}
+
+	root, err := tree.GetRootNodeCtx(ctx)
+	if err != nil {
+		return report, err
+	}
+	if root != nil {
+		report.Root = root.Hash
+	}
+	return report, nil
+}
+
+// readCSV calls visit with each row of r.
+func readCSV(r io.Reader, column string, schema merkletree.LeafSchema, visit func(line int, leaf string, err error) error) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	index := 0
+	for first := true; ; first = false {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			if err = visit(parseErr.StartLine, "", parseErr.Err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := cr.FieldPos(0)
+
+		if first {
+			if column != "" {
+				// 按表头名查找列
+				if index = findColumn(record, column); index < 0 {
+					return fmt.Errorf("no column %q in header", column)
+				}
+				continue
+			}
+			if leaf := strings.TrimSpace(record[0]); leaf != "" && schema.Validate(leaf) != nil {
+				continue
+			}
+		}
+
+		if blank(record) {
+			err = errBlank
+		} else if index >= len(record) {
+			err = fmt.Errorf("row has %d columns, leaf is in column %d", len(record), index+1)
+		}
+		leaf := ""
+		if index < len(record) {
+			leaf = strings.TrimSpace(record[index])
+		}
+		if err == nil && leaf == "" {
+			err = errors.New("empty leaf")
+		}
+		if err = visit(line, leaf, err); err != nil {
+			return err
+		}
+	}
+}
+
+func findColumn(header []string, column string) int {
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), column) {
+			return i
+		}
+	}
+	return -1
+}
+
+func blank(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// readJSON calls visit with each element of the array r holds.
+func readJSON(r io.Reader, column string, visit func(line int, leaf string, err error) error) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return errors.New("JSON input must be an array")
+	}
+
+	line, offset := 1, 0
+	for dec.More() {
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return err
+		}
+		// 元素起始行：跳过值之前的逗号与空白
+		end := int(dec.InputOffset())
+		start := end - len(value)
+		line += bytes.Count(data[offset:start], []byte("\n"))
+		offset = start
+
+		leaf, err := leafOf(value, column)
+		if err = visit(line, leaf, err); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+// readNDJSON calls visit with the value of each line of r.
+func readNDJSON(r io.Reader, column string, visit func(line int, leaf string, err error) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		text := bytes.TrimSpace(sc.Bytes())
+		var leaf string
+		var err error
+		if len(text) == 0 {
+			err = errBlank
+		} else if !json.Valid(text) {
+			err = errors.New("invalid JSON")
+		} else {
+			leaf, err = leafOf(text, column)
+		}
+		if err = visit(line, leaf, err); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// leafOf returns the leaf a JSON value holds: the value itself when it is a
+// string, or its column field when it is an object.
+func leafOf(value json.RawMessage, column string) (string, error) {
+	var leaf string
+	if err := json.Unmarshal(value, &leaf); err == nil {
+		leaf = strings.TrimSpace(leaf)
+		if leaf == "" {
+			return "", errBlank
+		}
+		return leaf, nil
+	}
+
+	if column == "" {
+		return "", errors.New("value is not a string")
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(value, &object); err != nil {
+		return "", errors.New("value is neither a string nor an object")
+	}
+	for name, field := range object {
+		if !strings.EqualFold(name, column) {
+			continue
+		}
+		leaf, ok := field.(string)
+		if !ok {
+			return "", fmt.Errorf("field %q is not a string", name)
+		}
+		if leaf = strings.TrimSpace(leaf); leaf == "" {
+			return "", fmt.Errorf("field %q is empty", name)
+		}
+		return leaf, nil
+	}
+	return "", fmt.Errorf("no field %q", column)
+}
@@ -0,0 +1,172 @@
+package importer
+
+import (
+	"context"
+	"github.com/UXUYLabs/go-merkletree"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func newTree(t *testing.T, opts ...merkletree.Option) (*merkletree.MerkleTreeManager, *merkletree.MerkleTree) {
+	opts = append(opts, merkletree.WithLogger(merkletree.DiscardLogger))
+	manager, err := merkletree.NewMemoryMerkleTreeManager(context.Background(), opts...)
+	if err != nil {
+		t.Fatal("NewMemoryMerkleTreeManager err: ", err)
+	}
+	tree, err := manager.CreateTree("1637704523306766336", opts...)
+	if err != nil {
+		t.Fatal("CreateTree err: ", err)
+	}
+	return manager, tree
+}
+
+func statuses(report *Report) map[int]Status {
+	ret := make(map[int]Status)
+	for _, row := range report.Rows {
+		ret[row.Line] = row.Status
+	}
+	return ret
+}
+
+func TestImportCSV(t *testing.T) {
+	ctx := context.Background()
+	manager, tree := newTree(t, merkletree.WithLeafSchema(merkletree.ChecksumAddressSchema))
+	if err := tree.AppendLeaf("0x9965507D1a55bcC2695C58ba16FB37d819B0A4dc"); err != nil {
+		t.Fatal("AppendLeaf err: ", err)
+	}
+
+	input := strings.Join([]string{
+		"name,Address,amount",
+		"a,0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed,1",
+		"b, 0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359 ,2",
+		",,",
+		"c,0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed,3",
+		"d,0x5AAeb6053F3E94C9b9A09f33669435E7Ef1BeAed,4",
+		"e,0x1234,5",
+		"f,0x9965507D1a55bcC2695C58ba16FB37d819B0A4dc,6",
+		"g",
+	}, "\n")
+
+	// 试运行不写入
+	report, err := Import(ctx, tree, strings.NewReader(input), Options{Column: "address", DryRun: true})
+	if err != nil {
+		t.Fatal("Import err: ", err)
+	}
+	assert.Equal(t, 0, report.Appended)
+	assert.Equal(t, 2, report.Accepted)
+
+	report, err = Import(ctx, tree, strings.NewReader(input), Options{Column: "address", BatchSize: 1})
+	if err != nil {
+		t.Fatal("Import err: ", err)
+	}
+	assert.Equal(t, map[int]Status{
+		2: StatusAccepted,
+		3: StatusAccepted,
+		5: StatusDuplicate,
+		6: StatusRejected,
+		7: StatusRejected,
+		8: StatusDuplicate,
+		9: StatusRejected,
+	}, statuses(report))
+	assert.Equal(t, 2, report.Accepted)
+	assert.Equal(t, 2, report.Duplicates)
+	assert.Equal(t, 3, report.Rejected)
+	assert.Equal(t, 1, report.Blank)
+	assert.Equal(t, 2, report.Appended)
+	assert.Equal(t, "duplicate of line 2", report.Rows[2].Reason)
+	assert.Equal(t, merkletree.ErrBadChecksum.Error(), report.Rows[3].Reason)
+
+	info, err := manager.TreeInfo("1637704523306766336")
+	if err != nil {
+		t.Fatal("TreeInfo err: ", err)
+	}
+	assert.Equal(t, 3, info.LeafCount)
+	assert.Equal(t, info.Root, report.Root)
+}
+
+func TestImportJSON(t *testing.T) {
+	ctx := context.Background()
+	_, tree := newTree(t)
+
+	input := `[
+  "0x8b1b201E91966957f18bBcDDB520c53c521bF5cd",
+  {"address": "0xeA726629EC5fe5cE300000d1a8c89B3054A22cE7"},
+  "",
+  42,
+  "0x8b1b201E91966957f18bBcDDB520c53c521bF5cd"
+]`
+	report, err := Import(ctx, tree, strings.NewReader(input), Options{Format: FormatJSON, Column: "address"})
+	if err != nil {
+		t.Fatal("Import err: ", err)
+	}
+	assert.Equal(t, map[int]Status{2: StatusAccepted, 3: StatusAccepted, 5: StatusRejected, 6: StatusDuplicate}, statuses(report))
+	assert.Equal(t, 1, report.Blank)
+
+	input = "\"0x9965507D1a55bcC2695C58ba16FB37d819B0A4dc\"\n\n{\"address\": \"0x8b1b201E91966957f18bBcDDB520c53c521bF5cd\"}\n{bad\n"
+	report, err = Import(ctx, tree, strings.NewReader(input), Options{Format: FormatNDJSON, Column: "address"})
+	if err != nil {
+		t.Fatal("Import err: ", err)
+	}
+	assert.Equal(t, map[int]Status{1: StatusAccepted, 3: StatusDuplicate, 4: StatusRejected}, statuses(report))
+	assert.Equal(t, "already in tree at index 0", report.Rows[1].Reason)
+	assert.Equal(t, 1, report.Appended)
+
+	// 树中已有的地址换成小写同样是重复
+	report, err = Import(ctx, tree, strings.NewReader("0xea726629ec5fe5ce300000d1a8c89b3054a22ce7\n"), Options{})
+	if err != nil {
+		t.Fatal("Import err: ", err)
+	}
+	assert.Equal(t, map[int]Status{1: StatusDuplicate}, statuses(report))
+	assert.Equal(t, "already in tree at index 1", report.Rows[0].Reason)
+
+	_, err = Import(ctx, tree, strings.NewReader(`{"a": 1}`), Options{Format: FormatJSON})
+	assert.NotNil(t, err)
+}
+
+// appendingObserver appends leaf through another handle of the tree once the
+// leaf hashes of the tree have been read.
+type appendingObserver struct {
+	tree *merkletree.MerkleTree
+	leaf string
+	err  error
+}
+
+func (o *appendingObserver) StartOperation(ctx context.Context, info *merkletree.OperationInfo) (context.Context, func(err error)) {
+	return ctx, func(err error) {
+		if info.Op == merkletree.OpLeafHashes && err == nil && o.tree != nil {
+			tree := o.tree
+			o.tree = nil
+			o.err = tree.AppendLeaf(o.leaf)
+		}
+	}
+}
+
+func TestImportConcurrentAppend(t *testing.T) {
+	ctx := context.Background()
+	manager, err := merkletree.NewMemoryMerkleTreeManager(ctx, merkletree.WithLogger(merkletree.DiscardLogger))
+	if err != nil {
+		t.Fatal("NewMemoryMerkleTreeManager err: ", err)
+	}
+	observer := &appendingObserver{leaf: "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"}
+	tree, err := manager.CreateTree("1637704523306766336", merkletree.WithObserver(observer))
+	if err != nil {
+		t.Fatal("CreateTree err: ", err)
+	}
+	if observer.tree, err = manager.OpenTree("1637704523306766336"); err != nil {
+		t.Fatal("OpenTree err: ", err)
+	}
+
+	// 去重之后另一个句柄追加了其中一个叶子
+	input := "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed\n0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359\n"
+	report, err := Import(ctx, tree, strings.NewReader(input), Options{})
+	if err != nil {
+		t.Fatal("Import err: ", err)
+	}
+	assert.Nil(t, observer.err)
+	assert.Equal(t, 2, report.Accepted)
+	assert.Equal(t, 1, report.Appended)
+	count, err := tree.LeafCount()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
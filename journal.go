@@ -0,0 +1,174 @@
+package merkletree
+
+import (
+	"context"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"sort"
+	"time"
+)
+
+// journaled runs fn, the append of a batch of leaves returning those it
+// appended, with one intent recorded in the journal of the storage if it
+// keeps one, and records the leaves appended in one audit entry. The old
+// root and the position of the first leaf are taken from the metadata of
+// the tree. The intent is cleared once the batch is completed and audited,
+// or has failed and its failed append been rolled back; a batch interrupted
+// by a crash leaves it for recoverAppend. An intent left by an earlier
+// failure is recovered first.
+func (t *MerkleTree) journaled(ctx context.Context, lease db.Lease, leaves []string, fn func() ([]string, error)) error {
+	var journal db.IntentJournal
+	if db.Supports(t.storage, (*db.IntentJournal)(nil)) {
+		journal = t.storage.(db.IntentJournal)
+	}
+	if journal == nil && !db.Supports(t.storage, (*db.AuditLog)(nil)) {
+		_, err := fn()
+		return err
+	}
+
+	if journal != nil {
+		if err := t.recoverIntent(ctx, lease, journal); err != nil {
+			return err
+		}
+	}
+
+	meta, err := treeMeta(ctx, t.storage, t.mtAddress)
+	if err != nil {
+		t.Error("journaled FindTreeMeta err: ", err)
+		return err
+	}
+	intent := &db.AppendIntent{
+		MtAddress: t.mtAddress,
+		Leaves:    leaves,
+		LevelNo:   meta.LeafCount,
+		OldRoot:   meta.RootHash,
+		Actor:     ActorFrom(ctx),
+		CreatedAt: time.Now().UTC(),
+	}
+	if journal != nil {
+		if err = journal.PutIntent(ctx, intent); err != nil {
+			t.Error("journaled PutIntent err: ", err)
+			return err
+		}
+	}
+
+	appended, err := fn()
+	if err != nil && !db.Supports(t.storage, (*db.TxStorage)(nil)) {
+		// 没有事务时失败的写入可能已部分生效，保留意图，恢复时一并审计
+		return err
+	}
+	if len(appended) > 0 {
+		// 审计记录写入失败时保留意图，恢复时补写
+		if auditErr := t.auditAppend(ctx, intent, appended); auditErr != nil {
+			if err == nil {
+				err = auditErr
+			}
+			return err
+		}
+	}
+
+	// 意图未能清除时，恢复会发现批次已完成
+	if journal != nil {
+		if delErr := journal.DeleteIntent(ctx, t.mtAddress); delErr != nil {
+			t.Error("journaled DeleteIntent err: ", delErr)
+		}
+	}
+	return err
+}
+
+// recoverAppend completes or undoes an append interrupted by a crash.
+func (t *MerkleTree) recoverAppend(ctx context.Context) error {
+	if !db.Supports(t.storage, (*db.IntentJournal)(nil)) {
+		return nil
+	}
+	journal := t.storage.(db.IntentJournal)
+
+	_, err := journal.FindIntent(ctx, t.mtAddress)
+	if err == db.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		t.Error("recoverAppend FindIntent err: ", err)
+		return err
+	}
+
+	// 持锁后重新读取，进行中的追加此时已经结束
+	return t.exclusive(ctx, func(ctx context.Context, lease db.Lease) error {
+		return t.recoverIntent(ctx, lease, journal)
+	})
+}
+
+// recoverIntent finds the intent of an interrupted batch, and rolls it
+// forward when some of its leaves were written, recomputing the branches from
+// the leaves and auditing them unless that was done already, or back
+// otherwise, which only drops the intent since a leaf is the first node an
+// append writes. The caller holds the tree exclusively.
+func (t *MerkleTree) recoverIntent(ctx context.Context, lease db.Lease, journal db.IntentJournal) error {
+	intent, err := journal.FindIntent(ctx, t.mtAddress)
+	if err == db.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		t.Error("recoverAppend FindIntent err: ", err)
+		return err
+	}
+
+	written, err := t.intentLeaves(ctx, intent)
+	if err != nil {
+		return err
+	}
+	if len(written) > 0 {
+		t.Info("recoverAppend roll forward", "mtAddress", t.mtAddress, "levelNo", intent.LevelNo, "leaves", len(written))
+		report, writes, err := t.planRebuild(ctx)
+		if err != nil {
+			return err
+		}
+		// 由追加的审计记录说明，不另记重建
+		if err = t.repair(ctx, lease, report, writes); err != nil {
+			return err
+		}
+		if err = t.auditRecovered(ctx, intent, written); err != nil {
+			return err
+		}
+	} else {
+		t.Info("recoverAppend roll back", "mtAddress", t.mtAddress, "levelNo", intent.LevelNo)
+	}
+
+	if err = journal.DeleteIntent(ctx, t.mtAddress); err != nil {
+		t.Error("recoverAppend DeleteIntent err: ", err)
+		return err
+	}
+	return nil
+}
+
+// intentLeaves returns the data of the leaves stored from the position of an
+// intent on, in order, which are those its batch appended.
+func (t *MerkleTree) intentLeaves(ctx context.Context, intent *db.AppendIntent) ([]string, error) {
+	if len(intent.Leaves) == 0 {
+		return nil, nil
+	}
+	poses := make([]*db.NodePos, 0, len(intent.Leaves))
+	for i := range intent.Leaves {
+		poses = append(poses, &db.NodePos{Level: 0, LevelNo: intent.LevelNo + i})
+	}
+	nodes, err := t.storage.FindMultiTreeNode(ctx, t.mtAddress, poses)
+	if err == db.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		t.Error("recoverAppend FindMultiTreeNode err: ", err)
+		return nil, err
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].LevelNo < nodes[j].LevelNo
+	})
+	var written []string
+	for i, node := range nodes {
+		// 叶子依次写入，位置不连续时后面的不属于该批次
+		if node.LevelNo != intent.LevelNo+i {
+			break
+		}
+		written = append(written, node.Data)
+	}
+	return written, nil
+}
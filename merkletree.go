@@ -2,7 +2,6 @@ package merkletree
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"github.com/UXUYLabs/go-merkletree/db"
 	"github.com/UXUYLabs/go-merkletree/keccak256"
@@ -10,66 +9,258 @@ import (
 	"log"
 	"os"
 	"regexp"
+	"strings"
+	"sync"
 )
 
 // MerkleTree is the structure for the Merkle tree.
+// It is safe for concurrent use: appends are serialized and reads never
+// observe a half-applied append.
 type MerkleTree struct {
 	Logger
 	ctx       context.Context
 	mtAddress string
 	storage   db.Storage
+	locker    db.Locker
+	hasher    Hasher
+	schema    LeafSchema
+	observers []Observer
+	// mu is shared by every handle of the same tree created by one MerkleTreeManager
+	mu *sync.RWMutex
 }
 
-func NewMerkleTree(ctx context.Context, storage db.Storage, mtAddress string) (*MerkleTree, error) {
+func NewMerkleTree(ctx context.Context, storage db.Storage, mtAddress string, opts ...Option) (*MerkleTree, error) {
+	o := newOptions(PrintfLogger(log.New(os.Stdout, "merkleTree: ", log.LstdFlags)), opts)
+	return newMerkleTree(ctx, storage, mtAddress, &sync.RWMutex{}, o), nil
+}
+
+func newMerkleTree(ctx context.Context, storage db.Storage, mtAddress string, mu *sync.RWMutex, o *options) *MerkleTree {
 	return &MerkleTree{
-		Logger:    PrintfLogger(log.New(os.Stdout, "merkleTree: ", log.LstdFlags)),
+		Logger:    o.logger,
 		ctx:       ctx,
 		mtAddress: mtAddress,
 		storage:   storage,
-	}, nil
+		locker:    o.locker,
+		hasher:    o.hasher,
+		schema:    o.leafSchema,
+		observers: o.observers,
+		mu:        mu,
+	}
 }
 
+// Address returns the address of the tree.
+func (t *MerkleTree) Address() string {
+	return t.mtAddress
+}
+
+// Hasher returns the hasher of the tree.
+func (t *MerkleTree) Hasher() Hasher {
+	return t.hasher
+}
+
+// LeafSchema returns the leaf schema of the tree.
+func (t *MerkleTree) LeafSchema() LeafSchema {
+	return t.schema
+}
+
+// AppendLeaf is AppendLeafCtx with the context the tree was created with.
 func (t *MerkleTree) AppendLeaf(data string) error {
-	if !IsAddress(data) {
-		return errors.New("data address invalid.")
+	return t.AppendLeafCtx(t.ctx, data)
+}
+
+// AppendLeafCtx appends data as the next leaf. Every storage call is made
+// with ctx, and an append interrupted by ctx leaves the tree unchanged when
+// the storage supports transactions.
+func (t *MerkleTree) AppendLeafCtx(ctx context.Context, data string) (err error) {
+	ctx, end := t.observe(ctx, OpAppend)
+	defer func() { end(err) }()
+
+	if err = ValidateLeaf(t.schema, data); err != nil {
+		return err
+	}
+
+	return t.mutate(ctx, []string{data})
+}
+
+// AppendLeaves is AppendLeavesCtx with the context the tree was created with.
+func (t *MerkleTree) AppendLeaves(data []string) error {
+	return t.AppendLeavesCtx(t.ctx, data)
+}
+
+// AppendLeavesCtx appends every element of data in order, holding the tree
+// for the whole batch. Every leaf is validated before any is appended. Each
+// append is atomic on its own: when one fails, the leaves before it stay.
+func (t *MerkleTree) AppendLeavesCtx(ctx context.Context, data []string) (err error) {
+	ctx, end := t.observe(ctx, OpAppendBatch)
+	defer func() { end(err) }()
+
+	for _, leaf := range data {
+		if err := ValidateLeaf(t.schema, leaf); err != nil {
+			return fmt.Errorf("leaf %s: %w", leaf, err)
+		}
+	}
+
+	return t.mutate(ctx, data)
+}
+
+// mutate appends leaves exclusively, each in one transaction, the batch
+// recorded in the intent journal while it runs.
+func (t *MerkleTree) mutate(ctx context.Context, leaves []string) error {
+	// 失败的批量追加也可能已追加部分叶子
+	defer t.observeTree(ctx)
+
+	return t.exclusive(ctx, func(ctx context.Context, lease db.Lease) error {
+		// 无论句柄如何创建都检查封存标记，未登记的树或无登记表的存储视为未封存
+		info, err := registeredTreeInfo(ctx, t.storage, t.mtAddress)
+		if err != nil {
+			t.Error("mutate FindTreeInfo err: ", err)
+			return err
+		}
+		if info != nil && info.Sealed {
+			return ErrTreeSealed
+		}
+
+		return t.journaled(ctx, lease, leaves, func() (appended []string, err error) {
+			for _, leaf := range leaves {
+				var added bool
+				err = t.withTx(ctx, lease, func(ctx context.Context, storage db.Storage) (err error) {
+					added, err = t.appendLeaf(ctx, storage, leaf)
+					return err
+				})
+				if err != nil {
+					return appended, err
+				}
+				if added {
+					appended = append(appended, leaf)
+				}
+			}
+			return appended, nil
+		})
+	})
+}
+
+// exclusive serializes fn with every other mutation of the tree, holding the
+// distributed lock as well when a Locker is configured. The ctx given to fn
+// carries the lease's fencing token and is cancelled if the lease is lost.
+func (t *MerkleTree) exclusive(ctx context.Context, fn func(ctx context.Context, lease db.Lease) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// 等锁期间可能已超时
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if t.locker == nil {
+		return fn(ctx, nil)
 	}
 
+	lease, err := t.locker.Acquire(ctx, t.mtAddress)
+	if err != nil {
+		t.Error("exclusive Acquire err: ", err)
+		return err
+	}
+	defer func() {
+		if err := lease.Release(context.Background()); err != nil {
+			t.Error("exclusive Release err: ", err)
+		}
+	}()
+
+	// 租约丢失时立即取消所有存储调用
+	ctx, cancel := context.WithCancel(db.WithFencingToken(ctx, lease.Token()))
+	defer cancel()
+	go func() {
+		select {
+		case <-lease.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err = fn(ctx, lease)
+	if err != nil && lease.Err() != nil {
+		return lease.Err()
+	}
+	return err
+}
+
+// withTx runs fn inside one transaction when the storage supports it, so a
+// failed write never leaves a leaf behind with stale branch hashes. Nothing is
+// committed once the lease, if any, has been lost.
+func (t *MerkleTree) withTx(ctx context.Context, lease db.Lease, fn func(ctx context.Context, storage db.Storage) error) error {
+	if !db.Supports(t.storage, (*db.TxStorage)(nil)) {
+		return fn(ctx, t.storage)
+	}
+	txStorage := t.storage.(db.TxStorage)
+
+	tx, err := txStorage.Begin(ctx)
+	if err != nil {
+		t.Error("withTx Begin err: ", err)
+		return err
+	}
+
+	if err = fn(ctx, tx); err == nil && lease != nil {
+		err = lease.Err()
+	}
+	if err != nil {
+		if rbErr := tx.Rollback(ctx); rbErr != nil {
+			t.Error("withTx Rollback err: ", rbErr)
+		}
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		t.Error("withTx Commit err: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// appendLeaf appends data unless the tree already holds it, and reports
+// whether it did.
+func (t *MerkleTree) appendLeaf(ctx context.Context, storage db.Storage, data string) (bool, error) {
 	// 1. 查询是否已有，直接返回
-	leaf, err := t.getLeafNodeByData(data)
+	leaf, err := t.getLeafNodeByData(ctx, storage, data)
 	if err != nil {
 		t.Error("AppendLeaf getLeafNodeByData err: ", err)
-		return err
+		return false, err
 	}
 
 	if leaf != nil {
-		return nil
+		observed(ctx, leaf.LevelNo, 0)
+		return false, nil
 	}
 
 	// 2. 生成叶子
 	leaf = &db.TreeNode{
 		MtAddress: t.mtAddress,
 		Data:      data,
-		Hash:      keccak256.Bytes2Hex(keccak256.HashLeaf(data[2:])),
+		Hash:      keccak256.Bytes2Hex(t.hasher.HashLeaf(data)),
 		Level:     0,
 		LevelNo:   0,
 	}
 	t.Info("AppendLeaf leaf: ", leaf)
 
 	// 3. 找到对应的branch
-	branches, leaf, err := t.doNewTreeBranches(leaf)
+	branches, leaf, err := t.doNewTreeBranches(ctx, storage, leaf)
+	if err != nil {
+		t.Error("AppendLeaf doNewTreeBranches err: ", err)
+		return false, err
+	}
 
 	for _, branch := range branches {
 		t.Info("AppendLeaf branche: ", branch)
 	}
 	// 4. 关联到branch，并修改branch的hash值
 	if len(branches) == 0 {
-		return nil
+		return true, nil
 	}
 
-	root, err := t.storage.FindRootNode(t.ctx, t.mtAddress)
+	root, err := storage.FindRootNode(ctx, t.mtAddress)
 	if err != nil && err != db.ErrNotFound {
 		t.Error("AppendLeaf FindRootNode err: ", err)
-		return err
+		return false, err
 	}
 
 	hash := ""
@@ -85,7 +276,7 @@ func (t *MerkleTree) AppendLeaf(data string) error {
 		// 计算叶子节点hash
 		if i == 0 {
 			if !isEven(levelNo) && branch[levelNo-1] != nil {
-				hash = keccak256.Bytes2Hex(keccak256.HashBranch(branch[levelNo-1].Hash, branch[levelNo].Hash))
+				hash = t.hashBranch(branch[levelNo-1].Hash, branch[levelNo].Hash)
 			} else {
 				hash = branch[levelNo].Hash
 			}
@@ -98,28 +289,28 @@ func (t *MerkleTree) AppendLeaf(data string) error {
 					Level:     i,
 					LevelNo:   levelNo,
 				}
-				err = t.storage.Insert(t.ctx, branchNode)
+				err = storage.Insert(ctx, branchNode)
 				if err != nil {
 					t.Error("AppendLeaf Insert err: ", err)
-					return err
+					return false, err
 				}
 				branch[levelNo] = branchNode
 			} else {
 				branch[levelNo].Hash = hash
-				err = t.storage.Update(t.ctx, branch[levelNo])
+				err = storage.Update(ctx, branch[levelNo])
 				if err != nil {
 					t.Error("AppendLeaf Update err: ", err)
-					return err
+					return false, err
 				}
 			}
 
 			if !isEven(levelNo) {
 				if branch[levelNo-1] != nil {
-					hash = keccak256.Bytes2Hex(keccak256.HashBranch(branch[levelNo-1].Hash, branch[levelNo].Hash))
+					hash = t.hashBranch(branch[levelNo-1].Hash, branch[levelNo].Hash)
 				}
 			} else {
 				if branch[levelNo+1] != nil {
-					hash = keccak256.Bytes2Hex(keccak256.HashBranch(branch[levelNo].Hash, branch[levelNo+1].Hash))
+					hash = t.hashBranch(branch[levelNo].Hash, branch[levelNo+1].Hash)
 				}
 
 				if root.Level == i && levelNo == 0 && branch[levelNo+1] == nil {
@@ -132,26 +323,29 @@ func (t *MerkleTree) AppendLeaf(data string) error {
 		levelNo = int(levelNoDecimal.IntPart())
 	}
 
+	levels := len(branches)
 	// 新建根节点
 	if needCreateRoot {
+		levels++
 		rootNode := &db.TreeNode{
 			MtAddress: t.mtAddress,
 			Hash:      hash,
 			Level:     i,
 			LevelNo:   levelNo,
 		}
-		err = t.storage.Insert(t.ctx, rootNode)
+		err = storage.Insert(ctx, rootNode)
 		if err != nil {
 			t.Error("AppendLeaf Insert err: ", err)
-			return err
+			return false, err
 		}
 	}
 
-	return nil
+	observed(ctx, leaf.LevelNo, levels)
+	return true, nil
 }
 
-func (t *MerkleTree) getLeafNodeByData(data string) (*db.TreeNode, error) {
-	leaf, err := t.storage.FindOneByLeafData(t.ctx, t.mtAddress, data)
+func (t *MerkleTree) getLeafNodeByData(ctx context.Context, storage db.Storage, data string) (*db.TreeNode, error) {
+	leaf, err := storage.FindOneByLeafData(ctx, t.mtAddress, data)
 	if err != nil && err != db.ErrNotFound {
 		t.Error("getLeafNodeByData FindOneByLeafData err: ", err)
 		return nil, err
@@ -160,18 +354,47 @@ func (t *MerkleTree) getLeafNodeByData(data string) (*db.TreeNode, error) {
 	return leaf, nil
 }
 
+// GetRootNode is GetRootNodeCtx with the context the tree was created with.
 func (t *MerkleTree) GetRootNode() (*db.TreeNode, error) {
-	rootNode, err := t.storage.FindRootNode(t.ctx, t.mtAddress)
-	if err != nil && err != db.ErrNotFound {
+	return t.GetRootNodeCtx(t.ctx)
+}
+
+// GetRootNodeCtx returns the root, nil for an empty tree.
+func (t *MerkleTree) GetRootNodeCtx(ctx context.Context) (rootNode *db.TreeNode, err error) {
+	ctx, end := t.observe(ctx, OpRoot)
+	defer func() { end(err) }()
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	rootNode, err = t.storage.FindRootNode(ctx, t.mtAddress)
+	if err == db.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
 		t.Error("GetRootNode FindRootNode err: ", err)
 		return nil, err
 	}
 
+	observed(ctx, -1, rootNode.Level+1)
 	return rootNode, nil
 }
 
+// GenerateProof is GenerateProofCtx with the context the tree was created with.
 func (t *MerkleTree) GenerateProof(data string) ([][]byte, error) {
-	leaf, err := t.getLeafNodeByData(data)
+	return t.GenerateProofCtx(t.ctx, data)
+}
+
+// GenerateProofCtx returns the proof of the leaf holding data, empty when
+// there is no such leaf.
+func (t *MerkleTree) GenerateProofCtx(ctx context.Context, data string) (proofs [][]byte, err error) {
+	ctx, end := t.observe(ctx, OpProof)
+	defer func() { end(err) }()
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	leaf, err := t.getLeafNodeByData(ctx, t.storage, data)
 	if err != nil && err != db.ErrNotFound {
 		t.Error("GenerateProof FindOneByLeafData err: ", err)
 		return nil, err
@@ -180,12 +403,61 @@ func (t *MerkleTree) GenerateProof(data string) ([][]byte, error) {
 	if leaf == nil {
 		return make([][]byte, 0), nil
 	}
+	return t.proof(ctx, leaf)
+}
+
+// RootedProof is the proof of a leaf together with the root it proves the
+// leaf against.
+type RootedProof struct {
+	Index int
+	Proof [][]byte
+	Root  *db.TreeNode
+}
+
+// GenerateRootedProof is GenerateRootedProofCtx with the context the tree
+// was created with.
+func (t *MerkleTree) GenerateRootedProof(data string) (*RootedProof, error) {
+	return t.GenerateRootedProofCtx(t.ctx, data)
+}
 
-	referTree, err := t.getReferTreeByLeaf(leaf)
+// GenerateRootedProofCtx returns the proof of the leaf holding data with the
+// root and the leaf index, nil when there is no such leaf. They are read
+// under one lock, so the proof verifies against the root even while leaves
+// are appended, unlike calling GenerateProof and GetRootNode in turn.
+func (t *MerkleTree) GenerateRootedProofCtx(ctx context.Context, data string) (rooted *RootedProof, err error) {
+	ctx, end := t.observe(ctx, OpProof)
+	defer func() { end(err) }()
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	leaf, err := t.getLeafNodeByData(ctx, t.storage, data)
+	if err != nil {
+		return nil, err
+	}
+	if leaf == nil {
+		return nil, nil
+	}
+	proofs, err := t.proof(ctx, leaf)
+	if err != nil {
+		return nil, err
+	}
+	root, err := t.storage.FindRootNode(ctx, t.mtAddress)
+	if err != nil {
+		t.Error("GenerateRootedProof FindRootNode err: ", err)
+		return nil, err
+	}
+	return &RootedProof{Index: leaf.LevelNo, Proof: proofs, Root: root}, nil
+}
+
+// proof returns the proof of leaf, the read lock held.
+func (t *MerkleTree) proof(ctx context.Context, leaf *db.TreeNode) ([][]byte, error) {
+	referTree, err := t.getReferTreeByLeaf(ctx, t.storage, leaf)
 	if err != nil {
 		t.Error("GenerateProof getReferTreeByLeaf err: ", err)
 		return nil, err
 	}
+	observed(ctx, leaf.LevelNo, len(referTree))
 
 	var retSz [][]byte
 	maxlevelNoDecimal := decimal.NewFromInt(int64(leaf.LevelNo))
@@ -209,36 +481,126 @@ func (t *MerkleTree) GenerateProof(data string) ([][]byte, error) {
 	return retSz, nil
 }
 
+// VerifyProof is VerifyProofCtx with the context the tree was created with.
 func (t *MerkleTree) VerifyProof(proofs [][]byte, user string) (bool, error) {
-	if !IsAddress(user) {
+	return t.VerifyProofCtx(t.ctx, proofs, user)
+}
+
+// VerifyProofCtx reports whether proofs prove user against the current root.
+func (t *MerkleTree) VerifyProofCtx(ctx context.Context, proofs [][]byte, user string) (ok bool, err error) {
+	ctx, end := t.observe(ctx, OpVerify)
+	defer func() { end(err) }()
+
+	if t.schema.Validate(user) != nil {
 		return false, nil
 	}
-	hash := keccak256.HashLeaf(user[2:])
-	if len(proofs) > 0 {
-		for _, proof := range proofs {
-			t.Info("VerifyProof Hash: ", keccak256.Bytes2Hex(hash), keccak256.Bytes2Hex(proof))
-			hash = keccak256.HashByteBranch(hash, proof)
-		}
-	}
 
 	// 对比根节点
-	node, err := t.storage.FindRootNode(t.ctx, t.mtAddress)
+	t.mu.RLock()
+	node, err := t.storage.FindRootNode(ctx, t.mtAddress)
+	t.mu.RUnlock()
 	if err != nil && err != db.ErrNotFound {
 		t.Error("VerifyProof FindOneByLeafData err: ", err)
 		return false, err
 	}
 
-	t.Info("VerifyProof hash: ", node.Hash, keccak256.Bytes2Hex(hash))
-	if node.Hash == keccak256.Bytes2Hex(hash) {
-		return true, nil
+	// 空树不包含任何叶子
+	if node == nil {
+		return false, nil
 	}
+	observed(ctx, -1, node.Level+1)
 
-	return false, nil
+	return VerifyProofRoot(t.hasher, node.Hash, proofs, user), nil
+}
+
+// VerifyProofRoot reports whether proofs prove leaf against root, a hex hash,
+// with hasher. Unlike VerifyProof it needs no tree, leaf must however be
+// valid for hasher.
+func VerifyProofRoot(hasher Hasher, root string, proofs [][]byte, leaf string) bool {
+	hash := hasher.HashLeaf(leaf)
+	for _, proof := range proofs {
+		hash = hasher.HashPair(hash, proof)
+	}
+
+	return root == keccak256.Bytes2Hex(hash)
+}
+
+// LeafIndex is LeafIndexCtx with the context the tree was created with.
+func (t *MerkleTree) LeafIndex(data string) (int, error) {
+	return t.LeafIndexCtx(t.ctx, data)
+}
+
+// LeafIndexCtx returns the position of the leaf holding data, -1 when the
+// tree has no such leaf.
+func (t *MerkleTree) LeafIndexCtx(ctx context.Context, data string) (index int, err error) {
+	ctx, end := t.observe(ctx, OpLeafIndex)
+	defer func() { end(err) }()
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	leaf, err := t.getLeafNodeByData(ctx, t.storage, data)
+	if err != nil {
+		return -1, err
+	}
+	if leaf == nil {
+		return -1, nil
+	}
+	observed(ctx, leaf.LevelNo, 0)
+	return leaf.LevelNo, nil
+}
+
+// LeafHashes is LeafHashesCtx with the context the tree was created with.
+func (t *MerkleTree) LeafHashes() (map[string]int, error) {
+	return t.LeafHashesCtx(t.ctx)
+}
+
+// LeafHashesCtx returns the position of every leaf of the tree by the hex
+// hash of its data. Unlike LeafIndexCtx, which looks leaves up by their exact
+// data, it finds a leaf whatever form, e.g. letter case, its data was given in.
+func (t *MerkleTree) LeafHashesCtx(ctx context.Context) (indexes map[string]int, err error) {
+	ctx, end := t.observe(ctx, OpLeafHashes)
+	defer func() { end(err) }()
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	leaves, err := t.storage.FindNodesByLevel(ctx, t.mtAddress, 0)
+	if err != nil && err != db.ErrNotFound {
+		t.Error("LeafHashesCtx FindNodesByLevel err: ", err)
+		return nil, err
+	}
+	indexes = make(map[string]int, len(leaves))
+	for _, leaf := range leaves {
+		indexes[leaf.Hash] = leaf.LevelNo
+	}
+	return indexes, nil
+}
+
+// LeafCount is LeafCountCtx with the context the tree was created with.
+func (t *MerkleTree) LeafCount() (int, error) {
+	return t.LeafCountCtx(t.ctx)
+}
+
+// LeafCountCtx returns the number of leaves of the tree, 0 for an empty tree.
+func (t *MerkleTree) LeafCountCtx(ctx context.Context) (count int, err error) {
+	ctx, end := t.observe(ctx, OpLeafCount)
+	defer func() { end(err) }()
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	meta, err := treeMeta(ctx, t.storage, t.mtAddress)
+	if err != nil {
+		t.Error("LeafCountCtx FindTreeMeta err: ", err)
+		return 0, err
+	}
+	return meta.LeafCount, nil
 }
 
 // 返回数据中map为每层的对应相关数据，数组为层级
-func (t *MerkleTree) doNewTreeBranches(leaf *db.TreeNode) ([]map[int]*db.TreeNode, *db.TreeNode, error) {
-	maxLevelNo, err := t.storage.FindMaxNoOfLeaf(t.ctx, t.mtAddress)
+func (t *MerkleTree) doNewTreeBranches(ctx context.Context, storage db.Storage, leaf *db.TreeNode) ([]map[int]*db.TreeNode, *db.TreeNode, error) {
+	maxLevelNo, err := storage.FindMaxNoOfLeaf(ctx, t.mtAddress)
 	if err != nil && err != db.ErrNotFound {
 		t.Error("doNewTreeBranches FindMaxNoOfLeaf err: ", err)
 		return nil, nil, err
@@ -246,14 +608,14 @@ func (t *MerkleTree) doNewTreeBranches(leaf *db.TreeNode) ([]map[int]*db.TreeNod
 
 	// 创建新叶子
 	leaf.LevelNo = maxLevelNo + 1
-	err = t.storage.Insert(t.ctx, leaf)
+	err = storage.Insert(ctx, leaf)
 	if err != nil {
 		t.Error("doNewTreeBranches Insert err: ", err)
 		return nil, nil, err
 	}
 
 	// 树为空的时候
-	retSz, err := t.getReferTreeByLeaf(leaf)
+	retSz, err := t.getReferTreeByLeaf(ctx, storage, leaf)
 	if err != nil {
 		t.Error("doNewTreeBranches getReferTreeByLeaf err: ", err)
 		return nil, nil, err
@@ -262,9 +624,9 @@ func (t *MerkleTree) doNewTreeBranches(leaf *db.TreeNode) ([]map[int]*db.TreeNod
 	return retSz, leaf, nil
 }
 
-func (t *MerkleTree) getReferTreeByLeaf(leaf *db.TreeNode) ([]map[int]*db.TreeNode, error) {
+func (t *MerkleTree) getReferTreeByLeaf(ctx context.Context, storage db.Storage, leaf *db.TreeNode) ([]map[int]*db.TreeNode, error) {
 
-	root, err := t.storage.FindRootNode(t.ctx, t.mtAddress)
+	root, err := storage.FindRootNode(ctx, t.mtAddress)
 	if err != nil && err != db.ErrNotFound {
 		t.Error("getReferTreeByLeaf FindOneByLeafData err: ", err)
 		return nil, err
@@ -285,7 +647,7 @@ func (t *MerkleTree) getReferTreeByLeaf(leaf *db.TreeNode) ([]map[int]*db.TreeNo
 	}*/
 
 	//t.Info("getReferTreeByLeaf info  leaf: ", leaf, nodePoses)
-	treeNodes, err := t.storage.FindMultiTreeNode(t.ctx, t.mtAddress, nodePoses)
+	treeNodes, err := storage.FindMultiTreeNode(ctx, t.mtAddress, nodePoses)
 	if err != nil {
 		t.Error("getReferTreeByLeaf FindMultiTreeNode err: ", err)
 		return nil, err
@@ -309,27 +671,23 @@ func (t *MerkleTree) getReferTreeByLeaf(leaf *db.TreeNode) ([]map[int]*db.TreeNo
 	return retSz, nil
 }
 
+// PrintTree is PrintTreeCtx with the context the tree was created with.
 func (t *MerkleTree) PrintTree() error {
-	root, err := t.storage.FindRootNode(t.ctx, t.mtAddress)
-	if err != nil && err != db.ErrNotFound {
-		t.Error("PrintTree FindOneByLeafData err: ", err)
-		return err
-	}
+	return t.PrintTreeCtx(t.ctx)
+}
 
-	level := root.Level
-	t.Error("PrintTree root: ", root)
-	for i := level; i >= 0; i-- {
-		nodes, err := t.storage.FindNodesByLevel(t.ctx, t.mtAddress, i)
-		if err != nil {
-			t.Error("PrintTree FindOneByLeafData err: ", err)
-			return err
-		}
+// PrintTreeCtx logs the tree as RenderASCII draws it.
+func (t *MerkleTree) PrintTreeCtx(ctx context.Context) (err error) {
+	ctx, end := t.observe(ctx, OpPrint)
+	defer func() { end(err) }()
 
-		for _, node := range nodes {
-			t.Error(fmt.Sprintf("PrintTree level=%d, levelNo=%d", node.Level, node.LevelNo), node)
-		}
+	var sb strings.Builder
+	if err = t.RenderASCIICtx(ctx, &sb, RenderOptions{}); err != nil {
+		t.Error("PrintTree RenderASCII err: ", err)
+		return err
 	}
 
+	t.Info("PrintTree " + t.mtAddress + ":\n" + sb.String())
 	return nil
 }
 
@@ -367,6 +725,11 @@ func calcNodeBranches(maxLevelNo, rootLevel int) []*db.NodePos {
 	return retSz
 }
 
+// hashBranch returns the hex hash of the parent of two hex hashes.
+func (t *MerkleTree) hashBranch(left, right string) string {
+	return keccak256.Bytes2Hex(t.hasher.HashPair(keccak256.Hex2Bytes(left), keccak256.Hex2Bytes(right)))
+}
+
 // 判断是偶数
 func isEven(num int) bool {
 	if num%2 == 0 {
@@ -1,14 +1,26 @@
 package merkletree
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/UXUYLabs/go-merkletree/db"
 	"github.com/UXUYLabs/go-merkletree/db/chache"
+	"github.com/UXUYLabs/go-merkletree/db/memory"
 	"github.com/UXUYLabs/go-merkletree/keccak256"
+	"github.com/alicebob/miniredis/v2"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 var merkleTreeManager *MerkleTreeManager
@@ -23,6 +35,19 @@ func setup() {
 	}
 }
 
+// skipWithoutRedis skips t when no redis listens on localhost:6379, which the
+// redis tests not using miniredis need.
+func skipWithoutRedis(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	defer rdb.Close()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skip("redis unreachable: ", err)
+	}
+}
+
 func setupRedis() {
 	ctx := context.Background()
 	merkleTreeManager, err = NewMerkleTreeManager(ctx, chache.NewRedisStorage())
@@ -150,7 +175,964 @@ func TestMemAppend2(t *testing.T) {
 	assert.Equal(t, proof, false)
 }
 
+// failingTxStorage fails the n-th Update made inside a transaction.
+type failingTxStorage struct {
+	*memory.MemoryStorage
+	failOnUpdate int
+}
+
+func (s *failingTxStorage) Begin(ctx context.Context) (db.Tx, error) {
+	tx, err := s.MemoryStorage.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &failingTx{Tx: tx, failOnUpdate: s.failOnUpdate}, nil
+}
+
+type failingTx struct {
+	db.Tx
+	updates      int
+	failOnUpdate int
+}
+
+func (tx *failingTx) Update(ctx context.Context, node *db.TreeNode) error {
+	tx.updates++
+	if tx.updates == tx.failOnUpdate {
+		return errors.New("update failed")
+	}
+	return tx.Tx.Update(ctx, node)
+}
+
+func TestMemAppendRollback(t *testing.T) {
+	storage := &failingTxStorage{MemoryStorage: memory.NewMemoryStorage()}
+	tree, err := NewMerkleTree(context.Background(), storage, "1637704523306766336")
+	assert.Nil(t, err)
+
+	assert.Nil(t, tree.AppendLeaf("0x8b1b201E91966957f18bBcDDB520c53c521bF5cd"))
+	assert.Nil(t, tree.AppendLeaf("0xeA726629EC5fe5cE300000d1a8c89B3054A22cE7"))
+	assert.Nil(t, tree.AppendLeaf("0x00440DC3377A8a6b745aB5F92fD850b7c7291DdE"))
+
+	root, err := tree.GetRootNode()
+	assert.Nil(t, err)
+
+	storage.failOnUpdate = 1
+	err = tree.AppendLeaf("0x7e533CF779A533eD8f9C1b8E5C3d7F936335ca54")
+	assert.NotNil(t, err)
+
+	// 失败的追加不能留下任何节点
+	after, err := tree.GetRootNode()
+	assert.Nil(t, err)
+	assert.Equal(t, root, after)
+
+	_, err = storage.FindOneByLeafData(context.Background(), "1637704523306766336", "0x7e533CF779A533eD8f9C1b8E5C3d7F936335ca54")
+	assert.Equal(t, db.ErrNotFound, err)
+
+	maxNo, err := storage.FindMaxNoOfLeaf(context.Background(), "1637704523306766336")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, maxNo)
+
+	storage.failOnUpdate = 0
+	assert.Nil(t, tree.AppendLeaf("0x7e533CF779A533eD8f9C1b8E5C3d7F936335ca54"))
+
+	proofes, err := tree.GenerateProof("0x7e533CF779A533eD8f9C1b8E5C3d7F936335ca54")
+	assert.Nil(t, err)
+
+	proof, err := tree.VerifyProof(proofes, "0x7e533CF779A533eD8f9C1b8E5C3d7F936335ca54")
+	assert.Nil(t, err)
+	assert.Equal(t, true, proof)
+}
+
+// cancelingStorage cancels the context of an append after its first write.
+type cancelingStorage struct {
+	*memory.MemoryStorage
+	cancel context.CancelFunc
+}
+
+func (s *cancelingStorage) Begin(ctx context.Context) (db.Tx, error) {
+	tx, err := s.MemoryStorage.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &cancelingTx{Tx: tx, cancel: s.cancel}, nil
+}
+
+type cancelingTx struct {
+	db.Tx
+	cancel context.CancelFunc
+}
+
+func (tx *cancelingTx) Insert(ctx context.Context, node *db.TreeNode) error {
+	err := tx.Tx.Insert(ctx, node)
+	if tx.cancel != nil {
+		tx.cancel()
+	}
+	return err
+}
+
+func TestMemAppendCancelled(t *testing.T) {
+	// 创建时的ctx被取消不影响按调用传入的ctx
+	created, cancel := context.WithCancel(context.Background())
+	cancel()
+	storage := &cancelingStorage{MemoryStorage: memory.NewMemoryStorage()}
+	tree, err := NewMerkleTree(created, storage, "1637704523306766336", WithLogger(DiscardLogger))
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	assert.Nil(t, tree.AppendLeafCtx(ctx, "0x8b1b201E91966957f18bBcDDB520c53c521bF5cd"))
+	assert.Nil(t, tree.AppendLeafCtx(ctx, "0xeA726629EC5fe5cE300000d1a8c89B3054A22cE7"))
+	assert.Nil(t, tree.AppendLeafCtx(ctx, "0x00440DC3377A8a6b745aB5F92fD850b7c7291DdE"))
+	assert.ErrorIs(t, tree.AppendLeaf("0x63120cc1c7Bb0a42C2D77D27faB9EDd2560F9cA3"), context.Canceled)
+
+	root, err := tree.GetRootNodeCtx(ctx)
+	assert.Nil(t, err)
+
+	requestCtx, cancelRequest := context.WithCancel(ctx)
+	storage.cancel = cancelRequest
+	err = tree.AppendLeafCtx(requestCtx, "0x7e533CF779A533eD8f9C1b8E5C3d7F936335ca54")
+	assert.ErrorIs(t, err, context.Canceled)
+	storage.cancel = nil
+
+	// 中途取消的追加不能留下任何节点
+	after, err := tree.GetRootNodeCtx(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, root, after)
+	maxNo, err := storage.FindMaxNoOfLeaf(ctx, "1637704523306766336")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, maxNo)
+
+	_, err = tree.GenerateProofCtx(requestCtx, "0x8b1b201E91966957f18bBcDDB520c53c521bF5cd")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	assert.Nil(t, tree.AppendLeafCtx(ctx, "0x7e533CF779A533eD8f9C1b8E5C3d7F936335ca54"))
+	proofes, err := tree.GenerateProofCtx(ctx, "0x7e533CF779A533eD8f9C1b8E5C3d7F936335ca54")
+	assert.Nil(t, err)
+	proof, err := tree.VerifyProofCtx(ctx, proofes, "0x7e533CF779A533eD8f9C1b8E5C3d7F936335ca54")
+	assert.Nil(t, err)
+	assert.True(t, proof)
+
+	root, err = tree.GetRootNodeCtx(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, expectedRoot(t, storage, "1637704523306766336"), root.Hash)
+}
+
+// expectedRoot recomputes the root from the level 0 leaves, promoting an
+// unpaired node to the next level as AppendLeaf does.
+func expectedRoot(t *testing.T, storage db.Storage, mtAddress string) string {
+	leaves, err := storage.FindNodesByLevel(context.Background(), mtAddress, 0)
+	assert.Nil(t, err)
+	sort.Slice(leaves, func(i, j int) bool { return leaves[i].LevelNo < leaves[j].LevelNo })
+
+	var level [][]byte
+	for i, leaf := range leaves {
+		assert.Equal(t, i, leaf.LevelNo)
+		assert.Equal(t, keccak256.Bytes2Hex(keccak256.HashLeaf(leaf.Data[2:])), leaf.Hash)
+		level = append(level, keccak256.HashLeaf(leaf.Data[2:]))
+	}
+
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 < len(level) {
+				next = append(next, keccak256.HashByteBranch(level[i], level[i+1]))
+			} else {
+				next = append(next, level[i])
+			}
+		}
+		level = next
+	}
+	return keccak256.Bytes2Hex(level[0])
+}
+
+func TestMemConcurrentAppend(t *testing.T) {
+	manager, err := NewMemoryMerkleTreeManager(context.Background())
+	assert.Nil(t, err)
+
+	const workers = 8
+	const perWorker = 25
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			// 每个goroutine使用独立的句柄，模拟并发的HTTP请求
+			tree, err := manager.CreateMerkleTree("1637704523306766336")
+			assert.Nil(t, err)
+			for i := 0; i < perWorker; i++ {
+				data := fmt.Sprintf("0x%040x", w*perWorker+i+1)
+				assert.Nil(t, tree.AppendLeaf(data))
+				_, err := tree.GetRootNode()
+				assert.Nil(t, err)
+				// 并发追加时证明仍与同时读出的根匹配
+				rooted, err := tree.GenerateRootedProof(data)
+				if assert.Nil(t, err) && assert.NotNil(t, rooted) {
+					assert.True(t, VerifyProofRoot(Keccak256Hasher, rooted.Root.Hash, rooted.Proof, data), data)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	tree, err := manager.CreateMerkleTree("1637704523306766336")
+	assert.Nil(t, err)
+
+	maxNo, err := manager.storage.FindMaxNoOfLeaf(context.Background(), "1637704523306766336")
+	assert.Nil(t, err)
+	assert.Equal(t, workers*perWorker-1, maxNo)
+
+	root, err := tree.GetRootNode()
+	assert.Nil(t, err)
+	assert.Equal(t, expectedRoot(t, manager.storage, "1637704523306766336"), root.Hash)
+
+	for i := 1; i <= workers*perWorker; i++ {
+		data := fmt.Sprintf("0x%040x", i)
+		proofes, err := tree.GenerateProof(data)
+		assert.Nil(t, err)
+		proof, err := tree.VerifyProof(proofes, data)
+		assert.Nil(t, err)
+		assert.True(t, proof, data)
+	}
+	rooted, err := tree.GenerateRootedProof("0x0000000000000000000000000000000000000000")
+	assert.Nil(t, err)
+	assert.Nil(t, rooted)
+}
+
+// lostLocker grants leases that are already lost.
+type lostLocker struct{}
+
+type lostLease struct{ done chan struct{} }
+
+func (lostLocker) Acquire(ctx context.Context, key string) (db.Lease, error) {
+	done := make(chan struct{})
+	close(done)
+	return &lostLease{done: done}, nil
+}
+
+func (l *lostLease) Token() int64                      { return 1 }
+func (l *lostLease) Done() <-chan struct{}             { return l.done }
+func (l *lostLease) Err() error                        { return db.ErrLockLost }
+func (l *lostLease) Release(ctx context.Context) error { return nil }
+
+func TestMemAppendLeaseLost(t *testing.T) {
+	storage := memory.NewMemoryStorage()
+	tree, err := NewMerkleTree(context.Background(), storage, "1637704523306766336", WithLocker(lostLocker{}), WithLogger(DiscardLogger))
+	assert.Nil(t, err)
+
+	err = tree.AppendLeaf("0x8b1b201E91966957f18bBcDDB520c53c521bF5cd")
+	assert.Equal(t, db.ErrLockLost, err)
+
+	_, err = storage.FindMaxNoOfLeaf(context.Background(), "1637704523306766336")
+	assert.Equal(t, db.ErrNotFound, err)
+}
+
+func TestRedisLockedReplicasAppend(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	// 每个副本拥有独立的连接和管理器，只能依赖分布式锁互斥
+	const replicas = 3
+	const perReplica = 10
+	var wg sync.WaitGroup
+	for r := 0; r < replicas; r++ {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		manager, err := NewMerkleTreeManager(context.Background(), chache.NewRedisStorageWithClient(client),
+			WithLocker(chache.NewRedisLocker(client, time.Second)), WithLogger(DiscardLogger))
+		assert.Nil(t, err)
+
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			tree, err := manager.CreateMerkleTree("1637704523306766336")
+			assert.Nil(t, err)
+			for i := 0; i < perReplica; i++ {
+				assert.Nil(t, tree.AppendLeaf(fmt.Sprintf("0x%040x", r*perReplica+i+1)))
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	storage := chache.NewRedisStorageWithClient(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	maxNo, err := storage.FindMaxNoOfLeaf(context.Background(), "1637704523306766336")
+	assert.Nil(t, err)
+	assert.Equal(t, replicas*perReplica-1, maxNo)
+
+	root, err := storage.FindRootNode(context.Background(), "1637704523306766336")
+	assert.Nil(t, err)
+	assert.Equal(t, expectedRoot(t, storage, "1637704523306766336"), root.Hash)
+}
+
+func TestMemDeleteTreeAndGC(t *testing.T) {
+	manager, err := NewMemoryMerkleTreeManager(context.Background(), WithLogger(DiscardLogger))
+	assert.Nil(t, err)
+
+	for _, mtAddress := range []string{"campaign-1", "campaign-2", "campaign-3"} {
+		tree, err := manager.CreateMerkleTree(mtAddress)
+		assert.Nil(t, err)
+		assert.Nil(t, tree.AppendLeaf("0x8b1b201E91966957f18bBcDDB520c53c521bF5cd"))
+		assert.Nil(t, tree.AppendLeaf("0xeA726629EC5fe5cE300000d1a8c89B3054A22cE7"))
+	}
+
+	assert.Nil(t, manager.DeleteTree("campaign-1"))
+	_, err = manager.storage.FindRootNode(context.Background(), "campaign-1")
+	assert.Equal(t, db.ErrNotFound, err)
+	// 删除的树不再保留锁
+	assert.NotContains(t, manager.locks, "campaign-1")
+
+	assert.Nil(t, manager.ExpireTree("campaign-2", time.Now().Add(-time.Second)))
+	assert.Nil(t, manager.ExpireTree("campaign-3", time.Now().Add(time.Hour)))
+
+	stop := manager.StartGC(10 * time.Millisecond)
+	assert.Eventually(t, func() bool {
+		_, err := manager.storage.FindRootNode(context.Background(), "campaign-2")
+		return err == db.ErrNotFound
+	}, time.Second, 10*time.Millisecond)
+	stop()
+	manager.mu.Lock()
+	assert.NotContains(t, manager.locks, "campaign-2")
+	assert.Contains(t, manager.locks, "campaign-3")
+	manager.mu.Unlock()
+
+	_, err = manager.storage.FindRootNode(context.Background(), "campaign-3")
+	assert.Nil(t, err)
+}
+
+// failingDeleteStorage fails to delete one tree.
+type failingDeleteStorage struct {
+	*memory.MemoryStorage
+	failing string
+}
+
+func (s *failingDeleteStorage) DeleteTree(ctx context.Context, address string) error {
+	if address == s.failing {
+		return errors.New("delete failed")
+	}
+	return s.MemoryStorage.DeleteTree(ctx, address)
+}
+
+func TestMemGCContinuesPastFailures(t *testing.T) {
+	storage := &failingDeleteStorage{MemoryStorage: memory.NewMemoryStorage(), failing: "campaign-1"}
+	manager, err := NewMerkleTreeManager(context.Background(), storage, WithLogger(DiscardLogger))
+	assert.Nil(t, err)
+
+	for _, mtAddress := range []string{"campaign-1", "campaign-2", "campaign-3"} {
+		tree, err := manager.CreateMerkleTree(mtAddress)
+		assert.Nil(t, err)
+		assert.Nil(t, tree.AppendLeaf("0x8b1b201E91966957f18bBcDDB520c53c521bF5cd"))
+		assert.Nil(t, manager.ExpireTree(mtAddress, time.Now().Add(-time.Second)))
+	}
+
+	// 一棵树删除失败不影响其余的树
+	deleted, err := manager.CollectGarbage()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "campaign-1")
+	assert.Equal(t, []string{"campaign-2", "campaign-3"}, deleted)
+}
+
+// plainStorage only has the methods of db.Storage, none of the optional ones.
+type plainStorage struct {
+	db.Storage
+}
+
+func TestMemPlainStorage(t *testing.T) {
+	manager, err := NewMerkleTreeManager(context.Background(), plainStorage{memory.NewMemoryStorage()}, WithLogger(DiscardLogger))
+	assert.Nil(t, err)
+	tree, err := manager.CreateMerkleTree("1637704523306766336")
+	assert.Nil(t, err)
+	assert.Nil(t, tree.AppendLeaves([]string{"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359"}))
+
+	// 缺少可选能力时明确报错
+	assert.Equal(t, db.ErrNotSupported, manager.DeleteTree("1637704523306766336"))
+	assert.Equal(t, db.ErrNotSupported, manager.ExpireTree("1637704523306766336", time.Now()))
+	_, err = manager.CollectGarbage()
+	assert.Equal(t, db.ErrNotSupported, err)
+	manager.StartGC(time.Millisecond)()
+	_, err = manager.CreateTree("campaign-1")
+	assert.Equal(t, db.ErrNotSupported, err)
+	_, err = manager.ListTrees()
+	assert.Equal(t, db.ErrNotSupported, err)
+	assert.Equal(t, db.ErrNotSupported, manager.SealTree("1637704523306766336"))
+
+	// 无登记表时有节点的树以默认哈希与叶子格式打开
+	_, err = manager.OpenTree("campaign-1")
+	assert.Equal(t, ErrTreeNotFound, err)
+	opened, err := manager.OpenTree("1637704523306766336")
+	assert.Nil(t, err)
+	assert.Nil(t, opened.AppendLeaf("0x8b1b201E91966957f18bBcDDB520c53c521bF5cd"))
+	info, err := manager.TreeInfo("1637704523306766336")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, info.LeafCount)
+	assert.False(t, info.Sealed)
+
+	// 无元数据时由根节点与最大叶子序号推算
+	report, err := manager.VerifyTree("1637704523306766336")
+	assert.Nil(t, err)
+	assert.True(t, report.OK())
+	assert.Equal(t, 3, report.LeafCount)
+}
+
+func TestMemTreeRegistry(t *testing.T) {
+	manager, err := NewMemoryMerkleTreeManager(context.Background(), WithLogger(DiscardLogger))
+	assert.Nil(t, err)
+
+	_, err = manager.OpenTree("campaign-1")
+	assert.Equal(t, ErrTreeNotFound, err)
+
+	tree, err := manager.CreateTree("campaign-1")
+	assert.Nil(t, err)
+	assert.Nil(t, tree.AppendLeaf("0x8b1b201E91966957f18bBcDDB520c53c521bF5cd"))
+	assert.Nil(t, tree.AppendLeaf("0xeA726629EC5fe5cE300000d1a8c89B3054A22cE7"))
+
+	_, err = manager.CreateTree("campaign-1")
+	assert.Equal(t, ErrTreeExists, err)
+
+	// 登记前创建的树在首次打开时补登记
+	legacy, err := manager.CreateMerkleTree("campaign-0")
+	assert.Nil(t, err)
+	assert.Nil(t, legacy.AppendLeaf("0x00440DC3377A8a6b745aB5F92fD850b7c7291DdE"))
+	_, err = manager.OpenTree("campaign-0")
+	assert.Nil(t, err)
+
+	infos, err := manager.ListTrees()
+	assert.Nil(t, err)
+	assert.Len(t, infos, 2)
+	assert.Equal(t, "campaign-0", infos[0].ID)
+	assert.Equal(t, 1, infos[0].LeafCount)
+
+	info, err := manager.TreeInfo("campaign-1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, info.LeafCount)
+	assert.Equal(t, "keccak256", info.Hasher)
+	assert.Equal(t, "address", info.LeafSchema)
+	assert.Equal(t, expectedRoot(t, manager.storage, "campaign-1"), info.Root)
+
+	assert.Nil(t, manager.SealTree("campaign-1"))
+	tree, err = manager.OpenTree("campaign-1")
+	assert.Nil(t, err)
+	assert.Equal(t, ErrTreeSealed, tree.AppendLeaf("0x00440DC3377A8a6b745aB5F92fD850b7c7291DdE"))
+	// 其他方式创建的句柄同样不能追加
+	legacy, err = manager.CreateMerkleTree("campaign-1")
+	assert.Nil(t, err)
+	assert.Equal(t, ErrTreeSealed, legacy.AppendLeaf("0x00440DC3377A8a6b745aB5F92fD850b7c7291DdE"))
+	standalone, err := NewMerkleTree(context.Background(), manager.storage, "campaign-1", WithLogger(DiscardLogger))
+	assert.Nil(t, err)
+	assert.Equal(t, ErrTreeSealed, standalone.AppendLeaf("0x00440DC3377A8a6b745aB5F92fD850b7c7291DdE"))
+
+	info, err = manager.TreeInfo("campaign-1")
+	assert.Nil(t, err)
+	assert.True(t, info.Sealed)
+	assert.Equal(t, 2, info.LeafCount)
+}
+
+func TestMemTreeRequestContext(t *testing.T) {
+	manager, err := NewMemoryMerkleTreeManager(context.Background(), WithLogger(DiscardLogger))
+	assert.Nil(t, err)
+
+	// 请求结束后句柄仍使用管理器的上下文
+	ctx, cancel := context.WithCancel(context.Background())
+	tree, err := manager.CreateTreeCtx(ctx, "campaign-1")
+	assert.Nil(t, err)
+	cancel()
+	assert.Nil(t, tree.AppendLeaves([]string{"0x8b1b201E91966957f18bBcDDB520c53c521bF5cd", "0xeA726629EC5fe5cE300000d1a8c89B3054A22cE7"}))
+
+	ctx, cancel = context.WithCancel(context.Background())
+	tree, err = manager.OpenTreeCtx(ctx, "campaign-1")
+	assert.Nil(t, err)
+	cancel()
+	root, err := tree.GetRootNode()
+	assert.Nil(t, err)
+	assert.Equal(t, expectedRoot(t, manager.storage, "campaign-1"), root.Hash)
+	hashes, err := tree.LeafHashes()
+	assert.Nil(t, err)
+	assert.Len(t, hashes, 2)
+}
+
+func TestMemPersistentRecovery(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	manager, err := OpenMemoryMerkleTreeManager(ctx, dir, memory.PersistOptions{}, WithLogger(DiscardLogger))
+	assert.Nil(t, err)
+	tree, err := manager.CreateTree("1637704523306766336")
+	assert.Nil(t, err)
+	for i := 0; i < 11; i++ {
+		assert.Nil(t, tree.AppendLeaf(fmt.Sprintf("0x%040x", i+1)))
+	}
+	root, err := tree.GetRootNode()
+	assert.Nil(t, err)
+	assert.Nil(t, manager.Close())
+
+	manager, err = OpenMemoryMerkleTreeManager(ctx, dir, memory.PersistOptions{}, WithLogger(DiscardLogger))
+	assert.Nil(t, err)
+	tree, err = manager.OpenTree("1637704523306766336")
+	assert.Nil(t, err)
+	after, err := tree.GetRootNode()
+	assert.Nil(t, err)
+	assert.Equal(t, root.Hash, after.Hash)
+
+	proofes, err := tree.GenerateProof(fmt.Sprintf("0x%040x", 7))
+	assert.Nil(t, err)
+	proof, err := tree.VerifyProof(proofes, fmt.Sprintf("0x%040x", 7))
+	assert.Nil(t, err)
+	assert.True(t, proof)
+
+	// 叶子被篡改后恢复时校验失败
+	leaf, err := manager.storage.FindOneByLeafData(ctx, "1637704523306766336", fmt.Sprintf("0x%040x", 3))
+	assert.Nil(t, err)
+	leaf.Hash = keccak256.Bytes2Hex(keccak256.HashLeaf(fmt.Sprintf("%040x", 99)))
+	assert.Nil(t, manager.storage.Update(ctx, leaf))
+	assert.Nil(t, manager.Close())
+
+	_, err = OpenMemoryMerkleTreeManager(ctx, dir, memory.PersistOptions{}, WithLogger(DiscardLogger))
+	assert.ErrorIs(t, err, ErrRootMismatch)
+}
+
+func TestMemVerify(t *testing.T) {
+	ctx := context.Background()
+	manager, err := NewMemoryMerkleTreeManager(ctx, WithLogger(DiscardLogger))
+	assert.Nil(t, err)
+	tree, err := manager.CreateTree("1637704523306766336")
+	assert.Nil(t, err)
+	for i := 0; i < 11; i++ {
+		assert.Nil(t, tree.AppendLeaf(fmt.Sprintf("0x%040x", i+1)))
+	}
+
+	report, err := tree.Verify()
+	assert.Nil(t, err)
+	assert.True(t, report.OK(), report.Issues)
+	assert.Equal(t, 11, report.LeafCount)
+	assert.Equal(t, 5, report.Depth)
+
+	// 分支哈希过期：该节点与其父节点都不一致
+	nodes, err := manager.storage.FindNodesByLevel(ctx, "1637704523306766336", 1)
+	assert.Nil(t, err)
+	stale := *nodes[2]
+	stale.Hash = nodes[1].Hash
+	assert.Nil(t, manager.storage.Update(ctx, &stale))
+	assert.Nil(t, manager.storage.Insert(ctx, &db.TreeNode{MtAddress: "1637704523306766336", Hash: nodes[0].Hash, Level: 1, LevelNo: 9}))
+
+	report, err = manager.VerifyTree("1637704523306766336")
+	assert.Nil(t, err)
+	assert.Equal(t, []Issue{
+		{Kind: IssueExtraNode, Level: 1, LevelNo: 9, Detail: "level holds 6 nodes"},
+		{Kind: IssueHashMismatch, Level: 1, LevelNo: 2, Detail: fmt.Sprintf("stored %s, children give %s", stale.Hash, nodes[2].Hash)},
+	}, report.Issues[:2])
+	assert.Len(t, report.Issues, 3)
+	assert.Equal(t, IssueHashMismatch, report.Issues[2].Kind)
+	assert.Equal(t, 2, report.Issues[2].Level)
+	assert.Equal(t, 1, report.Issues[2].LevelNo)
+}
+
+func TestMemRebuildFromLeaves(t *testing.T) {
+	ctx := context.Background()
+	manager, err := NewMemoryMerkleTreeManager(ctx, WithLogger(DiscardLogger))
+	assert.Nil(t, err)
+	tree, err := manager.CreateTree("1637704523306766336")
+	assert.Nil(t, err)
+	for i := 0; i < 11; i++ {
+		assert.Nil(t, tree.AppendLeaf(fmt.Sprintf("0x%040x", i+1)))
+	}
+	root, err := tree.GetRootNode()
+	assert.Nil(t, err)
+
+	// 过期的分支哈希、多余的分支与更高层的孤立根
+	nodes, err := manager.storage.FindNodesByLevel(ctx, "1637704523306766336", 1)
+	assert.Nil(t, err)
+	stale := *nodes[2]
+	stale.Hash = nodes[1].Hash
+	assert.Nil(t, manager.storage.Update(ctx, &stale))
+	assert.Nil(t, manager.storage.Insert(ctx, &db.TreeNode{MtAddress: "1637704523306766336", Hash: nodes[0].Hash, Level: 1, LevelNo: 9}))
+	assert.Nil(t, manager.storage.Insert(ctx, &db.TreeNode{MtAddress: "1637704523306766336", Hash: nodes[0].Hash, Level: 6, LevelNo: 0}))
+
+	report, err := tree.RebuildFromLeaves(ctx, RebuildOptions{DryRun: true})
+	assert.Nil(t, err)
+	assert.Equal(t, &RebuildReport{
+		MtAddress: "1637704523306766336",
+		LeafCount: 11,
+		Depth:     5,
+		Root:      root.Hash,
+		Rewritten: []db.NodePos{{Level: 1, LevelNo: 2}},
+		Removed:   []db.NodePos{{Level: 1, LevelNo: 9}, {Level: 6, LevelNo: 0}},
+		Meta:      true,
+		DryRun:    true,
+	}, report)
+	verify, err := tree.Verify()
+	assert.Nil(t, err)
+	assert.False(t, verify.OK())
+
+	report, err = tree.RebuildFromLeaves(ctx, RebuildOptions{})
+	assert.Nil(t, err)
+	assert.False(t, report.DryRun)
+	assert.Len(t, report.Rewritten, 1)
+	verify, err = tree.Verify()
+	assert.Nil(t, err)
+	assert.True(t, verify.OK(), verify.Issues)
+	after, err := tree.GetRootNode()
+	assert.Nil(t, err)
+	assert.Equal(t, root, after)
+
+	report, err = tree.RebuildFromLeaves(ctx, RebuildOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, report.Rewritten)
+	assert.Empty(t, report.Removed)
+	assert.False(t, report.Meta)
+
+	// 追加在修复后的树上继续
+	assert.Nil(t, tree.AppendLeaf(fmt.Sprintf("0x%040x", 12)))
+	verify, err = tree.Verify()
+	assert.Nil(t, err)
+	assert.True(t, verify.OK(), verify.Issues)
+}
+
+func TestMemAppendRecovery(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	address := "1637704523306766336"
+
+	manager, err := OpenMemoryMerkleTreeManager(ctx, dir, memory.PersistOptions{}, WithLogger(DiscardLogger))
+	assert.Nil(t, err)
+	tree, err := manager.CreateTree(address)
+	assert.Nil(t, err)
+	for i := 0; i < 8; i++ {
+		assert.Nil(t, tree.AppendLeaf(fmt.Sprintf("0x%040x", i+1)))
+	}
+	journal := manager.storage.(db.IntentJournal)
+	_, err = journal.FindIntent(ctx, address)
+	assert.Equal(t, db.ErrNotFound, err)
+
+	// 批次的第一个叶子写入之后、更新分支之前崩溃
+	data := fmt.Sprintf("0x%040x", 9)
+	assert.Nil(t, journal.PutIntent(ctx, &db.AppendIntent{MtAddress: address, Leaves: []string{data, fmt.Sprintf("0x%040x", 10)}, LevelNo: 8}))
+	assert.Nil(t, manager.storage.Insert(ctx, &db.TreeNode{MtAddress: address, Data: data, Hash: keccak256.Bytes2Hex(keccak256.HashLeaf(data[2:])), LevelNo: 8}))
+
+	manager, err = OpenMemoryMerkleTreeManager(ctx, dir, memory.PersistOptions{}, WithLogger(DiscardLogger))
+	assert.Nil(t, err)
+	tree, err = manager.OpenTree(address)
+	assert.Nil(t, err)
+	report, err := tree.Verify()
+	assert.Nil(t, err)
+	assert.True(t, report.OK(), report.Issues)
+	assert.Equal(t, 9, report.LeafCount)
+	_, err = manager.storage.(db.IntentJournal).FindIntent(ctx, address)
+	assert.Equal(t, db.ErrNotFound, err)
+	// 只审计已写入的叶子
+	last, err := manager.storage.(db.AuditLog).LastAudit(ctx, address)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{data}, last.Leaves)
+	assert.Equal(t, 8, last.LeafIndex)
+
+	expected, err := NewMemoryMerkleTreeManager(ctx, WithLogger(DiscardLogger))
+	assert.Nil(t, err)
+	expectedTree, err := expected.CreateTree(address)
+	assert.Nil(t, err)
+	for i := 0; i < 9; i++ {
+		assert.Nil(t, expectedTree.AppendLeaf(fmt.Sprintf("0x%040x", i+1)))
+	}
+	expectedRoot, err := expectedTree.GetRootNode()
+	assert.Nil(t, err)
+	root, err := tree.GetRootNode()
+	assert.Nil(t, err)
+	assert.Equal(t, expectedRoot, root)
+
+	// 崩溃于写入叶子之前：丢弃意图
+	journal = manager.storage.(db.IntentJournal)
+	assert.Nil(t, journal.PutIntent(ctx, &db.AppendIntent{MtAddress: address, Leaves: []string{fmt.Sprintf("0x%040x", 10)}, LevelNo: 9}))
+	tree, err = manager.OpenTree(address)
+	assert.Nil(t, err)
+	_, err = journal.FindIntent(ctx, address)
+	assert.Equal(t, db.ErrNotFound, err)
+	after, err := tree.GetRootNode()
+	assert.Nil(t, err)
+	assert.Equal(t, root, after)
+	assert.Nil(t, manager.Close())
+}
+
+func TestMemAuditHistory(t *testing.T) {
+	ctx := WithActor(context.Background(), "alice")
+	address := "1637704523306766336"
+	manager, err := NewMemoryMerkleTreeManager(context.Background(), WithLogger(DiscardLogger))
+	assert.Nil(t, err)
+
+	tree, err := manager.CreateTreeCtx(ctx, address)
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, tree.AppendLeafCtx(ctx, fmt.Sprintf("0x%040x", i+1)))
+	}
+	// 重复的叶子不产生记录，没有操作者的调用记录为空
+	assert.Nil(t, tree.AppendLeafCtx(ctx, fmt.Sprintf("0x%040x", 2)))
+	plain, err := manager.OpenTree(address)
+	assert.Nil(t, err)
+	assert.Nil(t, plain.AppendLeaf(fmt.Sprintf("0x%040x", 4)))
+	// 一个批次一条记录，只列出实际追加的叶子
+	assert.Nil(t, tree.AppendLeavesCtx(ctx, []string{fmt.Sprintf("0x%040x", 5), fmt.Sprintf("0x%040x", 2), fmt.Sprintf("0x%040x", 6)}))
+	assert.Nil(t, manager.SealTreeCtx(ctx, address))
+	root, err := tree.GetRootNode()
+	assert.Nil(t, err)
+	assert.Nil(t, manager.DeleteTreeCtx(ctx, address))
+
+	var entries []*db.AuditEntry
+	for from := uint64(1); ; {
+		page, err := manager.History(address, from, 2)
+		assert.Nil(t, err)
+		if len(page) == 0 {
+			break
+		}
+		entries = append(entries, page...)
+		from = page[len(page)-1].Seq + 1
+	}
+
+	var ops []db.AuditOp
+	for i, entry := range entries {
+		assert.Equal(t, uint64(i+1), entry.Seq)
+		assert.False(t, entry.Time.IsZero())
+		ops = append(ops, entry.Op)
+	}
+	assert.Equal(t, []db.AuditOp{db.AuditCreate, db.AuditAppend, db.AuditAppend, db.AuditAppend, db.AuditAppend, db.AuditAppend, db.AuditSeal, db.AuditDelete}, ops)
+
+	for i := 1; i <= 5; i++ {
+		if i < 5 {
+			assert.Equal(t, []string{fmt.Sprintf("0x%040x", i)}, entries[i].Leaves)
+		}
+		assert.Equal(t, i-1, entries[i].LeafIndex)
+		assert.Equal(t, entries[i-1].NewRoot, entries[i].OldRoot)
+	}
+	assert.Equal(t, []string{fmt.Sprintf("0x%040x", 5), fmt.Sprintf("0x%040x", 6)}, entries[5].Leaves)
+	assert.Equal(t, "", entries[1].OldRoot)
+	assert.Equal(t, "alice", entries[3].Actor)
+	assert.Equal(t, "", entries[4].Actor)
+	assert.Equal(t, "alice", entries[5].Actor)
+	assert.Equal(t, root.Hash, entries[5].NewRoot)
+	assert.Equal(t, root.Hash, entries[6].NewRoot)
+	assert.Equal(t, root.Hash, entries[7].OldRoot)
+	assert.Equal(t, "", entries[7].NewRoot)
+	assert.Equal(t, "alice", entries[7].Actor)
+}
+
+func TestMemOZDump(t *testing.T) {
+	manager, err := NewMemoryMerkleTreeManager(context.Background(), WithLogger(DiscardLogger))
+	assert.Nil(t, err)
+
+	// 叶子数为 2^k 或 3·2^k 时两种布局的根相同
+	for n := 1; n <= 8; n++ {
+		tree, err := manager.CreateTree(fmt.Sprintf("src-%d", n))
+		assert.Nil(t, err)
+		for i := 0; i < n; i++ {
+			assert.Nil(t, tree.AppendLeaf(fmt.Sprintf("0x%040x", i+1)))
+		}
+		root, err := tree.GetRootNode()
+		assert.Nil(t, err)
+
+		data, err := tree.ExportOZDump()
+		if n == 5 || n == 7 {
+			assert.False(t, OZLayoutMatches(n))
+			assert.True(t, errors.Is(err, ErrOZLayout))
+			continue
+		}
+		assert.True(t, OZLayoutMatches(n))
+		assert.Nil(t, err)
+
+		var dump OZDump
+		assert.Nil(t, json.Unmarshal(data, &dump))
+		assert.Equal(t, OZDumpFormat, dump.Format)
+		assert.Equal(t, "0x"+root.Hash, dump.Tree[0])
+		assert.Len(t, dump.Tree, 2*n-1)
+
+		imported, err := manager.ImportOZDump(fmt.Sprintf("dst-%d", n), data)
+		assert.Nil(t, err)
+		importedRoot, err := imported.GetRootNode()
+		assert.Nil(t, err)
+		assert.Equal(t, root.Hash, importedRoot.Hash)
+	}
+
+	// StandardMerkleTree 默认按叶子哈希排序
+	leaves := []string{fmt.Sprintf("0x%040x", 7), fmt.Sprintf("0x%040x", 8), fmt.Sprintf("0x%040x", 9), fmt.Sprintf("0x%040x", 10)}
+	sorted := append([]string(nil), leaves...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(Keccak256Hasher.HashLeaf(sorted[i]), Keccak256Hasher.HashLeaf(sorted[j])) < 0
+	})
+	hashes := make([][]byte, 0, len(sorted))
+	for _, leaf := range sorted {
+		hashes = append(hashes, Keccak256Hasher.HashLeaf(leaf))
+	}
+	heap := ozHeap(Keccak256Hasher, hashes)
+	dump := &OZDump{Format: OZDumpFormat, LeafEncoding: []string{"address"}}
+	for _, hash := range heap {
+		dump.Tree = append(dump.Tree, "0x"+keccak256.Bytes2Hex(hash))
+	}
+	for _, leaf := range leaves {
+		for i, s := range sorted {
+			if s == leaf {
+				dump.Values = append(dump.Values, OZValue{Value: []string{leaf}, TreeIndex: len(heap) - 1 - i})
+			}
+		}
+	}
+	data, err := json.Marshal(dump)
+	assert.Nil(t, err)
+	tree, err := manager.ImportOZDump("sorted", data)
+	assert.Nil(t, err)
+	root, err := tree.GetRootNode()
+	assert.Nil(t, err)
+	assert.Equal(t, dump.Tree[0], "0x"+root.Hash)
+	index, err := tree.LeafIndex(sorted[0])
+	assert.Nil(t, err)
+	assert.Equal(t, 0, index)
+
+	// 篡改的哈希在写入前被发现
+	dump.Tree[1] = dump.Tree[2]
+	data, err = json.Marshal(dump)
+	assert.Nil(t, err)
+	_, err = manager.ImportOZDump("tampered", data)
+	assert.True(t, errors.Is(err, ErrInvalidOZDump))
+	_, err = manager.TreeInfo("tampered")
+	assert.Equal(t, ErrTreeNotFound, err)
+
+	// 其他叶子数的合法转储同样不能导入
+	hashes = append(hashes, Keccak256Hasher.HashLeaf(fmt.Sprintf("0x%040x", 11)))
+	heap = ozHeap(Keccak256Hasher, hashes)
+	dump = &OZDump{Format: OZDumpFormat, LeafEncoding: []string{"address"}}
+	for _, hash := range heap {
+		dump.Tree = append(dump.Tree, "0x"+keccak256.Bytes2Hex(hash))
+	}
+	for i, leaf := range append(sorted, fmt.Sprintf("0x%040x", 11)) {
+		dump.Values = append(dump.Values, OZValue{Value: []string{leaf}, TreeIndex: len(heap) - 1 - i})
+	}
+	data, err = json.Marshal(dump)
+	assert.Nil(t, err)
+	_, err = manager.ImportOZDump("five", data)
+	assert.True(t, errors.Is(err, ErrOZLayout))
+}
+
+func TestMemExportProofs(t *testing.T) {
+	manager, err := NewMemoryMerkleTreeManager(context.Background(), WithLogger(DiscardLogger))
+	assert.Nil(t, err)
+
+	for _, n := range []int{0, 1, 7} {
+		tree, err := manager.CreateTree(fmt.Sprintf("%d", n))
+		assert.Nil(t, err)
+		var leaves []string
+		for i := 0; i < n; i++ {
+			leaves = append(leaves, fmt.Sprintf("0x%02X%038x", i%3*16, i))
+		}
+		assert.Nil(t, tree.AppendLeaves(leaves))
+
+		dir := t.TempDir()
+		manifest, err := tree.ExportProofs(dir, ProofExportOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, n, manifest.LeafCount)
+		assert.Equal(t, Keccak256Hasher.Name(), manifest.Hasher)
+
+		data, err := os.ReadFile(filepath.Join(dir, ProofManifestFile))
+		assert.Nil(t, err)
+		var written ProofManifest
+		assert.Nil(t, json.Unmarshal(data, &written))
+		assert.Equal(t, *manifest, written)
+
+		// 每个证明与 GenerateProof 一致且可验证
+		found := 0
+		for _, shard := range manifest.Shards {
+			data, err := os.ReadFile(filepath.Join(dir, shard.File))
+			assert.Nil(t, err)
+			var proofs map[string]*LeafProof
+			assert.Nil(t, json.Unmarshal(data, &proofs))
+			assert.Len(t, proofs, shard.Leaves)
+
+			for key, proof := range proofs {
+				found++
+				assert.Equal(t, strings.ToLower(proof.Leaf), key)
+				assert.True(t, strings.HasPrefix(key, shard.Prefix))
+				assert.Equal(t, leaves[proof.Index], proof.Leaf)
+
+				expected, err := tree.GenerateProof(proof.Leaf)
+				assert.Nil(t, err)
+				hexProofs := []string{}
+				for _, p := range expected {
+					hexProofs = append(hexProofs, "0x"+keccak256.Bytes2Hex(p))
+				}
+				assert.Equal(t, hexProofs, proof.Proof)
+
+				var raw [][]byte
+				for _, p := range proof.Proof {
+					raw = append(raw, keccak256.FromHex(p))
+				}
+				assert.True(t, VerifyProofRoot(Keccak256Hasher, manifest.Root[2:], raw, proof.Leaf))
+			}
+		}
+		assert.Equal(t, n, found)
+	}
+
+	// 重新导出删除清单不再列出的分片，其他文件保留
+	dir := t.TempDir()
+	for _, name := range []string{"0xff.json", "0xabc.json", "notes.json", "0XFF.json"} {
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0644))
+	}
+	tree, err := manager.OpenTree("7")
+	assert.Nil(t, err)
+	manifest, err := tree.ExportProofs(dir, ProofExportOptions{})
+	assert.Nil(t, err)
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	expected := []string{"0XFF.json", "notes.json", ProofManifestFile}
+	for _, shard := range manifest.Shards {
+		expected = append(expected, shard.File)
+	}
+	assert.ElementsMatch(t, expected, names)
+}
+
+func TestMemRender(t *testing.T) {
+	manager, err := NewMemoryMerkleTreeManager(context.Background(), WithLogger(DiscardLogger))
+	assert.Nil(t, err)
+	tree, err := manager.CreateTree("1637704523306766336")
+	assert.Nil(t, err)
+
+	var sb strings.Builder
+	assert.Nil(t, tree.RenderASCII(&sb, RenderOptions{}))
+	assert.Equal(t, "(empty)\n", sb.String())
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, tree.AppendLeaf(fmt.Sprintf("0x%040x", i+1)))
+	}
+
+	sb.Reset()
+	assert.Nil(t, tree.RenderASCII(&sb, RenderOptions{Highlight: fmt.Sprintf("0x%040x", 2)}))
+	assert.Equal(t, `3:0 bb02739b [path]
+├── 2:0 dca6f975 [path]
+│   ├── 1:0 e685571b [path]
+│   │   ├── 0:0 b5d9d894 0x0000000000000000000000000000000000000001 [proof]
+│   │   └── 0:1 1ab0c694 0x0000000000000000000000000000000000000002 [path]
+│   └── 1:1 4ade9dd0 [proof]
+│       ├── 0:2 2584db4a 0x0000000000000000000000000000000000000003
+│       └── 0:3 c167b0e3 0x0000000000000000000000000000000000000004
+└── 2:1 16db2e4b [proof]
+    └── 1:2 16db2e4b
+        └── 0:4 16db2e4b 0x0000000000000000000000000000000000000005
+`, sb.String())
+
+	// 深度限制下被截断的子树以 ... 表示
+	sb.Reset()
+	assert.Nil(t, tree.RenderASCII(&sb, RenderOptions{MaxDepth: 2, HashLength: -1}))
+	root, err := tree.GetRootNode()
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+	assert.Equal(t, "3:0 "+root.Hash, lines[0])
+	assert.Equal(t, []string{"│   └── ...", "    └── ..."}, []string{lines[2], lines[4]})
+
+	sb.Reset()
+	assert.Nil(t, tree.RenderDOT(&sb, RenderOptions{MaxDepth: 3, Highlight: fmt.Sprintf("0x%040x", 5)}))
+	dot := sb.String()
+	assert.True(t, strings.HasPrefix(dot, "digraph \"1637704523306766336\" {\n"))
+	assert.Contains(t, dot, "\"2:0\" [label=\"2:0\\ndca6f975\", style=filled, fillcolor=lightblue];\n")
+	assert.Contains(t, dot, "\"2:1\" -> \"1:2\";\n")
+	assert.Contains(t, dot, "\"1:2\" -> \"1:2...\" [style=dashed];\n")
+	assert.NotContains(t, dot, "\"0:")
+
+	err = tree.RenderDOT(&sb, RenderOptions{Highlight: fmt.Sprintf("0x%040x", 6)})
+	assert.True(t, errors.Is(err, ErrLeafNotFound))
+	assert.Nil(t, tree.PrintTree())
+}
+
 func TestRedisAppend1(t *testing.T) {
+	skipWithoutRedis(t)
 	setupRedis()
 
 	tree, err := merkleTreeManager.CreateMerkleTree("1637704523306766336")
@@ -226,6 +1208,7 @@ func TestRedisAppend1(t *testing.T) {
 }
 
 func TestRedisAppend2(t *testing.T) {
+	skipWithoutRedis(t)
 	setupRedis()
 
 	tree, err := merkleTreeManager.CreateMerkleTree("1637704523306766336")
@@ -280,6 +1263,7 @@ func TestRedisAppend2(t *testing.T) {
 }
 
 func TestRedis(t *testing.T) {
+	skipWithoutRedis(t)
 	ctx := context.Background()
 
 	rdb := redis.NewClient(&redis.Options{
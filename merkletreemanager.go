@@ -2,40 +2,228 @@ package merkletree
 
 import (
 	"context"
+	"fmt"
 	"github.com/UXUYLabs/go-merkletree/db"
 	"github.com/UXUYLabs/go-merkletree/db/memory"
 	"log"
 	"os"
+	"strings"
+	"sync"
+	"time"
 )
 
-// MerkleTree is the structure for the Merkle tree.
+// MerkleTreeManager creates MerkleTree handles on a shared storage. Handles of
+// the same tree share one lock, so concurrent appends through any of them are safe.
 type MerkleTreeManager struct {
 	Logger
 	ctx     context.Context
 	storage db.Storage
+	opts    []Option
+
+	mu    sync.Mutex
+	locks map[string]*sync.RWMutex
 }
 
-func NewMemoryMerkleTreeManager(ctx context.Context) (*MerkleTreeManager, error) {
-	return &MerkleTreeManager{
-		Logger:  PrintfLogger(log.New(os.Stdout, "cron: ", log.LstdFlags)),
-		ctx:     ctx,
-		storage: memory.NewMemoryStorage(),
-	}, nil
+func NewMemoryMerkleTreeManager(ctx context.Context, opts ...Option) (*MerkleTreeManager, error) {
+	return NewMerkleTreeManager(ctx, memory.NewMemoryStorage(), opts...)
 }
-func NewMerkleTreeManager(ctx context.Context, storage db.Storage) (*MerkleTreeManager, error) {
+
+// NewMerkleTreeManager returns a manager whose trees all use storage. opts
+// apply to the manager and to every tree it creates.
+func NewMerkleTreeManager(ctx context.Context, storage db.Storage, opts ...Option) (*MerkleTreeManager, error) {
+	o := newOptions(PrintfLogger(log.New(os.Stdout, "cron: ", log.LstdFlags)), opts)
 	return &MerkleTreeManager{
-		Logger:  PrintfLogger(log.New(os.Stdout, "cron: ", log.LstdFlags)),
+		Logger:  o.logger,
 		ctx:     ctx,
 		storage: storage,
+		opts:    opts,
+		locks:   make(map[string]*sync.RWMutex),
 	}, nil
 }
 
 func (mm *MerkleTreeManager) CreateMerkleTree(mtAddress string) (*MerkleTree, error) {
-	tree, err := NewMerkleTree(mm.ctx, mm.storage, mtAddress)
+	o := newOptions(PrintfLogger(log.New(os.Stdout, "merkleTree: ", log.LstdFlags)), mm.opts)
+	return newMerkleTree(mm.ctx, mm.storage, mtAddress, mm.treeLock(mtAddress), o), nil
+}
+
+// DeleteTree is DeleteTreeCtx with the context the manager was created with.
+func (mm *MerkleTreeManager) DeleteTree(mtAddress string) error {
+	return mm.DeleteTreeCtx(mm.ctx, mtAddress)
+}
+
+// DeleteTreeCtx removes a tree with all of its nodes, and forgets the lock
+// shared by its handles. It waits for appends in progress on the tree to
+// finish. It fails with db.ErrNotSupported when the storage does not implement
+// db.TreeDeleter.
+func (mm *MerkleTreeManager) DeleteTreeCtx(ctx context.Context, mtAddress string) error {
+	if !db.Supports(mm.storage, (*db.TreeDeleter)(nil)) {
+		return db.ErrNotSupported
+	}
+	deleter := mm.storage.(db.TreeDeleter)
+	tree, err := mm.CreateMerkleTree(mtAddress)
+	if err != nil {
+		return err
+	}
+
+	err = tree.exclusive(ctx, func(ctx context.Context, lease db.Lease) error {
+		root, err := rootHash(ctx, mm.storage, mtAddress)
+		if err != nil {
+			return err
+		}
+		if err = deleter.DeleteTree(ctx, mtAddress); err != nil {
+			return err
+		}
+		// 不存在的树不记录
+		if root == "" {
+			return nil
+		}
+		return audit(ctx, mm.storage, &db.AuditEntry{MtAddress: mtAddress, Op: db.AuditDelete, LeafIndex: -1, OldRoot: root})
+	})
 	if err != nil {
-		mm.Error("CreateMerkleTree err:%v", err)
+		mm.Error("DeleteTree err: ", err, "mtAddress", mtAddress)
+		return err
+	}
+
+	// 树已删除，锁不再保留，再次使用时重新创建
+	mm.mu.Lock()
+	delete(mm.locks, mtAddress)
+	mm.mu.Unlock()
+	return nil
+}
+
+// ExpireTree is ExpireTreeCtx with the context the manager was created with.
+func (mm *MerkleTreeManager) ExpireTree(mtAddress string, expireAt time.Time) error {
+	return mm.ExpireTreeCtx(mm.ctx, mtAddress, expireAt)
+}
+
+// ExpireTreeCtx marks a tree to be deleted by the garbage collector once
+// expireAt has passed. It fails with db.ErrNotSupported when the storage does
+// not implement db.TreeDeleter.
+func (mm *MerkleTreeManager) ExpireTreeCtx(ctx context.Context, mtAddress string, expireAt time.Time) error {
+	if !db.Supports(mm.storage, (*db.TreeDeleter)(nil)) {
+		return db.ErrNotSupported
+	}
+	deleter := mm.storage.(db.TreeDeleter)
+	err := deleter.ExpireTree(ctx, mtAddress, expireAt)
+	if err != nil {
+		mm.Error("ExpireTree err: ", err, "mtAddress", mtAddress)
+		return err
+	}
+
+	return nil
+}
+
+// CollectGarbage is CollectGarbageCtx with the context the manager was created with.
+func (mm *MerkleTreeManager) CollectGarbage() ([]string, error) {
+	return mm.CollectGarbageCtx(mm.ctx)
+}
+
+// CollectGarbageCtx deletes every expired tree, and completes deletions that
+// were interrupted. A tree failing to be deleted does not stop the others,
+// whose deletion is still attempted; the failures are returned together,
+// with the trees deleted. It fails with db.ErrNotSupported when the storage
+// does not implement db.TreeDeleter.
+func (mm *MerkleTreeManager) CollectGarbageCtx(ctx context.Context) ([]string, error) {
+	if !db.Supports(mm.storage, (*db.TreeDeleter)(nil)) {
+		return nil, db.ErrNotSupported
+	}
+	deleter := mm.storage.(db.TreeDeleter)
+	expired, err := deleter.FindExpiredTrees(ctx, time.Now())
+	if err != nil {
+		mm.Error("CollectGarbage FindExpiredTrees err: ", err)
 		return nil, err
 	}
 
-	return tree, nil
+	var deleted []string
+	var errs []error
+	for _, mtAddress := range expired {
+		if err = mm.DeleteTreeCtx(ctx, mtAddress); err != nil {
+			errs = append(errs, fmt.Errorf("tree %s: %w", mtAddress, err))
+			// 取消后其余的树也无法删除
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		mm.Info("CollectGarbage deleted", "mtAddress", mtAddress)
+		deleted = append(deleted, mtAddress)
+	}
+
+	return deleted, joinErrors(errs)
+}
+
+// multiError is the errors of several independent steps.
+type multiError []error
+
+func (e multiError) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap lets errors.Is and errors.As look into each error.
+func (e multiError) Unwrap() []error {
+	return e
+}
+
+// joinErrors returns nil for no errors, the error itself for one.
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return multiError(errs)
+	}
+}
+
+// StartGC runs CollectGarbage every interval in the background until stop is
+// called. Nothing is run when the storage does not implement db.TreeDeleter.
+func (mm *MerkleTreeManager) StartGC(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	if !db.Supports(mm.storage, (*db.TreeDeleter)(nil)) {
+		mm.Error("StartGC err: ", db.ErrNotSupported)
+		close(stopped)
+		return func() {}
+	}
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-mm.ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := mm.CollectGarbage(); err != nil {
+					mm.Error("StartGC CollectGarbage err: ", err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-stopped
+	}
+}
+
+// treeLock returns the lock shared by every handle of mtAddress.
+func (mm *MerkleTreeManager) treeLock(mtAddress string) *sync.RWMutex {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	lock := mm.locks[mtAddress]
+	if lock == nil {
+		lock = &sync.RWMutex{}
+		mm.locks[mtAddress] = lock
+	}
+	return lock
 }
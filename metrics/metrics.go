@@ -0,0 +1,132 @@
+// Package metrics exports Prometheus metrics of merkle trees: the count and
+// latency of their operations and of the calls made to their storage, and
+// the leaf count and depth of each tree.
+//
+// A Metrics is a merkletree.Observer, given to trees or managers with
+// merkletree.WithObserver, and wraps storages with Storage.
+package metrics
+
+import (
+	"context"
+	"github.com/UXUYLabs/go-merkletree"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"github.com/UXUYLabs/go-merkletree/db/instrumented"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// Namespace prefixes the name of every metric.
+const Namespace = "merkletree"
+
+// Results labelling the counters.
+const (
+	ResultOK       = "ok"
+	ResultNotFound = "not_found"
+	ResultError    = "error"
+)
+
+// DefaultBuckets are the latency buckets in seconds, from 100µs for in
+// memory storages to a few seconds.
+var DefaultBuckets = prometheus.ExponentialBuckets(0.0001, 2.5, 12)
+
+// Metrics holds the collectors of the trees and storages it observes.
+type Metrics struct {
+	operations        *prometheus.CounterVec
+	operationDuration *prometheus.HistogramVec
+	storageCalls      *prometheus.CounterVec
+	storageDuration   *prometheus.HistogramVec
+	leaves            *prometheus.GaugeVec
+	depth             *prometheus.GaugeVec
+}
+
+// New creates the collectors and registers them with registerer, e.g.
+// prometheus.DefaultRegisterer.
+func New(registerer prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "operations_total",
+			Help:      "Tree operations by operation and result.",
+		}, []string{"operation", "result"}),
+		operationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of tree operations.",
+			Buckets:   DefaultBuckets,
+		}, []string{"operation"}),
+		storageCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "storage_calls_total",
+			Help:      "Storage calls by backend, method and result.",
+		}, []string{"backend", "method", "result"}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "storage_call_duration_seconds",
+			Help:      "Latency of storage calls.",
+			Buckets:   DefaultBuckets,
+		}, []string{"backend", "method"}),
+		leaves: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "tree_leaves",
+			Help:      "Number of leaves of a tree.",
+		}, []string{"tree"}),
+		depth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "tree_depth",
+			Help:      "Number of levels of a tree, leaves included.",
+		}, []string{"tree"}),
+	}
+
+	for _, collector := range []prometheus.Collector{m.operations, m.operationDuration, m.storageCalls, m.storageDuration, m.leaves, m.depth} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// StartOperation implements merkletree.Observer.
+func (m *Metrics) StartOperation(ctx context.Context, info *merkletree.OperationInfo) (context.Context, func(err error)) {
+	start := time.Now()
+	return ctx, func(err error) {
+		m.operationDuration.WithLabelValues(string(info.Op)).Observe(time.Since(start).Seconds())
+		m.operations.WithLabelValues(string(info.Op), result(err)).Inc()
+	}
+}
+
+// ObserveTree implements merkletree.TreeObserver. It may also be called at
+// startup with the metadata of the existing trees.
+func (m *Metrics) ObserveTree(meta *db.TreeMeta) {
+	m.leaves.WithLabelValues(meta.MtAddress).Set(float64(meta.LeafCount))
+	m.depth.WithLabelValues(meta.MtAddress).Set(float64(meta.Depth))
+}
+
+// ForgetTree drops the gauges of a tree, e.g. once it is deleted.
+func (m *Metrics) ForgetTree(mtAddress string) {
+	m.leaves.DeleteLabelValues(mtAddress)
+	m.depth.DeleteLabelValues(mtAddress)
+}
+
+// Storage wraps storage so its calls are counted and timed, labelled with
+// backend, e.g. "redis". It works with any db.Storage implementation and
+// keeps its optional capabilities, see instrumented.Storage.
+func (m *Metrics) Storage(backend string, storage db.Storage) *instrumented.Storage {
+	return instrumented.NewStorage(storage, func(ctx context.Context, call *instrumented.Call) (context.Context, func(error)) {
+		start := time.Now()
+		return ctx, func(err error) {
+			m.storageDuration.WithLabelValues(backend, call.Method).Observe(time.Since(start).Seconds())
+			m.storageCalls.WithLabelValues(backend, call.Method, result(err)).Inc()
+		}
+	})
+}
+
+func result(err error) string {
+	switch err {
+	case nil:
+		return ResultOK
+	case db.ErrNotFound:
+		return ResultNotFound
+	default:
+		return ResultError
+	}
+}
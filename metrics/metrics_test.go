@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"context"
+	"github.com/UXUYLabs/go-merkletree"
+	"github.com/UXUYLabs/go-merkletree/db/memory"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m, err := New(registry)
+	if err != nil {
+		t.Fatal("New err: ", err)
+	}
+
+	storage := m.Storage("memory", memory.NewMemoryStorage())
+	manager, err := merkletree.NewMerkleTreeManager(context.Background(), storage, merkletree.WithLogger(merkletree.DiscardLogger), merkletree.WithObserver(m))
+	if err != nil {
+		t.Fatal("NewMerkleTreeManager err: ", err)
+	}
+	tree, err := manager.CreateTree("1637704523306766336")
+	if err != nil {
+		t.Fatal("CreateTree err: ", err)
+	}
+
+	leaves := []string{
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+		"0x9965507D1a55bcC2695C58ba16FB37d819B0A4dc",
+		"0x8b1b201E91966957f18bBcDDB520c53c521bF5cd",
+	}
+	assert.Nil(t, tree.AppendLeaves(leaves[:3]))
+	assert.Nil(t, tree.AppendLeaf(leaves[3]))
+	assert.NotNil(t, tree.AppendLeaf("not an address"))
+	proof, err := tree.GenerateProof(leaves[2])
+	assert.Nil(t, err)
+	ok, err := tree.VerifyProof(proof, leaves[2])
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.operations.WithLabelValues("append_batch", ResultOK)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.operations.WithLabelValues("append", ResultOK)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.operations.WithLabelValues("append", ResultError)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.operations.WithLabelValues("proof", ResultOK)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.operations.WithLabelValues("verify", ResultOK)))
+	assert.Equal(t, 4, testutil.CollectAndCount(m.operationDuration))
+
+	assert.Equal(t, 4.0, testutil.ToFloat64(m.leaves.WithLabelValues("1637704523306766336")))
+	assert.Equal(t, 3.0, testutil.ToFloat64(m.depth.WithLabelValues("1637704523306766336")))
+
+	// 存储调用按后端与方法统计，每次追加一个事务
+	assert.Equal(t, 4.0, testutil.ToFloat64(m.storageCalls.WithLabelValues("memory", "Commit", ResultOK)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.storageCalls.WithLabelValues("memory", "InsertTreeInfo", ResultOK)))
+	assert.Less(t, 0.0, testutil.ToFloat64(m.storageCalls.WithLabelValues("memory", "FindOneByLeafData", ResultNotFound)))
+	assert.Less(t, 0, testutil.CollectAndCount(m.storageDuration))
+
+	m.ForgetTree("1637704523306766336")
+	assert.Equal(t, 0, testutil.CollectAndCount(m.leaves))
+
+	// 重复注册失败
+	_, err = New(registry)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,265 @@
+// Package migrate copies merkle trees from one storage backend to another.
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"os"
+	"sync"
+)
+
+// ErrRootMismatch is returned when the destination root differs from the source root after a copy.
+var ErrRootMismatch = errors.New("destination root does not match source root")
+
+// DefaultBatchSize is the number of nodes written to the destination in one step.
+const DefaultBatchSize = 1000
+
+// Options configures a migration.
+type Options struct {
+	// Trees to copy, every tree holding nodes when empty, registered or not,
+	// which needs a source implementing db.MetaStore
+	Trees []string
+	// BatchSize defaults to DefaultBatchSize
+	BatchSize int
+	// Checkpoint records progress so an interrupted migration resumes where it
+	// stopped, nil to always start from scratch
+	Checkpoint Checkpoint
+	// Progress is called after every batch written
+	Progress func(mtAddress string, level, copied int)
+}
+
+// Result describes one migrated tree.
+type Result struct {
+	MtAddress string
+	Nodes     int
+	Root      string
+	// Skipped is set for trees a previous run already completed
+	Skipped bool
+}
+
+// Checkpoint stores the progress of a migration.
+type Checkpoint interface {
+	Load(mtAddress string) (*Progress, error)
+	Save(progress *Progress) error
+}
+
+// Progress is the position the copy of a tree has reached: every node below
+// Level, and the nodes of Level before LevelNo, have been written.
+type Progress struct {
+	MtAddress string `json:"mtAddress"`
+	Level     int    `json:"level"`
+	LevelNo   int    `json:"levelNo"`
+	Done      bool   `json:"done"`
+}
+
+// Migrate copies trees from src to dst level by level, leaves first, with
+// their leaf index and registry record. The registry record is written last,
+// once the destination root has been checked against the source root; it is
+// skipped for a source without a db.TreeRegistry, and a destination without
+// one fails the tree, its record being lost otherwise.
+// Trees must not be appended to while they are migrated.
+func Migrate(ctx context.Context, src, dst db.Storage, opts Options) ([]*Result, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	trees := opts.Trees
+	if len(trees) == 0 {
+		if !db.Supports(src, (*db.MetaStore)(nil)) {
+			return nil, fmt.Errorf("list source trees, name them in Options.Trees: %w", db.ErrNotSupported)
+		}
+		store := src.(db.MetaStore)
+		var err error
+		if trees, err = store.ListTrees(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var results []*Result
+	for _, mtAddress := range trees {
+		result, err := migrateTree(ctx, src, dst, mtAddress, opts)
+		if err != nil {
+			return results, fmt.Errorf("migrate tree %s: %w", mtAddress, err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func migrateTree(ctx context.Context, src, dst db.Storage, mtAddress string, opts Options) (*Result, error) {
+	progress := &Progress{MtAddress: mtAddress}
+	if opts.Checkpoint != nil {
+		saved, err := opts.Checkpoint.Load(mtAddress)
+		if err != nil {
+			return nil, err
+		}
+		if saved != nil {
+			progress = saved
+		}
+	}
+
+	root, err := src.FindRootNode(ctx, mtAddress)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{MtAddress: mtAddress, Root: root.Hash}
+	if progress.Done {
+		result.Skipped = true
+		return result, nil
+	}
+
+	for level := progress.Level; level <= root.Level; level++ {
+		nodes, err := src.FindNodesByLevel(ctx, mtAddress, level)
+		if err != nil {
+			return nil, err
+		}
+
+		// 跳过上次已写入的节点，节点按LevelNo有序
+		start := 0
+		if level == progress.Level {
+			for start < len(nodes) && nodes[start].LevelNo < progress.LevelNo {
+				start++
+			}
+		}
+
+		for i := start; i < len(nodes); i += opts.BatchSize {
+			end := i + opts.BatchSize
+			if end > len(nodes) {
+				end = len(nodes)
+			}
+			if err = writeNodes(ctx, dst, nodes[i:end]); err != nil {
+				return nil, err
+			}
+			result.Nodes += end - i
+
+			progress.Level = level
+			progress.LevelNo = nodes[end-1].LevelNo + 1
+			if err = saveProgress(opts.Checkpoint, progress); err != nil {
+				return nil, err
+			}
+			if opts.Progress != nil {
+				opts.Progress(mtAddress, level, result.Nodes)
+			}
+		}
+	}
+
+	dstRoot, err := dst.FindRootNode(ctx, mtAddress)
+	if err != nil {
+		return nil, err
+	}
+	if dstRoot.Hash != root.Hash || dstRoot.Level != root.Level {
+		return nil, fmt.Errorf("%w: %s != %s", ErrRootMismatch, dstRoot.Hash, root.Hash)
+	}
+
+	if err = copyTreeInfo(ctx, src, dst, mtAddress); err != nil {
+		return nil, err
+	}
+
+	progress.Done = true
+	if err = saveProgress(opts.Checkpoint, progress); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func writeNodes(ctx context.Context, dst db.Storage, nodes []*db.TreeNode) error {
+	if db.Supports(dst, (*db.BatchWriter)(nil)) {
+		return dst.(db.BatchWriter).WriteNodes(ctx, nodes)
+	}
+	for _, node := range nodes {
+		if err := dst.Insert(ctx, node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyTreeInfo(ctx context.Context, src, dst db.Storage, mtAddress string) error {
+	if !db.Supports(src, (*db.TreeRegistry)(nil)) {
+		return nil
+	}
+	srcRegistry := src.(db.TreeRegistry)
+	info, err := srcRegistry.FindTreeInfo(ctx, mtAddress)
+	if err == db.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !db.Supports(dst, (*db.TreeRegistry)(nil)) {
+		return fmt.Errorf("copy registry record: %w", db.ErrNotSupported)
+	}
+	dstRegistry := dst.(db.TreeRegistry)
+	err = dstRegistry.InsertTreeInfo(ctx, info)
+	if err == db.ErrAlreadyExists {
+		return dstRegistry.UpdateTreeInfo(ctx, info)
+	}
+	return err
+}
+
+func saveProgress(checkpoint Checkpoint, progress *Progress) error {
+	if checkpoint == nil {
+		return nil
+	}
+	return checkpoint.Save(progress)
+}
+
+// FileCheckpoint keeps the progress of every tree in a JSON file, rewritten
+// after each batch.
+type FileCheckpoint struct {
+	path     string
+	mu       sync.Mutex
+	progress map[string]*Progress
+}
+
+// NewFileCheckpoint opens the checkpoint at path, which need not exist yet.
+func NewFileCheckpoint(path string) (*FileCheckpoint, error) {
+	c := &FileCheckpoint{path: path, progress: make(map[string]*Progress)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &c.progress); err != nil {
+		return nil, fmt.Errorf("read checkpoint %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *FileCheckpoint) Load(mtAddress string) (*Progress, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	progress := c.progress[mtAddress]
+	if progress == nil {
+		return nil, nil
+	}
+	copied := *progress
+	return &copied, nil
+}
+
+func (c *FileCheckpoint) Save(progress *Progress) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	copied := *progress
+	c.progress[progress.MtAddress] = &copied
+
+	data, err := json.Marshal(c.progress)
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再改名，中断时不会留下半个文件
+	tmp := c.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
@@ -0,0 +1,125 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"github.com/UXUYLabs/go-merkletree/db/chache"
+	"github.com/UXUYLabs/go-merkletree/db/memory"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+// failingStorage fails every write once limit nodes have been written.
+type failingStorage struct {
+	db.Storage
+	written int
+	limit   int
+}
+
+func (s *failingStorage) WriteNodes(ctx context.Context, nodes []*db.TreeNode) error {
+	if s.written+len(nodes) > s.limit {
+		return errors.New("connection lost")
+	}
+	s.written += len(nodes)
+	return s.Storage.(db.BatchWriter).WriteNodes(ctx, nodes)
+}
+
+func newSource(t *testing.T, leaves map[string]int) *memory.MemoryStorage {
+	storage := memory.NewMemoryStorage()
+	manager, err := merkletree.NewMerkleTreeManager(context.Background(), storage, merkletree.WithLogger(merkletree.DiscardLogger))
+	assert.Nil(t, err)
+
+	for mtAddress, n := range leaves {
+		tree, err := manager.CreateTree(mtAddress)
+		assert.Nil(t, err)
+		for i := 0; i < n; i++ {
+			assert.Nil(t, tree.AppendLeaf(fmt.Sprintf("0x%040x", i+1)))
+		}
+	}
+	return storage
+}
+
+func TestMigrateResume(t *testing.T) {
+	ctx := context.Background()
+	src := newSource(t, map[string]int{"campaign-1": 37, "campaign-2": 5})
+
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	dst := chache.NewRedisStorageWithClient(client)
+
+	checkpoint, err := NewFileCheckpoint(filepath.Join(t.TempDir(), "checkpoint.json"))
+	assert.Nil(t, err)
+
+	// 第一次在中途断开
+	_, err = Migrate(ctx, src, &failingStorage{Storage: dst, limit: 50}, Options{BatchSize: 8, Checkpoint: checkpoint})
+	assert.NotNil(t, err)
+
+	results, err := Migrate(ctx, src, dst, Options{BatchSize: 8, Checkpoint: checkpoint})
+	assert.Nil(t, err)
+	assert.Len(t, results, 2)
+
+	// 37个叶子的树共有75个节点，断开前已写入的节点不再重复写入
+	assert.True(t, results[0].Skipped || results[0].Nodes < 75)
+	for _, result := range results {
+		srcRoot, err := src.FindRootNode(ctx, result.MtAddress)
+		assert.Nil(t, err)
+		assert.Equal(t, srcRoot.Hash, result.Root)
+
+		info, err := dst.FindTreeInfo(ctx, result.MtAddress)
+		assert.Nil(t, err)
+		assert.Equal(t, "keccak256", info.Hasher)
+	}
+
+	// 迁移后的树可以继续使用
+	manager, err := merkletree.NewMerkleTreeManager(ctx, dst, merkletree.WithLogger(merkletree.DiscardLogger))
+	assert.Nil(t, err)
+	tree, err := manager.OpenTree("campaign-1")
+	assert.Nil(t, err)
+	proof, err := tree.GenerateProof(fmt.Sprintf("0x%040x", 20))
+	assert.Nil(t, err)
+	ok, err := tree.VerifyProof(proof, fmt.Sprintf("0x%040x", 20))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	results, err = Migrate(ctx, src, dst, Options{Checkpoint: checkpoint})
+	assert.Nil(t, err)
+	assert.True(t, results[0].Skipped)
+	assert.True(t, results[1].Skipped)
+}
+
+func TestMigrateRootMismatch(t *testing.T) {
+	ctx := context.Background()
+	src := newSource(t, map[string]int{"campaign-1": 4})
+	dst := newSource(t, map[string]int{"campaign-1": 5})
+
+	_, err := Migrate(ctx, src, dst, Options{})
+	assert.True(t, errors.Is(err, ErrRootMismatch))
+}
+
+func TestMigrateUnregistered(t *testing.T) {
+	ctx := context.Background()
+	src := newSource(t, map[string]int{"campaign-1": 3})
+	manager, err := merkletree.NewMerkleTreeManager(ctx, src, merkletree.WithLogger(merkletree.DiscardLogger))
+	assert.Nil(t, err)
+	legacy, err := manager.CreateMerkleTree("campaign-0")
+	assert.Nil(t, err)
+	assert.Nil(t, legacy.AppendLeaf(fmt.Sprintf("0x%040x", 1)))
+
+	// 未登记的树同样被迁移
+	dst := memory.NewMemoryStorage()
+	results, err := Migrate(ctx, src, dst, Options{})
+	assert.Nil(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, "campaign-0", results[0].MtAddress)
+	_, err = dst.FindTreeInfo(ctx, "campaign-0")
+	assert.Equal(t, db.ErrNotFound, err)
+
+	// 无法列出树时明确报错
+	_, err = Migrate(ctx, struct{ db.Storage }{src}, memory.NewMemoryStorage(), Options{})
+	assert.True(t, errors.Is(err, db.ErrNotSupported))
+}
@@ -0,0 +1,127 @@
+package merkletree
+
+import (
+	"context"
+	"github.com/UXUYLabs/go-merkletree/db"
+)
+
+// Operation names a tree operation reported to an Observer.
+type Operation string
+
+const (
+	OpAppend       Operation = "append"
+	OpAppendBatch  Operation = "append_batch"
+	OpProof        Operation = "proof"
+	OpVerify       Operation = "verify"
+	OpRoot         Operation = "root"
+	OpLeafIndex    Operation = "leaf_index"
+	OpLeafHashes   Operation = "leaf_hashes"
+	OpLeafCount    Operation = "leaf_count"
+	OpCheck        Operation = "check"
+	OpRebuild      Operation = "rebuild"
+	OpPrint        Operation = "print"
+	OpRenderASCII  Operation = "render_ascii"
+	OpRenderDOT    Operation = "render_dot"
+	OpExportOZDump Operation = "export_oz_dump"
+	OpExportProofs Operation = "export_proofs"
+)
+
+// OperationInfo describes an operation of a tree to its observers. The
+// operation fills in LeafIndex and Levels, when they apply, before it ends.
+type OperationInfo struct {
+	Op        Operation
+	MtAddress string
+	// LeafIndex is the index of the leaf appended, the last one of a batch,
+	// proved or looked up; -1 when there is none
+	LeafIndex int
+	// Levels is the number of levels of the tree, leaves included, the
+	// operation went through; 0 when unknown
+	Levels int
+}
+
+// Observer is notified of the operations of a tree, to export metrics or
+// traces of them.
+type Observer interface {
+	// StartOperation is called when an operation starts. The operation runs
+	// with the returned context, and end is called with its error once it
+	// is done.
+	StartOperation(ctx context.Context, info *OperationInfo) (context.Context, func(err error))
+}
+
+// TreeObserver is implemented by observers also following the size of the
+// trees. ObserveTree is called with the metadata of a tree after each append.
+type TreeObserver interface {
+	ObserveTree(meta *db.TreeMeta)
+}
+
+// WithObserver adds an observer of the operations of a tree. Observers are
+// started in the order they are given and ended in the reverse order.
+func WithObserver(observer Observer) Option {
+	return func(o *options) {
+		o.observers = append(o.observers, observer)
+	}
+}
+
+type operationKey struct{}
+
+// observe starts op with every observer and returns the function ending it.
+// The info of op is kept in the returned context for the operation to fill.
+func (t *MerkleTree) observe(ctx context.Context, op Operation) (context.Context, func(err error)) {
+	if len(t.observers) == 0 {
+		return ctx, func(error) {}
+	}
+
+	info := &OperationInfo{Op: op, MtAddress: t.mtAddress, LeafIndex: -1}
+	ctx = context.WithValue(ctx, operationKey{}, info)
+	ends := make([]func(error), 0, len(t.observers))
+	for _, observer := range t.observers {
+		var end func(error)
+		ctx, end = observer.StartOperation(ctx, info)
+		ends = append(ends, end)
+	}
+	return ctx, func(err error) {
+		for i := len(ends) - 1; i >= 0; i-- {
+			ends[i](err)
+		}
+	}
+}
+
+// observed records the leaf index and the levels of the operation running in
+// ctx, a negative leafIndex or zero levels leaving the info unchanged.
+func observed(ctx context.Context, leafIndex, levels int) {
+	info, ok := ctx.Value(operationKey{}).(*OperationInfo)
+	if !ok {
+		return
+	}
+	if leafIndex >= 0 {
+		info.LeafIndex = leafIndex
+	}
+	if levels > 0 {
+		info.Levels = levels
+	}
+}
+
+// observeTree hands the metadata of the tree to the observers following it.
+func (t *MerkleTree) observeTree(ctx context.Context) {
+	var observers []TreeObserver
+	for _, observer := range t.observers {
+		if treeObserver, ok := observer.(TreeObserver); ok {
+			observers = append(observers, treeObserver)
+		}
+	}
+	if len(observers) == 0 {
+		return
+	}
+
+	meta, err := db.FindTreeMeta(ctx, t.storage, t.mtAddress)
+	if err == db.ErrNotFound {
+		return
+	}
+	if err != nil {
+		t.Error("observeTree FindTreeMeta err: ", err)
+		return
+	}
+	for _, observer := range observers {
+		observer.ObserveTree(meta)
+	}
+}
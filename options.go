@@ -0,0 +1,57 @@
+package merkletree
+
+import (
+	"github.com/UXUYLabs/go-merkletree/db"
+)
+
+// Option configures a MerkleTree, or every tree created by a MerkleTreeManager.
+type Option func(*options)
+
+type options struct {
+	logger     Logger
+	locker     db.Locker
+	hasher     Hasher
+	leafSchema LeafSchema
+	observers  []Observer
+}
+
+func newOptions(logger Logger, opts []Option) *options {
+	o := &options{
+		logger:     logger,
+		hasher:     Keccak256Hasher,
+		leafSchema: AddressSchema,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithLogger replaces the default stdout logger.
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithLocker makes every mutation hold a distributed lock on the tree, for
+// deployments where several processes append to the same tree.
+func WithLocker(locker db.Locker) Option {
+	return func(o *options) {
+		o.locker = locker
+	}
+}
+
+// WithHasher sets the hasher of a tree, Keccak256Hasher by default.
+func WithHasher(hasher Hasher) Option {
+	return func(o *options) {
+		o.hasher = hasher
+	}
+}
+
+// WithLeafSchema sets the leaf schema of a tree, AddressSchema by default.
+func WithLeafSchema(schema LeafSchema) Option {
+	return func(o *options) {
+		o.leafSchema = schema
+	}
+}
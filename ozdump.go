@@ -0,0 +1,255 @@
+package merkletree
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"github.com/UXUYLabs/go-merkletree/keccak256"
+)
+
+// OZDumpFormat is the format of the dumps of OpenZeppelin's StandardMerkleTree.
+const OZDumpFormat = "standard-v1"
+
+var (
+	// ErrOZUnsupported is returned for trees or dumps StandardMerkleTree and
+	// this package cannot both represent: other hashers or leaf encodings
+	// than keccak256 addresses, empty trees and duplicate leaves.
+	ErrOZUnsupported = errors.New("not representable as a StandardMerkleTree")
+	// ErrOZLayout is returned for a number of leaves OZLayoutMatches rejects,
+	// for which the heap layout of StandardMerkleTree gives a different root
+	// than the layout of this package.
+	ErrOZLayout = errors.New("StandardMerkleTree layout gives a different root")
+	// ErrInvalidOZDump is returned for a malformed dump, or one whose hashes
+	// do not match its values.
+	ErrInvalidOZDump = errors.New("invalid StandardMerkleTree dump")
+)
+
+// OZDump is the JSON dump of a StandardMerkleTree, as written by dump() and
+// read by load() of @openzeppelin/merkle-tree.
+type OZDump struct {
+	Format string `json:"format"`
+	// Tree holds the 0x prefixed node hashes in heap order, root first
+	Tree   []string  `json:"tree"`
+	Values []OZValue `json:"values"`
+	// LeafEncoding is the ABI type of each element of a value
+	LeafEncoding []string `json:"leafEncoding"`
+}
+
+// OZValue is a leaf of an OZDump and the index of its hash in Tree.
+type OZValue struct {
+	Value     []string `json:"value"`
+	TreeIndex int      `json:"treeIndex"`
+}
+
+// OZLayoutMatches reports whether n leaves give the same root in the heap
+// layout of StandardMerkleTree as in the layout of this package, which
+// promotes unpaired nodes instead. The layouts only agree when n is 2^k or
+// 3·2^k: 1, 2, 3, 4, 6, 8, 12, 16, 24, ...
+func OZLayoutMatches(n int) bool {
+	if n <= 0 {
+		return false
+	}
+	for n%2 == 0 {
+		n /= 2
+	}
+	return n == 1 || n == 3
+}
+
+// ExportOZDump is ExportOZDumpCtx with the context the tree was created with.
+func (t *MerkleTree) ExportOZDump() ([]byte, error) {
+	return t.ExportOZDumpCtx(t.ctx)
+}
+
+// ExportOZDumpCtx returns the tree as a StandardMerkleTree JSON dump with
+// leaf encoding ["address"], its leaves in index order. The tree must use
+// the keccak256 hasher and have a number of leaves OZLayoutMatches accepts,
+// ErrOZLayout is returned otherwise.
+func (t *MerkleTree) ExportOZDumpCtx(ctx context.Context) (_ []byte, err error) {
+	ctx, end := t.observe(ctx, OpExportOZDump)
+	defer func() { end(err) }()
+
+	if t.hasher != Keccak256Hasher {
+		return nil, fmt.Errorf("%w: hasher %s", ErrOZUnsupported, t.hasher.Name())
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	leaves, err := t.storage.FindNodesByLevel(ctx, t.mtAddress, 0)
+	if err == db.ErrNotFound {
+		return nil, fmt.Errorf("%w: tree %s has no leaves", ErrOZUnsupported, t.mtAddress)
+	}
+	if err != nil {
+		t.Error("ExportOZDump FindNodesByLevel err: ", err)
+		return nil, err
+	}
+	if !OZLayoutMatches(len(leaves)) {
+		return nil, fmt.Errorf("%w: %d leaves, only 2^k or 3·2^k are supported", ErrOZLayout, len(leaves))
+	}
+	root, err := t.storage.FindRootNode(ctx, t.mtAddress)
+	if err != nil {
+		t.Error("ExportOZDump FindRootNode err: ", err)
+		return nil, err
+	}
+
+	hashes := make([][]byte, 0, len(leaves))
+	for no, leaf := range leaves {
+		if leaf.LevelNo != no {
+			return nil, fmt.Errorf("%w: tree %s has no leaf %d", ErrMissingLeaves, t.mtAddress, no)
+		}
+		if !IsAddress(leaf.Data) {
+			return nil, fmt.Errorf("%w: leaf %d %q is not an address", ErrOZUnsupported, no, leaf.Data)
+		}
+		hashes = append(hashes, t.hasher.HashLeaf(leaf.Data))
+	}
+
+	// 叶子数合适时根仍不同说明存储的树本身有误
+	heap := ozHeap(t.hasher, hashes)
+	if keccak256.Bytes2Hex(heap[0]) != root.Hash {
+		return nil, fmt.Errorf("%w: leaves of tree %s give %x instead of its root %s", ErrRootMismatch, t.mtAddress, heap[0], root.Hash)
+	}
+
+	dump := &OZDump{
+		Format:       OZDumpFormat,
+		Tree:         make([]string, 0, len(heap)),
+		Values:       make([]OZValue, 0, len(leaves)),
+		LeafEncoding: []string{"address"},
+	}
+	for _, hash := range heap {
+		dump.Tree = append(dump.Tree, "0x"+keccak256.Bytes2Hex(hash))
+	}
+	for i, leaf := range leaves {
+		dump.Values = append(dump.Values, OZValue{Value: []string{leaf.Data}, TreeIndex: len(heap) - 1 - i})
+	}
+	return json.Marshal(dump)
+}
+
+// ImportOZDump is ImportOZDumpCtx with the context the manager was created with.
+func (mm *MerkleTreeManager) ImportOZDump(mtAddress string, data []byte) (*MerkleTree, error) {
+	return mm.ImportOZDumpCtx(mm.ctx, mtAddress, data)
+}
+
+// ImportOZDumpCtx creates a tree from a StandardMerkleTree JSON dump with
+// leaf encoding ["address"]. Every hash of the dump is checked against its
+// values first. The leaves are appended in the order of their heap position,
+// which StandardMerkleTree sorts by hash by default. ErrOZLayout is returned,
+// before anything is written, for a number of leaves OZLayoutMatches
+// rejects.
+func (mm *MerkleTreeManager) ImportOZDumpCtx(ctx context.Context, mtAddress string, data []byte) (*MerkleTree, error) {
+	var dump OZDump
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOZDump, err)
+	}
+	leaves, root, err := checkOZDump(&dump)
+	if err != nil {
+		return nil, err
+	}
+
+	if !OZLayoutMatches(len(leaves)) {
+		return nil, fmt.Errorf("%w: %d leaves, only 2^k or 3·2^k are supported", ErrOZLayout, len(leaves))
+	}
+	hashes := make([][]byte, 0, len(leaves))
+	for _, leaf := range leaves {
+		hashes = append(hashes, Keccak256Hasher.HashLeaf(leaf))
+	}
+	if promoted := promotedRoot(Keccak256Hasher, hashes); !bytes.Equal(promoted, root) {
+		return nil, fmt.Errorf("%w: %d leaves give %x here instead of %x", ErrOZLayout, len(leaves), promoted, root)
+	}
+
+	tree, err := mm.CreateTreeCtx(ctx, mtAddress, WithHasher(Keccak256Hasher), WithLeafSchema(AddressSchema))
+	if err != nil {
+		return nil, err
+	}
+	if err = tree.AppendLeavesCtx(ctx, leaves); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// checkOZDump verifies every hash of dump, and returns its leaves in heap
+// order with its root.
+func checkOZDump(dump *OZDump) ([]string, []byte, error) {
+	if dump.Format != OZDumpFormat {
+		return nil, nil, fmt.Errorf("%w: format %q", ErrInvalidOZDump, dump.Format)
+	}
+	if len(dump.LeafEncoding) != 1 || dump.LeafEncoding[0] != "address" {
+		return nil, nil, fmt.Errorf("%w: leaf encoding %v", ErrOZUnsupported, dump.LeafEncoding)
+	}
+	n := len(dump.Values)
+	if n == 0 {
+		return nil, nil, fmt.Errorf("%w: no values", ErrOZUnsupported)
+	}
+	if len(dump.Tree) != 2*n-1 {
+		return nil, nil, fmt.Errorf("%w: %d nodes for %d values", ErrInvalidOZDump, len(dump.Tree), n)
+	}
+
+	heap := make([][]byte, len(dump.Tree))
+	for i, node := range dump.Tree {
+		hash, err := keccak256.Decode(node)
+		if err != nil || len(hash) != 32 {
+			return nil, nil, fmt.Errorf("%w: node %d %q is not a 32 byte hash", ErrInvalidOZDump, i, node)
+		}
+		heap[i] = hash
+	}
+
+	// 叶子位于堆的末尾 n 个位置，逆序即为追加顺序
+	leaves := make([]string, n)
+	seen := make(map[string]bool, n)
+	for i, value := range dump.Values {
+		if len(value.Value) != 1 || AddressSchema.Validate(value.Value[0]) != nil {
+			return nil, nil, fmt.Errorf("%w: value %d %v is not an address", ErrInvalidOZDump, i, value.Value)
+		}
+		leaf := value.Value[0]
+		if value.TreeIndex < n-1 || value.TreeIndex >= len(heap) || leaves[len(heap)-1-value.TreeIndex] != "" {
+			return nil, nil, fmt.Errorf("%w: value %d has tree index %d", ErrInvalidOZDump, i, value.TreeIndex)
+		}
+		if !bytes.Equal(Keccak256Hasher.HashLeaf(leaf), heap[value.TreeIndex]) {
+			return nil, nil, fmt.Errorf("%w: value %d does not hash to node %d", ErrInvalidOZDump, i, value.TreeIndex)
+		}
+		hash := keccak256.Bytes2Hex(heap[value.TreeIndex])
+		if seen[hash] {
+			return nil, nil, fmt.Errorf("%w: duplicate leaf %s", ErrOZUnsupported, leaf)
+		}
+		seen[hash] = true
+		leaves[len(heap)-1-value.TreeIndex] = leaf
+	}
+	for i := n - 2; i >= 0; i-- {
+		if !bytes.Equal(Keccak256Hasher.HashPair(heap[2*i+1], heap[2*i+2]), heap[i]) {
+			return nil, nil, fmt.Errorf("%w: node %d does not hash its children", ErrInvalidOZDump, i)
+		}
+	}
+	return leaves, heap[0], nil
+}
+
+// ozHeap lays leaf hashes out as StandardMerkleTree does: a complete binary
+// tree in an array, root first, the first leaf last.
+func ozHeap(hasher Hasher, hashes [][]byte) [][]byte {
+	heap := make([][]byte, 2*len(hashes)-1)
+	for i, hash := range hashes {
+		heap[len(heap)-1-i] = hash
+	}
+	for i := len(hashes) - 2; i >= 0; i-- {
+		heap[i] = hasher.HashPair(heap[2*i+1], heap[2*i+2])
+	}
+	return heap
+}
+
+// promotedRoot computes the root appending the leaf hashes would give,
+// promoting unpaired nodes as appendLeaf does.
+func promotedRoot(hasher Hasher, hashes [][]byte) []byte {
+	for len(hashes) > 1 {
+		parents := make([][]byte, 0, (len(hashes)+1)/2)
+		for i := 0; i < len(hashes); i += 2 {
+			if i+1 < len(hashes) {
+				parents = append(parents, hasher.HashPair(hashes[i], hashes[i+1]))
+			} else {
+				parents = append(parents, hashes[i])
+			}
+		}
+		hashes = parents
+	}
+	return hashes[0]
+}
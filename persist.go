@@ -0,0 +1,56 @@
+package merkletree
+
+import (
+	"context"
+	"github.com/UXUYLabs/go-merkletree/db/memory"
+	"io"
+)
+
+// OpenMemoryMerkleTreeManager returns a manager on a memory storage persisted
+// in dir. After the storage has recovered from its snapshot and log, the root
+// of every tree is recomputed from its leaves; a mismatch fails with
+// ErrRootMismatch. Appends a crash interrupted are recovered first, as
+// OpenTree does. Call Close to take a last snapshot.
+func OpenMemoryMerkleTreeManager(ctx context.Context, dir string, persist memory.PersistOptions, opts ...Option) (*MerkleTreeManager, error) {
+	storage, err := memory.OpenMemoryStorage(dir, persist)
+	if err != nil {
+		return nil, err
+	}
+
+	mm, err := NewMerkleTreeManager(ctx, storage, opts...)
+	if err != nil {
+		storage.Close()
+		return nil, err
+	}
+
+	for _, mtAddress := range storage.TreeAddresses() {
+		if err = mm.verifyRoot(ctx, mtAddress); err != nil {
+			mm.Error("OpenMemoryMerkleTreeManager verifyRoot err: ", err, "mtAddress", mtAddress)
+			storage.Close()
+			return nil, err
+		}
+	}
+
+	return mm, nil
+}
+
+// Close closes the storage of the manager if it needs closing.
+func (mm *MerkleTreeManager) Close() error {
+	if closer, ok := mm.storage.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// verifyRoot recovers an interrupted append of a tree, then checks it with
+// the hasher it was registered with.
+func (mm *MerkleTreeManager) verifyRoot(ctx context.Context, mtAddress string) error {
+	tree, err := mm.inspectTree(ctx, mtAddress)
+	if err != nil {
+		return err
+	}
+	if err = tree.recoverAppend(ctx); err != nil {
+		return err
+	}
+	return tree.checkRoot(ctx)
+}
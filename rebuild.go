@@ -0,0 +1,261 @@
+package merkletree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"github.com/UXUYLabs/go-merkletree/keccak256"
+)
+
+// ErrMissingLeaves is returned by RebuildFromLeaves for a tree whose leaves
+// do not form a contiguous run from 0: the tree they define is unknown.
+var ErrMissingLeaves = errors.New("tree has gaps in its leaves")
+
+// RebuildOptions configures RebuildFromLeaves.
+type RebuildOptions struct {
+	// DryRun computes the report without writing anything
+	DryRun bool
+}
+
+// RebuildReport describes the repair of a tree, or the repair a dry run
+// would make.
+type RebuildReport struct {
+	MtAddress string
+	LeafCount int
+	Depth     int
+	// Root is the hex root hash the leaves give
+	Root string
+	// Rewritten are the positions whose node was missing or wrong
+	Rewritten []db.NodePos
+	// Removed are the positions of orphaned nodes
+	Removed []db.NodePos
+	// Meta is set when the metadata of the tree is recomputed
+	Meta   bool
+	DryRun bool
+}
+
+// RebuildFromLeaves reads the leaves of the tree in index order and
+// recomputes every node above them with the tree's hasher, leaf hashes
+// included. Nodes which are missing or differ, and leaves the leaf index
+// does not find, are written in one transaction; orphaned nodes are then
+// removed, which needs a storage implementing db.NodeRemover. A sealed tree
+// is repaired as well. Rebuilding a consistent tree writes nothing.
+func (t *MerkleTree) RebuildFromLeaves(ctx context.Context, opts RebuildOptions) (_ *RebuildReport, err error) {
+	ctx, end := t.observe(ctx, OpRebuild)
+	defer func() { end(err) }()
+
+	if opts.DryRun {
+		t.mu.RLock()
+		defer t.mu.RUnlock()
+		report, _, err := t.planRebuild(ctx)
+		if err != nil {
+			return nil, err
+		}
+		report.DryRun = true
+		return report, nil
+	}
+
+	var report *RebuildReport
+	err = t.exclusive(ctx, func(ctx context.Context, lease db.Lease) error {
+		var writes []*db.TreeNode
+		var err error
+		if report, writes, err = t.planRebuild(ctx); err != nil {
+			return err
+		}
+		return t.applyRebuild(ctx, lease, report, writes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// planRebuild compares the stored tree with the one its leaves define, and
+// returns the nodes to write.
+func (t *MerkleTree) planRebuild(ctx context.Context) (*RebuildReport, []*db.TreeNode, error) {
+	leaves, err := t.storage.FindNodesByLevel(ctx, t.mtAddress, 0)
+	if err == db.ErrNotFound {
+		return nil, nil, ErrTreeNotFound
+	}
+	if err != nil {
+		t.Error("RebuildFromLeaves FindNodesByLevel err: ", err)
+		return nil, nil, err
+	}
+
+	meta, err := db.FindTreeMeta(ctx, t.storage, t.mtAddress)
+	if err != nil && err != db.ErrNotFound {
+		t.Error("RebuildFromLeaves FindTreeMeta err: ", err)
+		return nil, nil, err
+	}
+
+	report := &RebuildReport{MtAddress: t.mtAddress, LeafCount: len(leaves)}
+	var writes []*db.TreeNode
+	level := make([]*db.TreeNode, 0, len(leaves))
+	for no, leaf := range leaves {
+		if leaf.LevelNo != no {
+			return nil, nil, fmt.Errorf("%w: tree %s has no leaf %d", ErrMissingLeaves, t.mtAddress, no)
+		}
+		if err = ValidateLeaf(t.schema, leaf.Data); err != nil {
+			return nil, nil, fmt.Errorf("tree %s leaf %d: %w", t.mtAddress, no, err)
+		}
+
+		node := leaf.Clone()
+		node.Hash = keccak256.Bytes2Hex(t.hasher.HashLeaf(leaf.Data))
+		indexed, err := t.storage.FindOneByLeafData(ctx, t.mtAddress, leaf.Data)
+		if err != nil && err != db.ErrNotFound {
+			t.Error("RebuildFromLeaves FindOneByLeafData err: ", err)
+			return nil, nil, err
+		}
+		// 重写叶子的同时修正索引
+		if node.Hash != leaf.Hash || indexed == nil || indexed.Level != 0 || indexed.LevelNo != no {
+			writes = append(writes, node)
+		}
+		level = append(level, node)
+	}
+
+	var top *db.TreeNode
+	for l := 0; ; l++ {
+		stored, err := t.storage.FindNodesByLevel(ctx, t.mtAddress, l)
+		if err != nil && err != db.ErrNotFound {
+			t.Error("RebuildFromLeaves FindNodesByLevel err: ", err)
+			return nil, nil, err
+		}
+
+		if level != nil {
+			byNo := make(map[int]*db.TreeNode, len(stored))
+			for _, node := range stored {
+				byNo[node.LevelNo] = node
+			}
+			for _, node := range level {
+				old := byNo[node.LevelNo]
+				if l > 0 && (old == nil || old.Hash != node.Hash || old.Data != "") {
+					writes = append(writes, node)
+				}
+			}
+		}
+		for _, node := range stored {
+			if node.LevelNo < 0 || node.LevelNo >= len(level) {
+				report.Removed = append(report.Removed, db.NodePos{Level: l, LevelNo: node.LevelNo})
+			}
+		}
+
+		if len(level) == 1 {
+			top, report.Depth = level[0], l+1
+			level = nil
+		} else if level != nil {
+			level = t.parentLevel(l+1, level)
+		}
+		// 根之上的层读到空为止，且不低于元数据记录的根
+		if level == nil && err == db.ErrNotFound && (meta == nil || l >= meta.RootLevel) {
+			break
+		}
+	}
+	report.Root = top.Hash
+
+	for _, node := range writes {
+		report.Rewritten = append(report.Rewritten, db.NodePos{Level: node.Level, LevelNo: node.LevelNo})
+	}
+	report.Meta = len(report.Removed) > 0 || meta == nil || meta.LeafCount != report.LeafCount ||
+		meta.RootLevel != top.Level || meta.RootLevelNo != top.LevelNo || meta.RootHash != top.Hash
+	return report, writes, nil
+}
+
+// parentLevel computes the nodes of level from those of the level below,
+// promoting an unpaired node as appendLeaf does.
+func (t *MerkleTree) parentLevel(level int, children []*db.TreeNode) []*db.TreeNode {
+	parents := make([]*db.TreeNode, 0, (len(children)+1)/2)
+	for i := 0; i < len(children); i += 2 {
+		hash := children[i].Hash
+		if i+1 < len(children) {
+			hash = t.hashBranch(children[i].Hash, children[i+1].Hash)
+		}
+		parents = append(parents, &db.TreeNode{
+			MtAddress: t.mtAddress,
+			Hash:      hash,
+			Level:     level,
+			LevelNo:   i / 2,
+		})
+	}
+	return parents
+}
+
+// applyRebuild makes the repairs planRebuild found, and records them in the
+// audit log.
+func (t *MerkleTree) applyRebuild(ctx context.Context, lease db.Lease, report *RebuildReport, writes []*db.TreeNode) error {
+	if len(writes) == 0 && !report.Meta {
+		return nil
+	}
+	oldRoot, err := rootHash(ctx, t.storage, t.mtAddress)
+	if err != nil {
+		t.Error("RebuildFromLeaves FindRootNode err: ", err)
+		return err
+	}
+	if err = t.repair(ctx, lease, report, writes); err != nil {
+		return err
+	}
+
+	err = audit(ctx, t.storage, &db.AuditEntry{MtAddress: t.mtAddress, Op: db.AuditRebuild, LeafIndex: -1, OldRoot: oldRoot, NewRoot: report.Root})
+	if err != nil {
+		t.Error("RebuildFromLeaves audit err: ", err)
+		return err
+	}
+	return nil
+}
+
+func (t *MerkleTree) repair(ctx context.Context, lease db.Lease, report *RebuildReport, writes []*db.TreeNode) error {
+	if len(writes) > 0 {
+		err := t.withTx(ctx, lease, func(ctx context.Context, storage db.Storage) error {
+			for _, node := range writes {
+				if err := storage.Insert(ctx, node); err != nil {
+					t.Error("RebuildFromLeaves Insert err: ", err)
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if !report.Meta {
+		return nil
+	}
+	if len(report.Removed) == 0 {
+		// 写入根节点时元数据通常已随之更新
+		meta, err := db.FindTreeMeta(ctx, t.storage, t.mtAddress)
+		if err == nil && meta.LeafCount == report.LeafCount && meta.Depth == report.Depth &&
+			meta.RootLevelNo == 0 && meta.RootHash == report.Root {
+			return nil
+		}
+	}
+	if !db.Supports(t.storage, (*db.NodeRemover)(nil)) {
+		return db.ErrNotSupported
+	}
+	remover := t.storage.(db.NodeRemover)
+	poses := make([]*db.NodePos, 0, len(report.Removed))
+	for i := range report.Removed {
+		poses = append(poses, &report.Removed[i])
+	}
+	if err := remover.RemoveNodes(ctx, t.mtAddress, poses); err != nil {
+		t.Error("RebuildFromLeaves RemoveNodes err: ", err)
+		return err
+	}
+	return nil
+}
+
+// RebuildTree is RebuildTreeCtx with the context the manager was created with.
+func (mm *MerkleTreeManager) RebuildTree(mtAddress string, opts RebuildOptions) (*RebuildReport, error) {
+	return mm.RebuildTreeCtx(mm.ctx, mtAddress, opts)
+}
+
+// RebuildTreeCtx runs RebuildFromLeaves on a tree with the hasher and leaf
+// schema it was registered with, without registering it.
+func (mm *MerkleTreeManager) RebuildTreeCtx(ctx context.Context, mtAddress string, opts RebuildOptions) (*RebuildReport, error) {
+	tree, err := mm.inspectTree(ctx, mtAddress)
+	if err != nil {
+		return nil, err
+	}
+	return tree.RebuildFromLeaves(ctx, opts)
+}
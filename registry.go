@@ -0,0 +1,338 @@
+package merkletree
+
+import (
+	"context"
+	"errors"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"log"
+	"os"
+	"time"
+)
+
+var (
+	// ErrTreeExists is returned by CreateTree for a tree already registered.
+	ErrTreeExists = errors.New("merkle tree already exists")
+	// ErrTreeNotFound is returned for a tree that is neither registered nor has any node.
+	ErrTreeNotFound = errors.New("merkle tree not found")
+	// ErrTreeSealed is returned when appending to a sealed tree.
+	ErrTreeSealed = errors.New("merkle tree is sealed")
+)
+
+// TreeInfo describes a tree of the registry. LeafCount and Root reflect the
+// stored nodes at the time of the call.
+type TreeInfo struct {
+	ID         string
+	CreatedAt  time.Time
+	Hasher     string
+	LeafSchema string
+	Sealed     bool
+	LeafCount  int
+	// Root is the hex root hash, empty for a tree without leaves
+	Root string
+}
+
+// CreateTree is CreateTreeCtx with the context the manager was created with.
+func (mm *MerkleTreeManager) CreateTree(mtAddress string, opts ...Option) (*MerkleTree, error) {
+	return mm.CreateTreeCtx(mm.ctx, mtAddress, opts...)
+}
+
+// CreateTreeCtx registers a new tree and returns its handle. The hasher and leaf
+// schema given by opts are recorded, so OpenTree restores them later. ctx is
+// only used to create the tree, the handle keeps the context of the manager.
+// It fails with db.ErrNotSupported when the storage does not implement
+// db.TreeRegistry.
+func (mm *MerkleTreeManager) CreateTreeCtx(ctx context.Context, mtAddress string, opts ...Option) (*MerkleTree, error) {
+	if !db.Supports(mm.storage, (*db.TreeRegistry)(nil)) {
+		return nil, db.ErrNotSupported
+	}
+	registry := mm.storage.(db.TreeRegistry)
+	o := mm.treeOptions(opts)
+	info := &db.TreeInfo{
+		MtAddress:  mtAddress,
+		CreatedAt:  time.Now().UTC(),
+		Hasher:     o.hasher.Name(),
+		LeafSchema: o.leafSchema.Name(),
+	}
+
+	err := registry.InsertTreeInfo(ctx, info)
+	if err == db.ErrAlreadyExists {
+		return nil, ErrTreeExists
+	}
+	if err != nil {
+		mm.Error("CreateTree InsertTreeInfo err: ", err, "mtAddress", mtAddress)
+		return nil, err
+	}
+	err = audit(ctx, mm.storage, &db.AuditEntry{MtAddress: mtAddress, Op: db.AuditCreate, LeafIndex: -1})
+	if err != nil {
+		mm.Error("CreateTree audit err: ", err, "mtAddress", mtAddress)
+		return nil, err
+	}
+
+	tree := newMerkleTree(mm.ctx, mm.storage, mtAddress, mm.treeLock(mtAddress), o)
+	return tree, nil
+}
+
+// OpenTree is OpenTreeCtx with the context the manager was created with.
+func (mm *MerkleTreeManager) OpenTree(mtAddress string) (*MerkleTree, error) {
+	return mm.OpenTreeCtx(mm.ctx, mtAddress)
+}
+
+// OpenTreeCtx returns the handle of an existing tree, using the hasher and leaf
+// schema it was created with. A tree built before the registry existed is
+// registered with the default hasher and schema on first open; without a
+// db.TreeRegistry every tree with nodes is opened with the defaults. An append
+// a crash interrupted is completed, or undone if its leaf was never written.
+// ctx is only used to open the tree, the handle keeps the context of the
+// manager.
+func (mm *MerkleTreeManager) OpenTreeCtx(ctx context.Context, mtAddress string) (*MerkleTree, error) {
+	info, err := mm.findTreeInfo(ctx, mtAddress)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := mm.openTree(info)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tree.recoverAppend(ctx); err != nil {
+		mm.Error("OpenTree recoverAppend err: ", err, "mtAddress", mtAddress)
+		return nil, err
+	}
+	return tree, nil
+}
+
+// OpenTreeReadOnly is OpenTreeReadOnlyCtx with the context the manager was created with.
+func (mm *MerkleTreeManager) OpenTreeReadOnly(mtAddress string) (*MerkleTree, error) {
+	return mm.OpenTreeReadOnlyCtx(mm.ctx, mtAddress)
+}
+
+// OpenTreeReadOnlyCtx returns the handle of an existing tree to read it. Unlike
+// OpenTreeCtx it writes nothing and does not take the exclusive lease of the
+// tree: a legacy tree is opened with the defaults but left unregistered, and
+// an append a crash interrupted is left for the next OpenTree to recover. It fails with ErrTreeNotFound for
+// a tree neither registered nor holding nodes.
+func (mm *MerkleTreeManager) OpenTreeReadOnlyCtx(ctx context.Context, mtAddress string) (*MerkleTree, error) {
+	info, _, err := mm.viewTreeInfo(ctx, mtAddress)
+	if err != nil {
+		return nil, err
+	}
+	return mm.openTree(info)
+}
+
+// openTree returns the handle of a tree with the hasher and leaf schema of its
+// record.
+func (mm *MerkleTreeManager) openTree(info *db.TreeInfo) (*MerkleTree, error) {
+	hasher, err := LookupHasher(info.Hasher)
+	if err != nil {
+		mm.Error("OpenTree err: ", err, "mtAddress", info.MtAddress)
+		return nil, err
+	}
+	schema, err := LookupLeafSchema(info.LeafSchema)
+	if err != nil {
+		mm.Error("OpenTree err: ", err, "mtAddress", info.MtAddress)
+		return nil, err
+	}
+
+	o := mm.treeOptions([]Option{WithHasher(hasher), WithLeafSchema(schema)})
+	return newMerkleTree(mm.ctx, mm.storage, info.MtAddress, mm.treeLock(info.MtAddress), o), nil
+}
+
+// ListTrees is ListTreesCtx with the context the manager was created with.
+func (mm *MerkleTreeManager) ListTrees() ([]*TreeInfo, error) {
+	return mm.ListTreesCtx(mm.ctx)
+}
+
+// ListTreesCtx returns every registered tree ordered by ID. It fails with
+// db.ErrNotSupported when the storage does not implement db.TreeRegistry.
+func (mm *MerkleTreeManager) ListTreesCtx(ctx context.Context) ([]*TreeInfo, error) {
+	if !db.Supports(mm.storage, (*db.TreeRegistry)(nil)) {
+		return nil, db.ErrNotSupported
+	}
+	registry := mm.storage.(db.TreeRegistry)
+	infos, err := registry.ListTreeInfos(ctx)
+	if err != nil {
+		mm.Error("ListTrees err: ", err)
+		return nil, err
+	}
+
+	var retsz []*TreeInfo
+	for _, info := range infos {
+		treeInfo, err := mm.treeInfo(ctx, info)
+		if err != nil {
+			return nil, err
+		}
+		retsz = append(retsz, treeInfo)
+	}
+	return retsz, nil
+}
+
+// TreeInfo is TreeInfoCtx with the context the manager was created with.
+func (mm *MerkleTreeManager) TreeInfo(mtAddress string) (*TreeInfo, error) {
+	return mm.TreeInfoCtx(mm.ctx, mtAddress)
+}
+
+// TreeInfoCtx returns the registry record of a tree, made up from the defaults
+// for a legacy tree, which it leaves unregistered.
+func (mm *MerkleTreeManager) TreeInfoCtx(ctx context.Context, mtAddress string) (*TreeInfo, error) {
+	info, _, err := mm.viewTreeInfo(ctx, mtAddress)
+	if err != nil {
+		return nil, err
+	}
+	return mm.treeInfo(ctx, info)
+}
+
+// SealTree is SealTreeCtx with the context the manager was created with.
+func (mm *MerkleTreeManager) SealTree(mtAddress string) error {
+	return mm.SealTreeCtx(mm.ctx, mtAddress)
+}
+
+// SealTreeCtx marks a tree as final, further appends fail with ErrTreeSealed.
+// It fails with db.ErrNotSupported when the storage does not implement
+// db.TreeRegistry.
+func (mm *MerkleTreeManager) SealTreeCtx(ctx context.Context, mtAddress string) error {
+	if !db.Supports(mm.storage, (*db.TreeRegistry)(nil)) {
+		return db.ErrNotSupported
+	}
+	registry := mm.storage.(db.TreeRegistry)
+	tree, err := mm.OpenTreeCtx(ctx, mtAddress)
+	if err != nil {
+		return err
+	}
+
+	// 等待进行中的追加完成后再封存
+	return tree.exclusive(ctx, func(ctx context.Context, lease db.Lease) error {
+		info, err := registry.FindTreeInfo(ctx, mtAddress)
+		if err != nil {
+			mm.Error("SealTree FindTreeInfo err: ", err, "mtAddress", mtAddress)
+			return err
+		}
+		info.Sealed = true
+		if err = registry.UpdateTreeInfo(ctx, info); err != nil {
+			mm.Error("SealTree UpdateTreeInfo err: ", err, "mtAddress", mtAddress)
+			return err
+		}
+
+		root, err := rootHash(ctx, mm.storage, mtAddress)
+		if err == nil {
+			err = audit(ctx, mm.storage, &db.AuditEntry{MtAddress: mtAddress, Op: db.AuditSeal, LeafIndex: -1, OldRoot: root, NewRoot: root})
+		}
+		if err != nil {
+			mm.Error("SealTree audit err: ", err, "mtAddress", mtAddress)
+			return err
+		}
+		return nil
+	})
+}
+
+func (mm *MerkleTreeManager) treeOptions(opts []Option) *options {
+	return newOptions(PrintfLogger(log.New(os.Stdout, "merkleTree: ", log.LstdFlags)), append(mm.opts[:len(mm.opts):len(mm.opts)], opts...))
+}
+
+// findTreeInfo reads the registry record of a tree, registering legacy trees
+// which have nodes but no record. Without a registry the record of a tree with
+// nodes is made up from the defaults.
+func (mm *MerkleTreeManager) findTreeInfo(ctx context.Context, mtAddress string) (*db.TreeInfo, error) {
+	info, registered, err := mm.viewTreeInfo(ctx, mtAddress)
+	if err != nil || registered || !db.Supports(mm.storage, (*db.TreeRegistry)(nil)) {
+		return info, err
+	}
+
+	registry := mm.storage.(db.TreeRegistry)
+	err = registry.InsertTreeInfo(ctx, info)
+	if err == db.ErrAlreadyExists {
+		// 并发打开时由另一方完成了登记
+		return registry.FindTreeInfo(ctx, mtAddress)
+	}
+	if err != nil {
+		mm.Error("FindTreeInfo InsertTreeInfo err: ", err, "mtAddress", mtAddress)
+		return nil, err
+	}
+	return info, nil
+}
+
+// viewTreeInfo reads the registry record of a tree, and reports whether it is
+// registered. The record of a tree with nodes but no record is made up from
+// the defaults.
+func (mm *MerkleTreeManager) viewTreeInfo(ctx context.Context, mtAddress string) (*db.TreeInfo, bool, error) {
+	info, err := registeredTreeInfo(ctx, mm.storage, mtAddress)
+	if err != nil {
+		mm.Error("FindTreeInfo err: ", err, "mtAddress", mtAddress)
+		return nil, false, err
+	}
+	if info != nil {
+		return info, true, nil
+	}
+
+	if _, err = db.FindTreeMeta(ctx, mm.storage, mtAddress); err == db.ErrNotFound {
+		return nil, false, ErrTreeNotFound
+	} else if err != nil {
+		mm.Error("FindTreeInfo FindTreeMeta err: ", err, "mtAddress", mtAddress)
+		return nil, false, err
+	}
+
+	info = &db.TreeInfo{
+		MtAddress:  mtAddress,
+		CreatedAt:  time.Now().UTC(),
+		Hasher:     Keccak256Hasher.Name(),
+		LeafSchema: AddressSchema.Name(),
+	}
+	return info, false, nil
+}
+
+// inspectTree returns a handle of a tree with the hasher and leaf schema it
+// was registered with, or the defaults for a legacy tree, which unlike
+// OpenTree is left unregistered.
+func (mm *MerkleTreeManager) inspectTree(ctx context.Context, mtAddress string) (*MerkleTree, error) {
+	o := mm.treeOptions(nil)
+	info, err := registeredTreeInfo(ctx, mm.storage, mtAddress)
+	if err != nil {
+		mm.Error("FindTreeInfo err: ", err, "mtAddress", mtAddress)
+		return nil, err
+	}
+	if info != nil {
+		if o.hasher, err = LookupHasher(info.Hasher); err != nil {
+			return nil, err
+		}
+		if o.leafSchema, err = LookupLeafSchema(info.LeafSchema); err != nil {
+			return nil, err
+		}
+	}
+
+	return newMerkleTree(mm.ctx, mm.storage, mtAddress, mm.treeLock(mtAddress), o), nil
+}
+
+func (mm *MerkleTreeManager) treeInfo(ctx context.Context, info *db.TreeInfo) (*TreeInfo, error) {
+	treeInfo := &TreeInfo{
+		ID:         info.MtAddress,
+		CreatedAt:  info.CreatedAt,
+		Hasher:     info.Hasher,
+		LeafSchema: info.LeafSchema,
+		Sealed:     info.Sealed,
+	}
+
+	meta, err := db.FindTreeMeta(ctx, mm.storage, info.MtAddress)
+	if err == db.ErrNotFound {
+		return treeInfo, nil
+	}
+	if err != nil {
+		mm.Error("TreeInfo FindTreeMeta err: ", err, "mtAddress", info.MtAddress)
+		return nil, err
+	}
+	treeInfo.LeafCount = meta.LeafCount
+	treeInfo.Root = meta.RootHash
+	return treeInfo, nil
+}
+
+// registeredTreeInfo returns the registry record of a tree, or nil for a tree not
+// registered or a storage without a db.TreeRegistry.
+func registeredTreeInfo(ctx context.Context, storage db.Storage, mtAddress string) (*db.TreeInfo, error) {
+	if !db.Supports(storage, (*db.TreeRegistry)(nil)) {
+		return nil, nil
+	}
+	registry := storage.(db.TreeRegistry)
+	info, err := registry.FindTreeInfo(ctx, mtAddress)
+	if err == db.ErrNotFound {
+		return nil, nil
+	}
+	return info, err
+}
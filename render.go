@@ -0,0 +1,241 @@
+package merkletree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"io"
+	"strings"
+)
+
+// DefaultHashLength is the number of hex digits of the hashes renderers show.
+const DefaultHashLength = 8
+
+// ErrLeafNotFound is returned by the renderers for a highlighted leaf which
+// is not in the tree.
+var ErrLeafNotFound = errors.New("leaf not in tree")
+
+// RenderOptions configures RenderASCII and RenderDOT.
+type RenderOptions struct {
+	// HashLength is the number of hex digits of each hash shown,
+	// DefaultHashLength when zero, every digit when negative
+	HashLength int
+	// Highlight is the data of a leaf whose proof path is marked: its
+	// branch up to the root, and the siblings forming its proof
+	Highlight string
+	// MaxDepth is the number of levels shown from the root down, every
+	// level when zero; nodes whose children are cut are marked
+	MaxDepth int
+}
+
+// mark is how a rendered node relates to the highlighted leaf.
+type mark int
+
+const (
+	markNone mark = iota
+	markPath
+	markProof
+)
+
+// rendering holds the levels of a tree read for a renderer.
+type rendering struct {
+	opts   RenderOptions
+	root   *db.TreeNode
+	levels map[int][]*db.TreeNode
+	nodes  map[db.NodePos]*db.TreeNode
+	// lowest is the lowest level read
+	lowest int
+	marks  map[db.NodePos]mark
+}
+
+// RenderASCII is RenderASCIICtx with the context the tree was created with.
+func (t *MerkleTree) RenderASCII(w io.Writer, opts RenderOptions) error {
+	return t.RenderASCIICtx(t.ctx, w, opts)
+}
+
+// RenderASCIICtx writes the tree to w as an indented ASCII tree, root first,
+// each node as level:levelNo, hash and leaf data. The highlighted branch is
+// marked [path] and its proof [proof].
+func (t *MerkleTree) RenderASCIICtx(ctx context.Context, w io.Writer, opts RenderOptions) (err error) {
+	ctx, end := t.observe(ctx, OpRenderASCII)
+	defer func() { end(err) }()
+
+	r, err := t.rendering(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		_, err = fmt.Fprintln(w, "(empty)")
+		return err
+	}
+
+	var sb strings.Builder
+	r.ascii(&sb, r.root, "", "")
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+func (r *rendering) ascii(sb *strings.Builder, node *db.TreeNode, prefix, childPrefix string) {
+	sb.WriteString(prefix)
+	sb.WriteString(r.label(node, " "))
+	switch r.marks[db.NodePos{Level: node.Level, LevelNo: node.LevelNo}] {
+	case markPath:
+		sb.WriteString(" [path]")
+	case markProof:
+		sb.WriteString(" [proof]")
+	}
+	sb.WriteString("\n")
+
+	if node.Level > 0 && node.Level == r.lowest {
+		sb.WriteString(childPrefix + "└── ...\n")
+		return
+	}
+	children := r.children(node)
+	for i, child := range children {
+		if i == len(children)-1 {
+			r.ascii(sb, child, childPrefix+"└── ", childPrefix+"    ")
+		} else {
+			r.ascii(sb, child, childPrefix+"├── ", childPrefix+"│   ")
+		}
+	}
+}
+
+// RenderDOT is RenderDOTCtx with the context the tree was created with.
+func (t *MerkleTree) RenderDOT(w io.Writer, opts RenderOptions) error {
+	return t.RenderDOTCtx(t.ctx, w, opts)
+}
+
+// RenderDOTCtx writes the tree to w as a Graphviz digraph, edges from parent
+// to child. The highlighted branch is filled gold and its proof light blue.
+func (t *MerkleTree) RenderDOTCtx(ctx context.Context, w io.Writer, opts RenderOptions) (err error) {
+	ctx, end := t.observe(ctx, OpRenderDOT)
+	defer func() { end(err) }()
+
+	r, err := t.rendering(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "digraph %s {\n", dotQuote(t.mtAddress))
+	sb.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+	if r != nil {
+		for level := r.root.Level; level >= r.lowest; level-- {
+			for _, node := range r.levels[level] {
+				id := dotID(node.Level, node.LevelNo)
+				attrs := "label=" + dotQuote(r.label(node, "\n"))
+				switch r.marks[db.NodePos{Level: node.Level, LevelNo: node.LevelNo}] {
+				case markPath:
+					attrs += ", style=filled, fillcolor=gold"
+				case markProof:
+					attrs += ", style=filled, fillcolor=lightblue"
+				}
+				fmt.Fprintf(&sb, "  %s [%s];\n", id, attrs)
+
+				if level > 0 && level == r.lowest {
+					more := dotQuote(fmt.Sprintf("%d:%d...", node.Level, node.LevelNo))
+					fmt.Fprintf(&sb, "  %s [label=\"...\", shape=plaintext];\n  %s -> %s [style=dashed];\n", more, id, more)
+					continue
+				}
+				for _, child := range r.children(node) {
+					fmt.Fprintf(&sb, "  %s -> %s;\n", id, dotID(child.Level, child.LevelNo))
+				}
+			}
+		}
+	}
+	sb.WriteString("}\n")
+
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+// rendering reads the levels opts shows under the read lock, nil for an
+// empty tree.
+func (t *MerkleTree) rendering(ctx context.Context, opts RenderOptions) (*rendering, error) {
+	if opts.HashLength == 0 {
+		opts.HashLength = DefaultHashLength
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	root, err := t.storage.FindRootNode(ctx, t.mtAddress)
+	if err == db.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		t.Error("render FindRootNode err: ", err)
+		return nil, err
+	}
+
+	r := &rendering{opts: opts, root: root, levels: make(map[int][]*db.TreeNode), nodes: make(map[db.NodePos]*db.TreeNode), marks: make(map[db.NodePos]mark)}
+	if opts.MaxDepth > 0 && root.Level-opts.MaxDepth+1 > 0 {
+		r.lowest = root.Level - opts.MaxDepth + 1
+	}
+	observed(ctx, -1, root.Level+1)
+	r.levels[root.Level] = []*db.TreeNode{root}
+	for level := root.Level - 1; level >= r.lowest; level-- {
+		nodes, err := t.storage.FindNodesByLevel(ctx, t.mtAddress, level)
+		if err != nil && err != db.ErrNotFound {
+			t.Error("render FindNodesByLevel err: ", err)
+			return nil, err
+		}
+		r.levels[level] = nodes
+		for _, node := range nodes {
+			r.nodes[db.NodePos{Level: node.Level, LevelNo: node.LevelNo}] = node
+		}
+	}
+
+	if opts.Highlight != "" {
+		leaf, err := t.getLeafNodeByData(ctx, t.storage, opts.Highlight)
+		if err != nil {
+			t.Error("render getLeafNodeByData err: ", err)
+			return nil, err
+		}
+		if leaf == nil {
+			return nil, fmt.Errorf("%w: %s", ErrLeafNotFound, opts.Highlight)
+		}
+		// 自叶子向上标记路径与兄弟节点
+		no := leaf.LevelNo
+		for level := 0; level <= root.Level; level++ {
+			r.marks[db.NodePos{Level: level, LevelNo: no}] = markPath
+			if level < root.Level {
+				r.marks[db.NodePos{Level: level, LevelNo: no ^ 1}] = markProof
+			}
+			no /= 2
+		}
+	}
+	return r, nil
+}
+
+// children returns the nodes below node, one when node was promoted.
+func (r *rendering) children(node *db.TreeNode) []*db.TreeNode {
+	var children []*db.TreeNode
+	for no := 2 * node.LevelNo; no <= 2*node.LevelNo+1; no++ {
+		if child := r.nodes[db.NodePos{Level: node.Level - 1, LevelNo: no}]; child != nil {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+func (r *rendering) label(node *db.TreeNode, sep string) string {
+	hash := node.Hash
+	if r.opts.HashLength > 0 && len(hash) > r.opts.HashLength {
+		hash = hash[:r.opts.HashLength]
+	}
+	label := fmt.Sprintf("%d:%d%s%s", node.Level, node.LevelNo, sep, hash)
+	if node.Data != "" {
+		label += sep + node.Data
+	}
+	return label
+}
+
+func dotID(level, levelNo int) string {
+	return fmt.Sprintf("\"%d:%d\"", level, levelNo)
+}
+
+func dotQuote(s string) string {
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(s) + "\""
+}
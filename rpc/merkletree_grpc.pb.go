@@ -0,0 +1,372 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: merkletree.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	MerkleTree_CreateTree_FullMethodName   = "/merkletree.v1.MerkleTree/CreateTree"
+	MerkleTree_AppendLeaves_FullMethodName = "/merkletree.v1.MerkleTree/AppendLeaves"
+	MerkleTree_GetRoot_FullMethodName      = "/merkletree.v1.MerkleTree/GetRoot"
+	MerkleTree_GetProof_FullMethodName     = "/merkletree.v1.MerkleTree/GetProof"
+	MerkleTree_VerifyProof_FullMethodName  = "/merkletree.v1.MerkleTree/VerifyProof"
+	MerkleTree_WatchRoots_FullMethodName   = "/merkletree.v1.MerkleTree/WatchRoots"
+)
+
+// MerkleTreeClient is the client API for MerkleTree service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MerkleTreeClient interface {
+	// CreateTree registers a new tree. ALREADY_EXISTS if it exists.
+	CreateTree(ctx context.Context, in *CreateTreeRequest, opts ...grpc.CallOption) (*Tree, error)
+	// AppendLeaves appends the leaves of every message of the stream, each
+	// message as one batch, in order. The first message names the tree.
+	AppendLeaves(ctx context.Context, opts ...grpc.CallOption) (MerkleTree_AppendLeavesClient, error)
+	// GetRoot returns the root hash and leaf count of a tree.
+	GetRoot(ctx context.Context, in *GetRootRequest, opts ...grpc.CallOption) (*Root, error)
+	// GetProof returns the proof of a leaf. NOT_FOUND if it is not in the tree.
+	GetProof(ctx context.Context, in *GetProofRequest, opts ...grpc.CallOption) (*Proof, error)
+	// VerifyProof checks a proof against a root, without any tree.
+	VerifyProof(ctx context.Context, in *VerifyProofRequest, opts ...grpc.CallOption) (*VerifyProofResponse, error)
+	// WatchRoots sends the root of every watched tree, then every change of
+	// it until the call is cancelled.
+	WatchRoots(ctx context.Context, in *WatchRootsRequest, opts ...grpc.CallOption) (MerkleTree_WatchRootsClient, error)
+}
+
+type merkleTreeClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMerkleTreeClient(cc grpc.ClientConnInterface) MerkleTreeClient {
+	return &merkleTreeClient{cc}
+}
+
+func (c *merkleTreeClient) CreateTree(ctx context.Context, in *CreateTreeRequest, opts ...grpc.CallOption) (*Tree, error) {
+	out := new(Tree)
+	err := c.cc.Invoke(ctx, MerkleTree_CreateTree_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *merkleTreeClient) AppendLeaves(ctx context.Context, opts ...grpc.CallOption) (MerkleTree_AppendLeavesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &MerkleTree_ServiceDesc.Streams[0], MerkleTree_AppendLeaves_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &merkleTreeAppendLeavesClient{stream}
+	return x, nil
+}
+
+type MerkleTree_AppendLeavesClient interface {
+	Send(*AppendLeavesRequest) error
+	CloseAndRecv() (*AppendLeavesResponse, error)
+	grpc.ClientStream
+}
+
+type merkleTreeAppendLeavesClient struct {
+	grpc.ClientStream
+}
+
+func (x *merkleTreeAppendLeavesClient) Send(m *AppendLeavesRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *merkleTreeAppendLeavesClient) CloseAndRecv() (*AppendLeavesResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(AppendLeavesResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *merkleTreeClient) GetRoot(ctx context.Context, in *GetRootRequest, opts ...grpc.CallOption) (*Root, error) {
+	out := new(Root)
+	err := c.cc.Invoke(ctx, MerkleTree_GetRoot_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *merkleTreeClient) GetProof(ctx context.Context, in *GetProofRequest, opts ...grpc.CallOption) (*Proof, error) {
+	out := new(Proof)
+	err := c.cc.Invoke(ctx, MerkleTree_GetProof_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *merkleTreeClient) VerifyProof(ctx context.Context, in *VerifyProofRequest, opts ...grpc.CallOption) (*VerifyProofResponse, error) {
+	out := new(VerifyProofResponse)
+	err := c.cc.Invoke(ctx, MerkleTree_VerifyProof_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *merkleTreeClient) WatchRoots(ctx context.Context, in *WatchRootsRequest, opts ...grpc.CallOption) (MerkleTree_WatchRootsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &MerkleTree_ServiceDesc.Streams[1], MerkleTree_WatchRoots_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &merkleTreeWatchRootsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type MerkleTree_WatchRootsClient interface {
+	Recv() (*Root, error)
+	grpc.ClientStream
+}
+
+type merkleTreeWatchRootsClient struct {
+	grpc.ClientStream
+}
+
+func (x *merkleTreeWatchRootsClient) Recv() (*Root, error) {
+	m := new(Root)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// MerkleTreeServer is the server API for MerkleTree service.
+// All implementations must embed UnimplementedMerkleTreeServer
+// for forward compatibility
+type MerkleTreeServer interface {
+	// CreateTree registers a new tree. ALREADY_EXISTS if it exists.
+	CreateTree(context.Context, *CreateTreeRequest) (*Tree, error)
+	// AppendLeaves appends the leaves of every message of the stream, each
+	// message as one batch, in order. The first message names the tree.
+	AppendLeaves(MerkleTree_AppendLeavesServer) error
+	// GetRoot returns the root hash and leaf count of a tree.
+	GetRoot(context.Context, *GetRootRequest) (*Root, error)
+	// GetProof returns the proof of a leaf. NOT_FOUND if it is not in the tree.
+	GetProof(context.Context, *GetProofRequest) (*Proof, error)
+	// VerifyProof checks a proof against a root, without any tree.
+	VerifyProof(context.Context, *VerifyProofRequest) (*VerifyProofResponse, error)
+	// WatchRoots sends the root of every watched tree, then every change of
+	// it until the call is cancelled.
+	WatchRoots(*WatchRootsRequest, MerkleTree_WatchRootsServer) error
+	mustEmbedUnimplementedMerkleTreeServer()
+}
+
+// UnimplementedMerkleTreeServer must be embedded to have forward compatible implementations.
+type UnimplementedMerkleTreeServer struct {
+}
+
+func (UnimplementedMerkleTreeServer) CreateTree(context.Context, *CreateTreeRequest) (*Tree, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateTree not implemented")
+}
+func (UnimplementedMerkleTreeServer) AppendLeaves(MerkleTree_AppendLeavesServer) error {
+	return status.Errorf(codes.Unimplemented, "method AppendLeaves not implemented")
+}
+func (UnimplementedMerkleTreeServer) GetRoot(context.Context, *GetRootRequest) (*Root, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRoot not implemented")
+}
+func (UnimplementedMerkleTreeServer) GetProof(context.Context, *GetProofRequest) (*Proof, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetProof not implemented")
+}
+func (UnimplementedMerkleTreeServer) VerifyProof(context.Context, *VerifyProofRequest) (*VerifyProofResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method VerifyProof not implemented")
+}
+func (UnimplementedMerkleTreeServer) WatchRoots(*WatchRootsRequest, MerkleTree_WatchRootsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchRoots not implemented")
+}
+func (UnimplementedMerkleTreeServer) mustEmbedUnimplementedMerkleTreeServer() {}
+
+// UnsafeMerkleTreeServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MerkleTreeServer will
+// result in compilation errors.
+type UnsafeMerkleTreeServer interface {
+	mustEmbedUnimplementedMerkleTreeServer()
+}
+
+func RegisterMerkleTreeServer(s grpc.ServiceRegistrar, srv MerkleTreeServer) {
+	s.RegisterService(&MerkleTree_ServiceDesc, srv)
+}
+
+func _MerkleTree_CreateTree_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateTreeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MerkleTreeServer).CreateTree(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MerkleTree_CreateTree_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MerkleTreeServer).CreateTree(ctx, req.(*CreateTreeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MerkleTree_AppendLeaves_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MerkleTreeServer).AppendLeaves(&merkleTreeAppendLeavesServer{stream})
+}
+
+type MerkleTree_AppendLeavesServer interface {
+	SendAndClose(*AppendLeavesResponse) error
+	Recv() (*AppendLeavesRequest, error)
+	grpc.ServerStream
+}
+
+type merkleTreeAppendLeavesServer struct {
+	grpc.ServerStream
+}
+
+func (x *merkleTreeAppendLeavesServer) SendAndClose(m *AppendLeavesResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *merkleTreeAppendLeavesServer) Recv() (*AppendLeavesRequest, error) {
+	m := new(AppendLeavesRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _MerkleTree_GetRoot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRootRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MerkleTreeServer).GetRoot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MerkleTree_GetRoot_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MerkleTreeServer).GetRoot(ctx, req.(*GetRootRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MerkleTree_GetProof_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetProofRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MerkleTreeServer).GetProof(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MerkleTree_GetProof_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MerkleTreeServer).GetProof(ctx, req.(*GetProofRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MerkleTree_VerifyProof_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VerifyProofRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MerkleTreeServer).VerifyProof(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MerkleTree_VerifyProof_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MerkleTreeServer).VerifyProof(ctx, req.(*VerifyProofRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MerkleTree_WatchRoots_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRootsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MerkleTreeServer).WatchRoots(m, &merkleTreeWatchRootsServer{stream})
+}
+
+type MerkleTree_WatchRootsServer interface {
+	Send(*Root) error
+	grpc.ServerStream
+}
+
+type merkleTreeWatchRootsServer struct {
+	grpc.ServerStream
+}
+
+func (x *merkleTreeWatchRootsServer) Send(m *Root) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// MerkleTree_ServiceDesc is the grpc.ServiceDesc for MerkleTree service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MerkleTree_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "merkletree.v1.MerkleTree",
+	HandlerType: (*MerkleTreeServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateTree",
+			Handler:    _MerkleTree_CreateTree_Handler,
+		},
+		{
+			MethodName: "GetRoot",
+			Handler:    _MerkleTree_GetRoot_Handler,
+		},
+		{
+			MethodName: "GetProof",
+			Handler:    _MerkleTree_GetProof_Handler,
+		},
+		{
+			MethodName: "VerifyProof",
+			Handler:    _MerkleTree_VerifyProof_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "AppendLeaves",
+			Handler:       _MerkleTree_AppendLeaves_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchRoots",
+			Handler:       _MerkleTree_WatchRoots_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "merkletree.proto",
+}
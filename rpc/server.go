@@ -0,0 +1,298 @@
+// Package rpc serves the trees of a MerkleTreeManager over gRPC. The service
+// is defined in merkletree.proto; NewMerkleTreeClient is its generated client.
+//
+//	s := grpc.NewServer()
+//	rpc.RegisterMerkleTreeServer(s, rpc.NewServer(manager))
+//
+// Calls run with their own context, so an actor set by an interceptor with
+// merkletree.WithActor is recorded in the audit log.
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative merkletree.proto
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"github.com/UXUYLabs/go-merkletree"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"github.com/UXUYLabs/go-merkletree/keccak256"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"strings"
+	"time"
+)
+
+// DefaultPollInterval is how often WatchRoots reads the watched roots.
+const DefaultPollInterval = time.Second
+
+// Server implements MerkleTreeServer on top of a MerkleTreeManager.
+type Server struct {
+	UnimplementedMerkleTreeServer
+
+	manager      *merkletree.MerkleTreeManager
+	pollInterval time.Duration
+}
+
+// ServerOption configures a Server.
+type ServerOption func(*Server)
+
+// WithPollInterval sets how often WatchRoots reads the watched roots,
+// DefaultPollInterval by default. Roots are polled from the storage, so
+// appends made by other processes are seen as well.
+func WithPollInterval(interval time.Duration) ServerOption {
+	return func(s *Server) {
+		s.pollInterval = interval
+	}
+}
+
+// NewServer returns a Server serving the trees of manager.
+func NewServer(manager *merkletree.MerkleTreeManager, opts ...ServerOption) *Server {
+	s := &Server{manager: manager, pollInterval: DefaultPollInterval}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *Server) CreateTree(ctx context.Context, req *CreateTreeRequest) (*Tree, error) {
+	if req.TreeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "tree_id is required")
+	}
+
+	var opts []merkletree.Option
+	if req.Hasher != "" {
+		hasher, err := merkletree.LookupHasher(req.Hasher)
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		opts = append(opts, merkletree.WithHasher(hasher))
+	}
+	if req.LeafSchema != "" {
+		schema, err := merkletree.LookupLeafSchema(req.LeafSchema)
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		opts = append(opts, merkletree.WithLeafSchema(schema))
+	}
+
+	if _, err := s.manager.CreateTreeCtx(ctx, req.TreeId, opts...); err != nil {
+		return nil, toStatus(err)
+	}
+	info, err := s.manager.TreeInfoCtx(ctx, req.TreeId)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &Tree{
+		TreeId:     info.ID,
+		CreatedAt:  timestamppb.New(info.CreatedAt),
+		Hasher:     info.Hasher,
+		LeafSchema: info.LeafSchema,
+		Sealed:     info.Sealed,
+		LeafCount:  int64(info.LeafCount),
+		Root:       info.Root,
+	}, nil
+}
+
+func (s *Server) AppendLeaves(stream MerkleTree_AppendLeavesServer) error {
+	ctx := stream.Context()
+
+	var tree *merkletree.MerkleTree
+	var treeID string
+	var before *Root
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if tree == nil {
+			if req.TreeId == "" {
+				return status.Error(codes.InvalidArgument, "tree_id is required on the first message")
+			}
+			if tree, err = s.manager.OpenTreeCtx(ctx, req.TreeId); err != nil {
+				return toStatus(err)
+			}
+			treeID = req.TreeId
+			// 已在树中的叶子被跳过，追加数以树的增长计
+			if before, err = s.root(ctx, treeID); err != nil {
+				return toStatus(err)
+			}
+		} else if req.TreeId != "" && req.TreeId != treeID {
+			return status.Errorf(codes.InvalidArgument, "tree_id changed from %s to %s", treeID, req.TreeId)
+		}
+
+		if len(req.Leaves) == 0 {
+			continue
+		}
+		// 每条消息作为一批追加，失败时之前的批次保留
+		if err = tree.AppendLeavesCtx(ctx, req.Leaves); err != nil {
+			return toStatus(err)
+		}
+	}
+
+	if tree == nil {
+		return status.Error(codes.InvalidArgument, "tree_id is required on the first message")
+	}
+	root, err := s.root(ctx, treeID)
+	if err != nil {
+		return toStatus(err)
+	}
+	return stream.SendAndClose(&AppendLeavesResponse{Appended: root.LeafCount - before.LeafCount, Root: root})
+}
+
+func (s *Server) GetRoot(ctx context.Context, req *GetRootRequest) (*Root, error) {
+	root, err := s.root(ctx, req.TreeId)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return root, nil
+}
+
+func (s *Server) GetProof(ctx context.Context, req *GetProofRequest) (*Proof, error) {
+	tree, err := s.manager.OpenTreeReadOnlyCtx(ctx, req.TreeId)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	// 证明与根在同一把读锁下读出，并发追加时二者仍然匹配
+	rooted, err := tree.GenerateRootedProofCtx(ctx, req.Leaf)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if rooted == nil {
+		return nil, status.Errorf(codes.NotFound, "leaf %s not in tree %s", req.Leaf, req.TreeId)
+	}
+
+	return &Proof{TreeId: req.TreeId, Leaf: req.Leaf, Index: int64(rooted.Index), Root: rooted.Root.Hash, Proof: rooted.Proof}, nil
+}
+
+func (s *Server) VerifyProof(ctx context.Context, req *VerifyProofRequest) (*VerifyProofResponse, error) {
+	hasher := merkletree.Keccak256Hasher
+	if req.Hasher != "" {
+		var err error
+		if hasher, err = merkletree.LookupHasher(req.Hasher); err != nil {
+			return nil, toStatus(err)
+		}
+	}
+	schema := merkletree.AddressSchema
+	if req.LeafSchema != "" {
+		var err error
+		if schema, err = merkletree.LookupLeafSchema(req.LeafSchema); err != nil {
+			return nil, toStatus(err)
+		}
+	}
+	if err := merkletree.ValidateLeaf(schema, req.Leaf); err != nil {
+		return nil, toStatus(err)
+	}
+
+	root, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(req.Root, "0x"), "0X"))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "root: %v", err)
+	}
+
+	valid := merkletree.VerifyProofRoot(hasher, keccak256.Bytes2Hex(root), req.Proof, req.Leaf)
+	return &VerifyProofResponse{Valid: valid}, nil
+}
+
+func (s *Server) WatchRoots(req *WatchRootsRequest, stream MerkleTree_WatchRootsServer) error {
+	ctx := stream.Context()
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	sent := make(map[string]*Root)
+	for first := true; ; first = false {
+		roots, err := s.watched(ctx, req.TreeIds, first)
+		if err != nil {
+			return toStatus(err)
+		}
+		for _, root := range roots {
+			last := sent[root.TreeId]
+			if last != nil && last.Root == root.Root && last.LeafCount == root.LeafCount {
+				continue
+			}
+			if err = stream.Send(root); err != nil {
+				return err
+			}
+			sent[root.TreeId] = root
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// watched reads the roots of the trees in ids, or of every registered tree
+// when ids is empty. A watched tree which disappears ends the watch, except
+// on the first read where it is reported as not found.
+func (s *Server) watched(ctx context.Context, ids []string, first bool) ([]*Root, error) {
+	if len(ids) == 0 {
+		infos, err := s.manager.ListTreesCtx(ctx)
+		if err != nil {
+			return nil, err
+		}
+		roots := make([]*Root, 0, len(infos))
+		for _, info := range infos {
+			roots = append(roots, &Root{TreeId: info.ID, Root: info.Root, LeafCount: int64(info.LeafCount)})
+		}
+		return roots, nil
+	}
+
+	roots := make([]*Root, 0, len(ids))
+	for _, id := range ids {
+		root, err := s.root(ctx, id)
+		if err != nil {
+			if !first && errors.Is(err, merkletree.ErrTreeNotFound) {
+				return nil, status.Errorf(codes.NotFound, "tree %s was deleted", id)
+			}
+			return nil, err
+		}
+		roots = append(roots, root)
+	}
+	return roots, nil
+}
+
+func (s *Server) root(ctx context.Context, id string) (*Root, error) {
+	info, err := s.manager.TreeInfoCtx(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &Root{TreeId: id, Root: info.Root, LeafCount: int64(info.LeafCount)}, nil
+}
+
+// toStatus converts err to the gRPC status its cause calls for.
+func toStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	code := codes.Internal
+	switch {
+	case errors.Is(err, merkletree.ErrTreeNotFound), errors.Is(err, db.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, merkletree.ErrTreeExists):
+		code = codes.AlreadyExists
+	case errors.Is(err, merkletree.ErrTreeSealed):
+		code = codes.FailedPrecondition
+	case errors.Is(err, merkletree.ErrInvalidLeaf), errors.Is(err, merkletree.ErrUnknownHasher),
+		errors.Is(err, merkletree.ErrUnknownLeafSchema):
+		code = codes.InvalidArgument
+	case errors.Is(err, db.ErrFenced), errors.Is(err, db.ErrLockLost):
+		code = codes.Aborted
+	case errors.Is(err, db.ErrNotSupported):
+		code = codes.Unimplemented
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,233 @@
+package rpc
+
+import (
+	"context"
+	"github.com/UXUYLabs/go-merkletree"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"github.com/UXUYLabs/go-merkletree/db/memory"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+	"time"
+)
+
+var leaves = []string{
+	"0x8b1b201E91966957f18bBcDDB520c53c521bF5cd",
+	"0xeA726629EC5fe5cE300000d1a8c89B3054A22cE7",
+	"0x9965507D1a55bcC2695C58ba16FB37d819B0A4dc",
+}
+
+func newClient(t *testing.T) (*merkletree.MerkleTreeManager, MerkleTreeClient) {
+	return newStorageClient(t, memory.NewMemoryStorage())
+}
+
+func newStorageClient(t *testing.T, storage db.Storage) (*merkletree.MerkleTreeManager, MerkleTreeClient) {
+	manager, err := merkletree.NewMerkleTreeManager(context.Background(), storage, merkletree.WithLogger(merkletree.DiscardLogger))
+	if err != nil {
+		t.Fatal("NewMerkleTreeManager err: ", err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	RegisterMerkleTreeServer(s, NewServer(manager, WithPollInterval(10*time.Millisecond)))
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial("bufnet", grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal("Dial err: ", err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return manager, NewMerkleTreeClient(conn)
+}
+
+func TestRPCTreeAndProof(t *testing.T) {
+	ctx := context.Background()
+	manager, client := newClient(t)
+
+	tree, err := client.CreateTree(ctx, &CreateTreeRequest{TreeId: "1"})
+	if err != nil {
+		t.Fatal("CreateTree err: ", err)
+	}
+	assert.Equal(t, merkletree.Keccak256Hasher.Name(), tree.Hasher)
+	_, err = client.CreateTree(ctx, &CreateTreeRequest{TreeId: "1"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	_, err = client.CreateTree(ctx, &CreateTreeRequest{TreeId: "2", LeafSchema: "nope"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// 流式追加，每条消息为一批
+	stream, err := client.AppendLeaves(ctx)
+	if err != nil {
+		t.Fatal("AppendLeaves err: ", err)
+	}
+	assert.Nil(t, stream.Send(&AppendLeavesRequest{TreeId: "1", Leaves: leaves[:1]}))
+	assert.Nil(t, stream.Send(&AppendLeavesRequest{Leaves: leaves[1:]}))
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal("CloseAndRecv err: ", err)
+	}
+	assert.Equal(t, int64(3), resp.Appended)
+	assert.Equal(t, int64(3), resp.Root.LeafCount)
+
+	info, err := manager.TreeInfo("1")
+	if err != nil {
+		t.Fatal("TreeInfo err: ", err)
+	}
+	root, err := client.GetRoot(ctx, &GetRootRequest{TreeId: "1"})
+	if err != nil {
+		t.Fatal("GetRoot err: ", err)
+	}
+	assert.Equal(t, info.Root, root.Root)
+	_, err = client.GetRoot(ctx, &GetRootRequest{TreeId: "3"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	stream, err = client.AppendLeaves(ctx)
+	if err != nil {
+		t.Fatal("AppendLeaves err: ", err)
+	}
+	assert.Nil(t, stream.Send(&AppendLeavesRequest{TreeId: "1", Leaves: []string{"0x1"}}))
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// 已在树中的叶子被跳过，不计入追加数
+	stream, err = client.AppendLeaves(ctx)
+	if err != nil {
+		t.Fatal("AppendLeaves err: ", err)
+	}
+	assert.Nil(t, stream.Send(&AppendLeavesRequest{TreeId: "1", Leaves: []string{leaves[0], "0x00440DC3377A8a6b745aB5F92fD850b7c7291DdE"}}))
+	resp, err = stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal("CloseAndRecv err: ", err)
+	}
+	assert.Equal(t, int64(1), resp.Appended)
+	assert.Equal(t, int64(4), resp.Root.LeafCount)
+	info, err = manager.TreeInfo("1")
+	if err != nil {
+		t.Fatal("TreeInfo err: ", err)
+	}
+
+	proof, err := client.GetProof(ctx, &GetProofRequest{TreeId: "1", Leaf: leaves[1]})
+	if err != nil {
+		t.Fatal("GetProof err: ", err)
+	}
+	assert.Equal(t, int64(1), proof.Index)
+	assert.Equal(t, info.Root, proof.Root)
+	_, err = client.GetProof(ctx, &GetProofRequest{TreeId: "1", Leaf: "0x0000000000000000000000000000000000000001"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	valid, err := client.VerifyProof(ctx, &VerifyProofRequest{Root: "0x" + proof.Root, Leaf: leaves[1], Proof: proof.Proof})
+	if err != nil {
+		t.Fatal("VerifyProof err: ", err)
+	}
+	assert.True(t, valid.Valid)
+	valid, err = client.VerifyProof(ctx, &VerifyProofRequest{Root: proof.Root, Leaf: leaves[2], Proof: proof.Proof})
+	if err != nil {
+		t.Fatal("VerifyProof err: ", err)
+	}
+	assert.False(t, valid.Valid)
+	_, err = client.VerifyProof(ctx, &VerifyProofRequest{Root: "zz", Leaf: leaves[1]})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.VerifyProof(ctx, &VerifyProofRequest{Root: proof.Root, Leaf: "0x5AAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", LeafSchema: "address-checksum"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestRPCWatchRoots(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	manager, client := newClient(t)
+
+	tree, err := manager.CreateTree("1")
+	if err != nil {
+		t.Fatal("CreateTree err: ", err)
+	}
+
+	watch, err := client.WatchRoots(ctx, &WatchRootsRequest{TreeIds: []string{"1"}})
+	if err != nil {
+		t.Fatal("WatchRoots err: ", err)
+	}
+	root, err := watch.Recv()
+	if err != nil {
+		t.Fatal("Recv err: ", err)
+	}
+	assert.Equal(t, int64(0), root.LeafCount)
+
+	for i, leaf := range leaves {
+		if err = tree.AppendLeaf(leaf); err != nil {
+			t.Fatal("AppendLeaf err: ", err)
+		}
+		// 轮询之间的多次变化可能合并，等到看见本次的叶子数
+		for root.LeafCount < int64(i+1) {
+			if root, err = watch.Recv(); err != nil {
+				t.Fatal("Recv err: ", err)
+			}
+		}
+		info, err := manager.TreeInfo("1")
+		if err != nil {
+			t.Fatal("TreeInfo err: ", err)
+		}
+		assert.Equal(t, info.Root, root.Root)
+	}
+
+	if err = manager.DeleteTree("1"); err != nil {
+		t.Fatal("DeleteTree err: ", err)
+	}
+	_, err = watch.Recv()
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	watch, err = client.WatchRoots(ctx, &WatchRootsRequest{TreeIds: []string{"2"}})
+	if err != nil {
+		t.Fatal("WatchRoots err: ", err)
+	}
+	_, err = watch.Recv()
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestRPCReadOnly(t *testing.T) {
+	ctx := context.Background()
+	manager, client := newClient(t)
+
+	// 登记前创建的树，读请求不登记也不写入
+	tree, err := manager.CreateMerkleTree("1")
+	if err != nil {
+		t.Fatal("CreateMerkleTree err: ", err)
+	}
+	if err = tree.AppendLeaves(leaves); err != nil {
+		t.Fatal("AppendLeaves err: ", err)
+	}
+	proof, err := client.GetProof(ctx, &GetProofRequest{TreeId: "1", Leaf: leaves[1]})
+	if err != nil {
+		t.Fatal("GetProof err: ", err)
+	}
+	assert.Equal(t, int64(1), proof.Index)
+	root, err := client.GetRoot(ctx, &GetRootRequest{TreeId: "1"})
+	if err != nil {
+		t.Fatal("GetRoot err: ", err)
+	}
+	assert.Equal(t, root.Root, proof.Root)
+	_, err = client.GetProof(ctx, &GetProofRequest{TreeId: "2", Leaf: leaves[1]})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	infos, err := manager.ListTrees()
+	if err != nil {
+		t.Fatal("ListTrees err: ", err)
+	}
+	assert.Empty(t, infos)
+}
+
+func TestRPCNotSupported(t *testing.T) {
+	_, client := newStorageClient(t, struct{ db.Storage }{memory.NewMemoryStorage()})
+
+	_, err := client.CreateTree(context.Background(), &CreateTreeRequest{TreeId: "1"})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
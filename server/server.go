@@ -0,0 +1,423 @@
+// Package server serves the trees of a MerkleTreeManager over HTTP with JSON
+// bodies. Handler is a plain http.Handler, mount it under a prefix with
+// http.StripPrefix:
+//
+//	mux.Handle("/merkle/", http.StripPrefix("/merkle", server.New(manager)))
+//
+// Endpoints, relative to the mount point:
+//
+//	POST /trees                      create a tree {"id", "hasher", "leafSchema"}
+//	GET  /trees                      list the trees
+//	GET  /trees/{id}                 describe a tree
+//	GET  /trees/{id}/root            root hash and leaf count
+//	POST /trees/{id}/leaves          append {"leaf"} or {"leaves": [...]}
+//	GET  /trees/{id}/leaves/{leaf}   membership of a leaf and its index
+//	GET  /trees/{id}/proof?leaf=     proof of a leaf
+//	POST /verify                     check {"root", "leaf", "proof"} without any tree
+//
+// Hashes and proof elements are hex encoded as keccak256.Bytes2Hex does,
+// without 0x prefix; a prefix is accepted on input. Errors are returned as
+// {"error": "..."}. Requests run with their own context, so an actor set by
+// a middleware with merkletree.WithActor is recorded in the audit log.
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"github.com/UXUYLabs/go-merkletree/keccak256"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// MaxBodySize is the largest request body accepted, in bytes.
+const MaxBodySize = 32 << 20
+
+// Handler is the http.Handler of the server.
+type Handler struct {
+	manager *merkletree.MerkleTreeManager
+}
+
+// New returns a Handler serving the trees of manager.
+func New(manager *merkletree.MerkleTreeManager) *Handler {
+	return &Handler{manager: manager}
+}
+
+// TreeResponse describes a tree.
+type TreeResponse struct {
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Hasher     string    `json:"hasher"`
+	LeafSchema string    `json:"leafSchema"`
+	Sealed     bool      `json:"sealed"`
+	LeafCount  int       `json:"leafCount"`
+	Root       string    `json:"root"`
+}
+
+// CreateTreeRequest is the body of POST /trees. Hasher and LeafSchema are
+// registered names, the manager's defaults when empty.
+type CreateTreeRequest struct {
+	ID         string `json:"id"`
+	Hasher     string `json:"hasher,omitempty"`
+	LeafSchema string `json:"leafSchema,omitempty"`
+}
+
+// RootResponse is the body returned by GET /trees/{id}/root and by appends.
+type RootResponse struct {
+	Root      string `json:"root"`
+	LeafCount int    `json:"leafCount"`
+}
+
+// AppendRequest is the body of POST /trees/{id}/leaves, with either Leaf or Leaves set.
+type AppendRequest struct {
+	Leaf   string   `json:"leaf,omitempty"`
+	Leaves []string `json:"leaves,omitempty"`
+}
+
+// MembershipResponse is the body returned by GET /trees/{id}/leaves/{leaf}.
+// Index is -1 when Member is false.
+type MembershipResponse struct {
+	Leaf   string `json:"leaf"`
+	Member bool   `json:"member"`
+	Index  int    `json:"index"`
+}
+
+// ProofResponse is the body returned by GET /trees/{id}/proof.
+type ProofResponse struct {
+	Leaf  string   `json:"leaf"`
+	Index int      `json:"index"`
+	Root  string   `json:"root"`
+	Proof []string `json:"proof"`
+}
+
+// VerifyRequest is the body of POST /verify. Hasher and LeafSchema are
+// registered names, keccak256 and address when empty.
+type VerifyRequest struct {
+	Root       string   `json:"root"`
+	Leaf       string   `json:"leaf"`
+	Proof      []string `json:"proof"`
+	Hasher     string   `json:"hasher,omitempty"`
+	LeafSchema string   `json:"leafSchema,omitempty"`
+}
+
+// VerifyResponse is the body returned by POST /verify.
+type VerifyResponse struct {
+	Valid bool `json:"valid"`
+}
+
+// ErrorResponse is the body returned with every error status.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// errBadRequest marks errors caused by the request itself.
+var errBadRequest = errors.New("bad request")
+
+var errNotMember = errors.New("leaf not in tree")
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	var err error
+	switch {
+	case len(parts) == 1 && parts[0] == "verify":
+		err = h.route(w, r, http.MethodPost, h.verify)
+	case len(parts) == 1 && parts[0] == "trees":
+		if r.Method == http.MethodGet {
+			err = h.listTrees(w, r)
+		} else {
+			err = h.route(w, r, http.MethodPost, h.createTree)
+		}
+	case len(parts) >= 2 && parts[0] == "trees" && parts[1] != "":
+		err = h.serveTree(w, r, parts[1], parts[2:])
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err)
+	}
+}
+
+func (h *Handler) serveTree(w http.ResponseWriter, r *http.Request, id string, parts []string) error {
+	switch {
+	case len(parts) == 0:
+		return h.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) error {
+			return h.getTree(w, r, id)
+		})
+	case len(parts) == 1 && parts[0] == "root":
+		return h.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) error {
+			return h.getRoot(w, r, id)
+		})
+	case len(parts) == 1 && parts[0] == "leaves":
+		return h.route(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) error {
+			return h.appendLeaves(w, r, id)
+		})
+	case len(parts) == 2 && parts[0] == "leaves":
+		return h.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) error {
+			return h.membership(w, r, id, parts[1])
+		})
+	case len(parts) == 1 && parts[0] == "proof":
+		return h.route(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) error {
+			return h.proof(w, r, id, r.URL.Query().Get("leaf"))
+		})
+	default:
+		http.NotFound(w, r)
+		return nil
+	}
+}
+
+// route calls fn for requests with method, and answers 405 to the others.
+func (h *Handler) route(w http.ResponseWriter, r *http.Request, method string, fn func(w http.ResponseWriter, r *http.Request) error) error {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeJSON(w, http.StatusMethodNotAllowed, &ErrorResponse{Error: "method not allowed"})
+		return nil
+	}
+	return fn(w, r)
+}
+
+func (h *Handler) createTree(w http.ResponseWriter, r *http.Request) error {
+	var req CreateTreeRequest
+	if err := readJSON(w, r, &req); err != nil {
+		return err
+	}
+	if req.ID == "" {
+		return fmt.Errorf("%w: id is required", errBadRequest)
+	}
+
+	var opts []merkletree.Option
+	if req.Hasher != "" {
+		hasher, err := merkletree.LookupHasher(req.Hasher)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, merkletree.WithHasher(hasher))
+	}
+	if req.LeafSchema != "" {
+		schema, err := merkletree.LookupLeafSchema(req.LeafSchema)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, merkletree.WithLeafSchema(schema))
+	}
+
+	if _, err := h.manager.CreateTreeCtx(r.Context(), req.ID, opts...); err != nil {
+		return err
+	}
+	info, err := h.manager.TreeInfoCtx(r.Context(), req.ID)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusCreated, treeResponse(info))
+	return nil
+}
+
+func (h *Handler) listTrees(w http.ResponseWriter, r *http.Request) error {
+	infos, err := h.manager.ListTreesCtx(r.Context())
+	if err != nil {
+		return err
+	}
+
+	retsz := make([]*TreeResponse, 0, len(infos))
+	for _, info := range infos {
+		retsz = append(retsz, treeResponse(info))
+	}
+	writeJSON(w, http.StatusOK, retsz)
+	return nil
+}
+
+func (h *Handler) getTree(w http.ResponseWriter, r *http.Request, id string) error {
+	info, err := h.manager.TreeInfoCtx(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, treeResponse(info))
+	return nil
+}
+
+func (h *Handler) getRoot(w http.ResponseWriter, r *http.Request, id string) error {
+	root, err := h.root(r, id)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, root)
+	return nil
+}
+
+func (h *Handler) appendLeaves(w http.ResponseWriter, r *http.Request, id string) error {
+	var req AppendRequest
+	if err := readJSON(w, r, &req); err != nil {
+		return err
+	}
+	leaves := req.Leaves
+	if req.Leaf != "" {
+		leaves = append([]string{req.Leaf}, leaves...)
+	}
+	if len(leaves) == 0 {
+		return fmt.Errorf("%w: leaf or leaves is required", errBadRequest)
+	}
+
+	tree, err := h.manager.OpenTreeCtx(r.Context(), id)
+	if err != nil {
+		return err
+	}
+	if err = tree.AppendLeavesCtx(r.Context(), leaves); err != nil {
+		return err
+	}
+
+	root, err := h.root(r, id)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, root)
+	return nil
+}
+
+func (h *Handler) membership(w http.ResponseWriter, r *http.Request, id string, leaf string) error {
+	tree, err := h.manager.OpenTreeReadOnlyCtx(r.Context(), id)
+	if err != nil {
+		return err
+	}
+	index, err := tree.LeafIndexCtx(r.Context(), leaf)
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, &MembershipResponse{Leaf: leaf, Member: index >= 0, Index: index})
+	return nil
+}
+
+func (h *Handler) proof(w http.ResponseWriter, r *http.Request, id string, leaf string) error {
+	if leaf == "" {
+		return fmt.Errorf("%w: leaf is required", errBadRequest)
+	}
+
+	tree, err := h.manager.OpenTreeReadOnlyCtx(r.Context(), id)
+	if err != nil {
+		return err
+	}
+	// 证明与根在同一把读锁下读出，并发追加时二者仍然匹配
+	rooted, err := tree.GenerateRootedProofCtx(r.Context(), leaf)
+	if err != nil {
+		return err
+	}
+	if rooted == nil {
+		return errNotMember
+	}
+
+	resp := &ProofResponse{Leaf: leaf, Index: rooted.Index, Root: rooted.Root.Hash, Proof: make([]string, 0, len(rooted.Proof))}
+	for _, proof := range rooted.Proof {
+		resp.Proof = append(resp.Proof, keccak256.Bytes2Hex(proof))
+	}
+	writeJSON(w, http.StatusOK, resp)
+	return nil
+}
+
+func (h *Handler) verify(w http.ResponseWriter, r *http.Request) error {
+	var req VerifyRequest
+	if err := readJSON(w, r, &req); err != nil {
+		return err
+	}
+
+	hasher := merkletree.Keccak256Hasher
+	if req.Hasher != "" {
+		var err error
+		if hasher, err = merkletree.LookupHasher(req.Hasher); err != nil {
+			return err
+		}
+	}
+	schema := merkletree.AddressSchema
+	if req.LeafSchema != "" {
+		var err error
+		if schema, err = merkletree.LookupLeafSchema(req.LeafSchema); err != nil {
+			return err
+		}
+	}
+	if err := merkletree.ValidateLeaf(schema, req.Leaf); err != nil {
+		return err
+	}
+
+	root, err := decodeHex(req.Root)
+	if err != nil {
+		return fmt.Errorf("%w: root: %v", errBadRequest, err)
+	}
+	proofs := make([][]byte, 0, len(req.Proof))
+	for i, element := range req.Proof {
+		proof, err := decodeHex(element)
+		if err != nil {
+			return fmt.Errorf("%w: proof %d: %v", errBadRequest, i, err)
+		}
+		proofs = append(proofs, proof)
+	}
+
+	valid := merkletree.VerifyProofRoot(hasher, keccak256.Bytes2Hex(root), proofs, req.Leaf)
+	writeJSON(w, http.StatusOK, &VerifyResponse{Valid: valid})
+	return nil
+}
+
+func (h *Handler) root(r *http.Request, id string) (*RootResponse, error) {
+	info, err := h.manager.TreeInfoCtx(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	return &RootResponse{Root: info.Root, LeafCount: info.LeafCount}, nil
+}
+
+func treeResponse(info *merkletree.TreeInfo) *TreeResponse {
+	return &TreeResponse{
+		ID:         info.ID,
+		CreatedAt:  info.CreatedAt,
+		Hasher:     info.Hasher,
+		LeafSchema: info.LeafSchema,
+		Sealed:     info.Sealed,
+		LeafCount:  info.LeafCount,
+		Root:       info.Root,
+	}
+}
+
+func decodeHex(s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	return hex.DecodeString(s)
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers err with the status its cause calls for.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errBadRequest), errors.Is(err, merkletree.ErrInvalidLeaf),
+		errors.Is(err, merkletree.ErrUnknownHasher), errors.Is(err, merkletree.ErrUnknownLeafSchema):
+		status = http.StatusBadRequest
+	case errors.Is(err, merkletree.ErrTreeNotFound), errors.Is(err, errNotMember), errors.Is(err, db.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, merkletree.ErrTreeExists), errors.Is(err, merkletree.ErrTreeSealed):
+		status = http.StatusConflict
+	case errors.Is(err, db.ErrNotSupported):
+		status = http.StatusNotImplemented
+	}
+
+	writeJSON(w, status, &ErrorResponse{Error: err.Error()})
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/UXUYLabs/go-merkletree"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"github.com/UXUYLabs/go-merkletree/db/memory"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var leaves = []string{
+	"0x8b1b201E91966957f18bBcDDB520c53c521bF5cd",
+	"0xeA726629EC5fe5cE300000d1a8c89B3054A22cE7",
+	"0x9965507D1a55bcC2695C58ba16FB37d819B0A4dc",
+}
+
+func newServer(t *testing.T) (*merkletree.MerkleTreeManager, *httptest.Server) {
+	return newStorageServer(t, memory.NewMemoryStorage())
+}
+
+func newStorageServer(t *testing.T, storage db.Storage) (*merkletree.MerkleTreeManager, *httptest.Server) {
+	manager, err := merkletree.NewMerkleTreeManager(context.Background(), storage, merkletree.WithLogger(merkletree.DiscardLogger))
+	if err != nil {
+		t.Fatal("NewMerkleTreeManager err: ", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/merkle/", http.StripPrefix("/merkle", New(manager)))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return manager, srv
+}
+
+func call(t *testing.T, srv *httptest.Server, method string, path string, body interface{}, out interface{}) int {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal("Encode err: ", err)
+		}
+	}
+	req, err := http.NewRequest(method, srv.URL+"/merkle"+path, &buf)
+	if err != nil {
+		t.Fatal("NewRequest err: ", err)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal("Do err: ", err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatal("Decode err: ", err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestServerTreeLifecycle(t *testing.T) {
+	manager, srv := newServer(t)
+
+	var tree TreeResponse
+	assert.Equal(t, http.StatusCreated, call(t, srv, http.MethodPost, "/trees", &CreateTreeRequest{ID: "1"}, &tree))
+	assert.Equal(t, "1", tree.ID)
+	assert.Equal(t, merkletree.Keccak256Hasher.Name(), tree.Hasher)
+
+	var errResp ErrorResponse
+	assert.Equal(t, http.StatusConflict, call(t, srv, http.MethodPost, "/trees", &CreateTreeRequest{ID: "1"}, &errResp))
+	assert.NotEmpty(t, errResp.Error)
+	assert.Equal(t, http.StatusBadRequest, call(t, srv, http.MethodPost, "/trees", &CreateTreeRequest{ID: "2", Hasher: "nope"}, &errResp))
+	assert.Equal(t, http.StatusNotFound, call(t, srv, http.MethodGet, "/trees/3/root", nil, &errResp))
+	assert.Equal(t, http.StatusMethodNotAllowed, call(t, srv, http.MethodDelete, "/trees/1", nil, &errResp))
+
+	// 单个与批量追加
+	var root RootResponse
+	assert.Equal(t, http.StatusOK, call(t, srv, http.MethodPost, "/trees/1/leaves", &AppendRequest{Leaf: leaves[0]}, &root))
+	assert.Equal(t, 1, root.LeafCount)
+	assert.Equal(t, http.StatusOK, call(t, srv, http.MethodPost, "/trees/1/leaves", &AppendRequest{Leaves: leaves[1:]}, &root))
+	assert.Equal(t, 3, root.LeafCount)
+	assert.Equal(t, http.StatusBadRequest, call(t, srv, http.MethodPost, "/trees/1/leaves", &AppendRequest{Leaf: "0x1"}, &errResp))
+
+	expected, err := manager.TreeInfo("1")
+	if err != nil {
+		t.Fatal("TreeInfo err: ", err)
+	}
+	assert.Equal(t, expected.Root, root.Root)
+	assert.Equal(t, http.StatusOK, call(t, srv, http.MethodGet, "/trees/1/root", nil, &root))
+	assert.Equal(t, expected.Root, root.Root)
+
+	var trees []*TreeResponse
+	assert.Equal(t, http.StatusOK, call(t, srv, http.MethodGet, "/trees", nil, &trees))
+	assert.Len(t, trees, 1)
+	assert.Equal(t, 3, trees[0].LeafCount)
+
+	var member MembershipResponse
+	assert.Equal(t, http.StatusOK, call(t, srv, http.MethodGet, "/trees/1/leaves/"+leaves[2], nil, &member))
+	assert.True(t, member.Member)
+	assert.Equal(t, 2, member.Index)
+	assert.Equal(t, http.StatusOK, call(t, srv, http.MethodGet, "/trees/1/leaves/0x0000000000000000000000000000000000000001", nil, &member))
+	assert.False(t, member.Member)
+	assert.Equal(t, -1, member.Index)
+}
+
+func TestServerProof(t *testing.T) {
+	manager, srv := newServer(t)
+
+	tree, err := manager.CreateTree("1")
+	if err != nil {
+		t.Fatal("CreateTree err: ", err)
+	}
+	if err = tree.AppendLeaves(leaves); err != nil {
+		t.Fatal("AppendLeaves err: ", err)
+	}
+
+	var proof ProofResponse
+	assert.Equal(t, http.StatusOK, call(t, srv, http.MethodGet, "/trees/1/proof?leaf="+leaves[1], nil, &proof))
+	assert.Equal(t, 1, proof.Index)
+	assert.NotEmpty(t, proof.Proof)
+
+	var errResp ErrorResponse
+	assert.Equal(t, http.StatusNotFound, call(t, srv, http.MethodGet, "/trees/1/proof?leaf=0x0000000000000000000000000000000000000001", nil, &errResp))
+
+	// 无状态校验，0x 前缀可有可无
+	var verify VerifyResponse
+	req := &VerifyRequest{Root: "0x" + proof.Root, Leaf: leaves[1], Proof: proof.Proof}
+	assert.Equal(t, http.StatusOK, call(t, srv, http.MethodPost, "/verify", req, &verify))
+	assert.True(t, verify.Valid)
+
+	req.Leaf = leaves[0]
+	assert.Equal(t, http.StatusOK, call(t, srv, http.MethodPost, "/verify", req, &verify))
+	assert.False(t, verify.Valid)
+
+	req.Proof = []string{"zz"}
+	assert.Equal(t, http.StatusBadRequest, call(t, srv, http.MethodPost, "/verify", req, &errResp))
+
+	// 校验和错误同样是请求错误
+	req = &VerifyRequest{Root: proof.Root, Leaf: "0x5AAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", LeafSchema: "address-checksum"}
+	assert.Equal(t, http.StatusBadRequest, call(t, srv, http.MethodPost, "/verify", req, &errResp))
+}
+
+func TestServerReadOnly(t *testing.T) {
+	manager, srv := newServer(t)
+
+	// 登记前创建的树，读请求不登记也不写入
+	tree, err := manager.CreateMerkleTree("1")
+	if err != nil {
+		t.Fatal("CreateMerkleTree err: ", err)
+	}
+	if err = tree.AppendLeaves(leaves); err != nil {
+		t.Fatal("AppendLeaves err: ", err)
+	}
+
+	var root RootResponse
+	assert.Equal(t, http.StatusOK, call(t, srv, http.MethodGet, "/trees/1/root", nil, &root))
+	assert.Equal(t, 3, root.LeafCount)
+	var proof ProofResponse
+	assert.Equal(t, http.StatusOK, call(t, srv, http.MethodGet, "/trees/1/proof?leaf="+leaves[1], nil, &proof))
+	assert.Equal(t, root.Root, proof.Root)
+	var member MembershipResponse
+	assert.Equal(t, http.StatusOK, call(t, srv, http.MethodGet, "/trees/1/leaves/"+leaves[2], nil, &member))
+	assert.True(t, member.Member)
+	infos, err := manager.ListTrees()
+	assert.Nil(t, err)
+	assert.Empty(t, infos)
+
+	var errResp ErrorResponse
+	assert.Equal(t, http.StatusNotFound, call(t, srv, http.MethodGet, "/trees/2/proof?leaf="+leaves[1], nil, &errResp))
+	assert.Equal(t, http.StatusNotFound, call(t, srv, http.MethodGet, "/trees/2/leaves/"+leaves[1], nil, &errResp))
+	infos, err = manager.ListTrees()
+	assert.Nil(t, err)
+	assert.Empty(t, infos)
+}
+
+func TestServerNotSupported(t *testing.T) {
+	_, srv := newStorageServer(t, struct{ db.Storage }{memory.NewMemoryStorage()})
+
+	var errResp ErrorResponse
+	assert.Equal(t, http.StatusNotImplemented, call(t, srv, http.MethodPost, "/trees", &CreateTreeRequest{ID: "1"}, &errResp))
+	assert.Equal(t, http.StatusNotImplemented, call(t, srv, http.MethodGet, "/trees", nil, &errResp))
+}
@@ -0,0 +1,91 @@
+// Package tracing records OpenTelemetry spans of the operations of merkle
+// trees and of the storage calls they make, so the time of a slow operation
+// is split between its storage calls and the hashing in between.
+//
+// A Tracer is a merkletree.Observer, given to trees or managers with
+// merkletree.WithObserver, and wraps storages with Storage. Storage spans are
+// children of the span of the operation making the call.
+package tracing
+
+import (
+	"context"
+	"github.com/UXUYLabs/go-merkletree"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"github.com/UXUYLabs/go-merkletree/db/instrumented"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the instrumentation name spans are recorded under.
+const TracerName = "github.com/UXUYLabs/go-merkletree"
+
+// Attributes of the spans.
+const (
+	// TreeKey is the address of the tree
+	TreeKey = attribute.Key("merkletree.tree")
+	// LeafIndexKey is the index of the leaf appended, proved or looked up
+	LeafIndexKey = attribute.Key("merkletree.leaf_index")
+	// LevelsKey is the number of levels of the tree the operation went through
+	LevelsKey = attribute.Key("merkletree.levels")
+	// BackendKey names the storage of a storage span
+	BackendKey = attribute.Key("merkletree.storage.backend")
+	// NodesKey is the number of nodes a storage call read or wrote
+	NodesKey = attribute.Key("merkletree.storage.nodes")
+)
+
+// Tracer records the spans of the trees and storages it observes.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// New returns a Tracer recording spans with provider, e.g.
+// otel.GetTracerProvider().
+func New(provider trace.TracerProvider) *Tracer {
+	return &Tracer{tracer: provider.Tracer(TracerName)}
+}
+
+// StartOperation implements merkletree.Observer. The span of an operation is
+// named after it, e.g. merkletree.proof.
+func (t *Tracer) StartOperation(ctx context.Context, info *merkletree.OperationInfo) (context.Context, func(err error)) {
+	ctx, span := t.tracer.Start(ctx, "merkletree."+string(info.Op), trace.WithAttributes(TreeKey.String(info.MtAddress)))
+	return ctx, func(err error) {
+		if info.LeafIndex >= 0 {
+			span.SetAttributes(LeafIndexKey.Int(info.LeafIndex))
+		}
+		if info.Levels > 0 {
+			span.SetAttributes(LevelsKey.Int(info.Levels))
+		}
+		end(span, err)
+	}
+}
+
+// Storage wraps storage so each of its calls is recorded as a client span,
+// e.g. merkletree.storage.FindRootNode, labelled with backend, e.g. "redis".
+// It works with any db.Storage implementation and keeps its optional
+// capabilities, see instrumented.Storage.
+func (t *Tracer) Storage(backend string, storage db.Storage) *instrumented.Storage {
+	return instrumented.NewStorage(storage, func(ctx context.Context, call *instrumented.Call) (context.Context, func(error)) {
+		attrs := []attribute.KeyValue{BackendKey.String(backend)}
+		if call.Address != "" {
+			attrs = append(attrs, TreeKey.String(call.Address))
+		}
+		ctx, span := t.tracer.Start(ctx, "merkletree.storage."+call.Method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+		return ctx, func(err error) {
+			span.SetAttributes(NodesKey.Int(call.Nodes))
+			// 未找到是正常结果，不记为错误
+			if err == db.ErrNotFound {
+				err = nil
+			}
+			end(span, err)
+		}
+	})
+}
+
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,110 @@
+package tracing
+
+import (
+	"context"
+	"github.com/UXUYLabs/go-merkletree"
+	"github.com/UXUYLabs/go-merkletree/db/memory"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func attr(span tracetest.SpanStub, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := New(provider)
+
+	storage := tracer.Storage("memory", memory.NewMemoryStorage())
+	manager, err := merkletree.NewMerkleTreeManager(context.Background(), storage, merkletree.WithLogger(merkletree.DiscardLogger), merkletree.WithObserver(tracer))
+	if err != nil {
+		t.Fatal("NewMerkleTreeManager err: ", err)
+	}
+	tree, err := manager.CreateTree("1637704523306766336")
+	if err != nil {
+		t.Fatal("CreateTree err: ", err)
+	}
+
+	leaves := []string{
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+		"0x9965507D1a55bcC2695C58ba16FB37d819B0A4dc",
+		"0x8b1b201E91966957f18bBcDDB520c53c521bF5cd",
+		"0xeA726629EC5fe5cE300000d1a8c89B3054A22cE7",
+	}
+	assert.Nil(t, tree.AppendLeaves(leaves))
+	exporter.Reset()
+
+	proof, err := tree.GenerateProof(leaves[2])
+	assert.Nil(t, err)
+	assert.Len(t, proof, 3)
+
+	spans := exporter.GetSpans()
+	var proofSpan tracetest.SpanStub
+	for _, span := range spans {
+		if span.Name == "merkletree.proof" {
+			proofSpan = span
+		}
+	}
+	if proofSpan.Name == "" {
+		t.Fatal("no proof span")
+	}
+	index, _ := attr(proofSpan, LeafIndexKey)
+	assert.Equal(t, int64(2), index.AsInt64())
+	levels, _ := attr(proofSpan, LevelsKey)
+	assert.Equal(t, int64(4), levels.AsInt64())
+	tree1, _ := attr(proofSpan, TreeKey)
+	assert.Equal(t, "1637704523306766336", tree1.AsString())
+
+	// 存储调用是证明的子 span
+	fetched := false
+	for _, span := range spans {
+		if span.Name != "merkletree.storage.FindMultiTreeNode" {
+			continue
+		}
+		fetched = true
+		assert.Equal(t, proofSpan.SpanContext.SpanID(), span.Parent.SpanID())
+		nodes, _ := attr(span, NodesKey)
+		assert.Less(t, int64(0), nodes.AsInt64())
+		backend, _ := attr(span, BackendKey)
+		assert.Equal(t, "memory", backend.AsString())
+	}
+	assert.True(t, fetched)
+	for _, span := range spans {
+		assert.Equal(t, codes.Unset, span.Status.Code, span.Name)
+	}
+
+	exporter.Reset()
+	assert.NotNil(t, tree.AppendLeaf("not an address"))
+	spans = exporter.GetSpans()
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, "merkletree.append", spans[0].Name)
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+	}
+
+	// 追加记录新叶子的位置与层数
+	exporter.Reset()
+	assert.Nil(t, tree.AppendLeaf("0x1aD91ee08f21bE3dE0BA2ba6918E714dA6B45836"))
+	appended := false
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "merkletree.append" {
+			appended = true
+			index, _ := attr(span, LeafIndexKey)
+			assert.Equal(t, int64(5), index.AsInt64())
+			levels, _ := attr(span, LevelsKey)
+			assert.Equal(t, int64(4), levels.AsInt64())
+		}
+	}
+	assert.True(t, appended)
+}
@@ -0,0 +1,318 @@
+package merkletree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/UXUYLabs/go-merkletree/db"
+	"github.com/UXUYLabs/go-merkletree/keccak256"
+)
+
+// ErrRootMismatch is returned when the stored root of a tree differs from the
+// root recomputed from its leaves.
+var ErrRootMismatch = errors.New("stored root does not match the leaves")
+
+// IssueKind classifies an inconsistency found by Verify.
+type IssueKind string
+
+const (
+	// IssueMissingNode is a position of the tree without a node.
+	IssueMissingNode IssueKind = "missing node"
+	// IssueExtraNode is a node outside the positions of the tree.
+	IssueExtraNode IssueKind = "extra node"
+	// IssuePositionMismatch is a node stored at a position other than its own.
+	IssuePositionMismatch IssueKind = "position mismatch"
+	// IssueInvalidLeaf is a leaf whose data the leaf schema rejects.
+	IssueInvalidLeaf IssueKind = "invalid leaf"
+	// IssueHashMismatch is a node whose hash differs from the one recomputed
+	// from its data or its children.
+	IssueHashMismatch IssueKind = "hash mismatch"
+	// IssueIndexMismatch is a leaf the leaf index does not find where it is.
+	IssueIndexMismatch IssueKind = "index mismatch"
+	// IssueRootMismatch is a root or metadata disagreeing with the nodes.
+	IssueRootMismatch IssueKind = "root mismatch"
+)
+
+// Issue is one inconsistency of a tree, at the position of the node concerned.
+type Issue struct {
+	Kind    IssueKind
+	Level   int
+	LevelNo int
+	Detail  string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("level=%d levelNo=%d %s: %s", i.Level, i.LevelNo, i.Kind, i.Detail)
+}
+
+// VerifyReport is the result of Verify. The tree is consistent when Issues is empty.
+type VerifyReport struct {
+	MtAddress string
+	LeafCount int
+	Depth     int
+	Issues    []Issue
+}
+
+func (r *VerifyReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+func (r *VerifyReport) add(kind IssueKind, level, levelNo int, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, Issue{Kind: kind, Level: level, LevelNo: levelNo, Detail: fmt.Sprintf(format, args...)})
+}
+
+// Verify is VerifyCtx with the context the tree was created with.
+func (t *MerkleTree) Verify() (*VerifyReport, error) {
+	return t.VerifyCtx(t.ctx)
+}
+
+// VerifyCtx walks every level of the tree and checks it is the tree its
+// leaves define: each leaf hash is recomputed from its data and found by the
+// leaf index, each parent is recomputed from its children with the tree's
+// hasher, no position is missing or extra, and the root and metadata agree.
+// Every inconsistency is reported; the error is only for failing reads.
+func (t *MerkleTree) VerifyCtx(ctx context.Context) (_ *VerifyReport, err error) {
+	ctx, end := t.observe(ctx, OpCheck)
+	defer func() { end(err) }()
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	report := &VerifyReport{MtAddress: t.mtAddress}
+
+	leaves, err := t.verifyLevel(ctx, report, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	width := 0
+	for no := range leaves {
+		if no >= width {
+			width = no + 1
+		}
+	}
+	report.LeafCount = width
+	if width == 0 {
+		return report, t.verifyEmpty(ctx, report)
+	}
+	if err = t.verifyLeaves(ctx, report, leaves, width); err != nil {
+		return nil, err
+	}
+
+	level, children := 0, leaves
+	for childWidth := width; childWidth > 1; childWidth = width {
+		level++
+		width = (childWidth + 1) / 2
+		nodes, err := t.verifyLevel(ctx, report, level, width)
+		if err != nil {
+			return nil, err
+		}
+
+		for no := 0; no < width; no++ {
+			node := nodes[no]
+			left, right := children[2*no], children[2*no+1]
+			if node == nil || left == nil || (right == nil && 2*no+1 < childWidth) {
+				// 缺失的节点已单独报告
+				continue
+			}
+
+			hash := left.Hash
+			if right != nil {
+				hash = t.hashBranch(left.Hash, right.Hash)
+			}
+			if node.Hash != hash {
+				report.add(IssueHashMismatch, level, no, "stored %s, children give %s", node.Hash, hash)
+			}
+		}
+		children = nodes
+	}
+	report.Depth = level + 1
+	observed(ctx, -1, report.Depth)
+
+	// 根节点之上不应再有节点
+	for extra := level + 1; ; extra++ {
+		nodes, err := t.storage.FindNodesByLevel(ctx, t.mtAddress, extra)
+		if err == db.ErrNotFound {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			report.add(IssueExtraNode, extra, node.LevelNo, "level above the root")
+		}
+	}
+
+	return report, t.verifyRoot(ctx, report, children[0], level)
+}
+
+// VerifyTree is VerifyTreeCtx with the context the manager was created with.
+func (mm *MerkleTreeManager) VerifyTree(mtAddress string) (*VerifyReport, error) {
+	return mm.VerifyTreeCtx(mm.ctx, mtAddress)
+}
+
+// VerifyTreeCtx runs VerifyCtx on a tree with the hasher and leaf schema it
+// was registered with. Unlike OpenTree it registers nothing, so it is safe on
+// a storage only being inspected.
+func (mm *MerkleTreeManager) VerifyTreeCtx(ctx context.Context, mtAddress string) (*VerifyReport, error) {
+	tree, err := mm.inspectTree(ctx, mtAddress)
+	if err != nil {
+		return nil, err
+	}
+	return tree.VerifyCtx(ctx)
+}
+
+// verifyLevel reads a level and reports nodes at the wrong position, and
+// positions missing or extra when width is known.
+func (t *MerkleTree) verifyLevel(ctx context.Context, report *VerifyReport, level, width int) (map[int]*db.TreeNode, error) {
+	nodes, err := t.storage.FindNodesByLevel(ctx, t.mtAddress, level)
+	if err != nil && err != db.ErrNotFound {
+		t.Error("VerifyCtx FindNodesByLevel err: ", err)
+		return nil, err
+	}
+
+	byNo := make(map[int]*db.TreeNode, len(nodes))
+	for _, node := range nodes {
+		if node.Level != level || node.MtAddress != t.mtAddress {
+			report.add(IssuePositionMismatch, level, node.LevelNo, "node of tree %s at level %d", node.MtAddress, node.Level)
+			continue
+		}
+		if byNo[node.LevelNo] != nil {
+			report.add(IssuePositionMismatch, level, node.LevelNo, "several nodes at the same position")
+			continue
+		}
+		if node.LevelNo < 0 || (width >= 0 && node.LevelNo >= width) {
+			report.add(IssueExtraNode, level, node.LevelNo, "level holds %d nodes", width)
+			continue
+		}
+		byNo[node.LevelNo] = node
+	}
+
+	for no := 0; no < width; no++ {
+		if byNo[no] == nil {
+			report.add(IssueMissingNode, level, no, "no node")
+		}
+	}
+	return byNo, nil
+}
+
+func (t *MerkleTree) verifyLeaves(ctx context.Context, report *VerifyReport, leaves map[int]*db.TreeNode, width int) error {
+	seen := make(map[string]int, len(leaves))
+	for no := 0; no < width; no++ {
+		leaf := leaves[no]
+		if leaf == nil {
+			report.add(IssueMissingNode, 0, no, "no leaf")
+			continue
+		}
+
+		if err := t.schema.Validate(leaf.Data); err != nil {
+			report.add(IssueInvalidLeaf, 0, no, "%v", err)
+			continue
+		}
+		if hash := keccak256.Bytes2Hex(t.hasher.HashLeaf(leaf.Data)); leaf.Hash != hash {
+			report.add(IssueHashMismatch, 0, no, "stored %s, data gives %s", leaf.Hash, hash)
+		}
+
+		if first, ok := seen[leaf.Data]; ok {
+			report.add(IssueIndexMismatch, 0, no, "data also held by leaf %d", first)
+			continue
+		}
+		seen[leaf.Data] = no
+
+		indexed, err := t.storage.FindOneByLeafData(ctx, t.mtAddress, leaf.Data)
+		if err == db.ErrNotFound {
+			report.add(IssueIndexMismatch, 0, no, "leaf index has no entry for %s", leaf.Data)
+			continue
+		}
+		if err != nil {
+			t.Error("VerifyCtx FindOneByLeafData err: ", err)
+			return err
+		}
+		if indexed.Level != 0 || indexed.LevelNo != no || indexed.Hash != leaf.Hash {
+			report.add(IssueIndexMismatch, 0, no, "leaf index points at level=%d levelNo=%d", indexed.Level, indexed.LevelNo)
+		}
+	}
+	return nil
+}
+
+// verifyRoot checks the stored root and metadata designate top, the single
+// node of the last level.
+func (t *MerkleTree) verifyRoot(ctx context.Context, report *VerifyReport, top *db.TreeNode, level int) error {
+	if top == nil {
+		return nil
+	}
+
+	root, err := t.storage.FindRootNode(ctx, t.mtAddress)
+	if err != nil && err != db.ErrNotFound {
+		t.Error("VerifyCtx FindRootNode err: ", err)
+		return err
+	}
+	if root == nil || root.Level != top.Level || root.LevelNo != top.LevelNo || root.Hash != top.Hash {
+		report.add(IssueRootMismatch, level, 0, "storage returns root %v", root)
+	}
+
+	meta, err := db.FindTreeMeta(ctx, t.storage, t.mtAddress)
+	if err != nil && err != db.ErrNotFound {
+		t.Error("VerifyCtx FindTreeMeta err: ", err)
+		return err
+	}
+	if meta == nil || meta.LeafCount != report.LeafCount || meta.Depth != report.Depth || meta.RootHash != top.Hash {
+		report.add(IssueRootMismatch, level, 0, "metadata %+v", meta)
+	}
+	return nil
+}
+
+// verifyEmpty reports the nodes of a tree without leaves.
+func (t *MerkleTree) verifyEmpty(ctx context.Context, report *VerifyReport) error {
+	root, err := t.storage.FindRootNode(ctx, t.mtAddress)
+	if err == db.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		t.Error("VerifyCtx FindRootNode err: ", err)
+		return err
+	}
+	report.add(IssueExtraNode, root.Level, root.LevelNo, "tree has no leaves")
+	return nil
+}
+
+// checkRoot recomputes the root of the tree from its leaves, promoting an
+// unpaired node to the next level as appendLeaf does, and compares it with
+// the stored root.
+func (t *MerkleTree) checkRoot(ctx context.Context) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	root, err := t.storage.FindRootNode(ctx, t.mtAddress)
+	if err == db.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	leaves, err := t.storage.FindNodesByLevel(ctx, t.mtAddress, 0)
+	if err != nil {
+		return err
+	}
+
+	level := make([][]byte, 0, len(leaves))
+	for _, leaf := range leaves {
+		level = append(level, keccak256.Hex2Bytes(leaf.Hash))
+	}
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 < len(level) {
+				next = append(next, t.hasher.HashPair(level[i], level[i+1]))
+			} else {
+				next = append(next, level[i])
+			}
+		}
+		level = next
+	}
+
+	if computed := keccak256.Bytes2Hex(level[0]); computed != root.Hash {
+		return fmt.Errorf("%w: tree %s root %s, leaves give %s", ErrRootMismatch, t.mtAddress, root.Hash, computed)
+	}
+	return nil
+}